@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/nick96/merger/pkg/merger"
+)
+
+// Exit codes, so that workflows can tell pull requests failing to merge apart
+// from merger itself being broken.
+const (
+	// exitFailed means some pull requests or repositories couldn't be
+	// checked or merged.
+	exitFailed = 1
+	// exitConfig means merger was given an invalid configuration.
+	exitConfig = 2
+	// exitAuth means merger couldn't authenticate with GitHub or ran out of
+	// rate limit.
+	exitAuth = 3
+	// exitCircuitOpen means so many GitHub API requests in a row failed that
+	// merger gave up on the run.
+	exitCircuitOpen = 4
+)
+
+// configFatal logs the configuration error and exits with exitConfig.
+func configFatal(v ...interface{}) {
+	log.Print(v...)
+	os.Exit(exitConfig)
+}
+
+// configFatalf formats and logs the configuration error and exits with
+// exitConfig.
+func configFatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(exitConfig)
+}
+
+// runFatal logs the error from running merger and exits with the matching
+// exit code.
+func runFatal(err error) {
+	log.Print(err)
+	if errors.Is(err, merger.ErrCircuitOpen) {
+		os.Exit(exitCircuitOpen)
+	}
+	if merger.IsAuthError(err) {
+		os.Exit(exitAuth)
+	}
+	os.Exit(exitFailed)
+}
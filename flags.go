@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+)
+
+// stringListFlag is a flag that can be repeated and/or given a comma
+// separated list of values. All values are accumulated in the order they were
+// given.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			*f = append(*f, part)
+		}
+	}
+	return nil
+}
+
+// repeatedFlag is a flag that can be repeated. Unlike stringListFlag, values
+// aren't split at commas, as they may contain them.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
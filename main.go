@@ -1,18 +1,26 @@
 // CLI tool to merge PRs with specified labels that have passed checks.
 //
 // This tool is intended to be run at a regular interval (e.g. using GitHub
-// workflows).
+// workflows). The merge logic itself is in pkg/merger.
 package main
 
 import (
 	"context"
 	"flag"
-	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"time"
+	// Embedded so -timezone works on runners without a time zone database.
+	_ "time/tzdata"
 
 	"github.com/google/go-github/v32/github"
+	"github.com/nick96/merger/pkg/merger"
 	"golang.org/x/oauth2"
 )
 
@@ -22,163 +30,1288 @@ var (
 		os.Getenv("GITHUB_TOKEN"),
 		"GitHub token used for authentication. Uses GITHUB_TOKEN if not provided.",
 	)
-	repoFlag = flag.String(
-		"repository",
-		os.Getenv("GITHUB_REPOSITORY"),
-		"GitHub repository to check issues on. Should be of the for <owner>/<repo>. Uses GITHUB_REPOSITORY if not provided.",
+	apiURLFlag = flag.String(
+		"api-url",
+		os.Getenv("GITHUB_API_URL"),
+		"Base URL of the GitHub API, for use with GitHub Enterprise Server (e.g. https://github.example.com/api/v3/). Uses GITHUB_API_URL if not provided, otherwise github.com is used.",
 	)
-	labelFlag = flag.String(
-		"label",
+	providerFlag = flag.String(
+		"provider",
+		"github",
+		"Forge hosting the repositories. One of github, gitlab, gitea, which also covers Forgejo, or azure for Azure DevOps. With gitlab, -token defaults to GITLAB_TOKEN, -api-url to CI_API_V4_URL or https://gitlab.com/api/v4 and -repository to CI_PROJECT_PATH. With gitea, -token defaults to GITEA_TOKEN if it is set and -api-url must point at the instance's API (e.g. https://codeberg.org/api/v1). With azure, -token defaults to AZURE_DEVOPS_EXT_PAT or SYSTEM_ACCESSTOKEN, -api-url to SYSTEM_COLLECTIONURI and -repository, given as <project>/<repository>, to the pipeline's. Only the flags that apply to every forge can be used with forges other than GitHub.",
+	)
+	appIDFlag = flag.Int64(
+		"app-id",
+		0,
+		"ID of the GitHub App to authenticate as. When set, -installation-id and -private-key-path are required and -token is ignored.",
+	)
+	installationIDFlag = flag.Int64(
+		"installation-id",
+		0,
+		"ID of the GitHub App installation to authenticate as.",
+	)
+	privateKeyPathFlag = flag.String(
+		"private-key-path",
+		"",
+		"Path to the PEM encoded private key of the GitHub App.",
+	)
+	orgFlag = flag.String(
+		"org",
+		"",
+		"GitHub organisation to discover repositories in. Can be used instead of or as well as -repository.",
+	)
+	renovateFlag = flag.Bool(
+		"renovate",
+		false,
+		"Enable Renovate integration: respect its stability days and automerge settings, and ask it to rebase conflicting pull requests.",
+	)
+	repoTopicFlag = flag.String(
+		"repo-topic",
+		"",
+		"Only process repositories discovered with -org that have this topic.",
+	)
+	labelMatchFlag = flag.String(
+		"label-match",
+		"all",
+		"How to match pull requests against the labels given by -label. One of all (PR must have every label) or any (PR must have at least one).",
+	)
+	logFormatFlag = flag.String(
+		"log-format",
+		"text",
+		"Format to log in. One of text or json. JSON log lines include fields such as the repository, pull request, check and decision.",
+	)
+	logLevelFlag = flag.String(
+		"log-level",
+		"info",
+		"Least severe level to log. One of debug, info, warn or error. The state of each check is only logged at debug.",
+	)
+	pullRequestFlag = flag.Int(
+		"pr",
+		0,
+		"Number of a single pull request to check and merge, whatever its labels. Only pull requests in a single -repository can be given. Useful for a workflow_dispatch workflow that merges a pull request on demand.",
+	)
+	maxMergesFlag = flag.Int(
+		"max-merges",
+		0,
+		"Most pull requests to merge in a single run, across all repositories. Zero means there is no limit.",
+	)
+	reportFlag = flag.String(
+		"report",
+		"",
+		"Path to write a JSON report of each run to, with the decision, reason, check states and merge commit of every pull request checked.",
+	)
+	sortFlag = flag.String(
+		"sort",
+		"",
+		"Order to check and merge pull requests in. One of oldest, newest or least-recently-updated. Defaults to the order GitHub lists them in.",
+	)
+	titlePatternFlag = flag.String(
+		"title-pattern",
+		"",
+		"Regular expression the title of a pull request must match for it to be merged (e.g. '^chore\\(deps\\)'). Any title is allowed if empty.",
+	)
+	minAgeFlag = flag.Duration(
+		"min-age",
+		0,
+		"How long ago a pull request must have been opened for it to be merged (e.g. 24h), giving it time to be reviewed. Pull requests of any age are merged if 0.",
+	)
+	maxAgeFlag = flag.Duration(
+		"max-age",
+		0,
+		"How long ago a pull request may have been opened at most for it to be merged (e.g. 720h), so old pull requests aren't merged by surprise when labelled again. Pull requests of any age are merged if 0.",
+	)
+	preMergeCommandFlag = flag.String(
+		"pre-merge-command",
+		"",
+		"Shell command to run before merging each pull request. Pull requests aren't merged if it fails. The pull request is described by the MERGER_REPOSITORY, MERGER_PR_NUMBER, MERGER_PR_TITLE, MERGER_PR_AUTHOR, MERGER_PR_URL, MERGER_PR_BASE, MERGER_PR_HEAD, MERGER_PR_HEAD_SHA and MERGER_MERGE_METHOD environment variables.",
+	)
+	postMergeCommandFlag = flag.String(
+		"post-merge-command",
+		"",
+		"Shell command to run after merging each pull request, with the same environment variables as -pre-merge-command and MERGER_MERGE_SHA. Failures are only logged.",
+	)
+	opaBundleFlag = flag.String(
+		"opa-bundle",
+		"",
+		"Open Policy Agent bundle, a directory or .tar.gz file, with a Rego policy that must allow pull requests for them to be merged. The policy is given the pull request, its checks and its reviews as input, and -opa-query must be an object with allow and reason.",
+	)
+	opaQueryFlag = flag.String(
+		"opa-query",
+		"data.merger",
+		"Query of the -opa-bundle policy that decides whether pull requests may be merged.",
+	)
+	wipTitlePatternFlag = flag.String(
+		"wip-title-pattern",
+		merger.DefaultWIPTitlePattern,
+		"Regular expression matching the titles of pull requests that are still a work in progress, which are never merged. Empty merges them regardless of their title.",
+	)
+	mergeRetriesFlag = flag.Int(
+		"merge-retries",
+		3,
+		"Number of times to retry merging a pull request when GitHub reports its base branch was modified.",
+	)
+	circuitBreakerThresholdFlag = flag.Int(
+		"circuit-breaker-threshold",
+		10,
+		"Number of GitHub API requests in a row that may fail with a network error, a 5xx or a 401 response before merger gives up on the run and exits with code 4. 0 never gives up.",
+	)
+	apiRetriesFlag = flag.Int(
+		"api-retries",
+		3,
+		"Number of times to retry GitHub API requests that fail with a network error or a 5xx response.",
+	)
+	apiRetryBackoffFlag = flag.Duration(
+		"api-retry-backoff",
+		time.Second,
+		"How long to wait before the first retry of a failed GitHub API request. The wait doubles with each retry.",
+	)
+	perPageFlag = flag.Int(
+		"per-page",
+		100,
+		"Number of results to request per page when listing from the GitHub API. Must be between 1 and 100.",
+	)
+	requiredOnlyFlag = flag.Bool(
+		"required-only",
+		false,
+		"Only require the checks that the base branch's protection rules mark as required to pass. Other checks are ignored.",
+	)
+	minChecksFlag = flag.Int(
+		"min-checks",
+		0,
+		"Fewest finished check runs and commit statuses a pull request must have to be merged, so it isn't merged when CI wasn't triggered at all. Pull requests without any checks are merged if 0.",
+	)
+	minCheckAgeFlag = flag.Duration(
+		"min-check-age",
+		0,
+		"How long the checks of a pull request must have finished for before merging it (e.g. 30m), giving people time to object after the last push. Pull requests can be merged as soon as their checks pass if 0.",
+	)
+	requiredApprovalsFlag = flag.Int(
+		"required-approvals",
+		0,
+		"Number of approving reviews a pull request needs before it is merged.",
+	)
+	freshApprovalsFlag = flag.Bool(
+		"fresh-approvals",
+		false,
+		"Only count approvals of the pull request's latest commit towards -required-approvals.",
+	)
+	requireSignedCommitsFlag = flag.Bool(
+		"require-signed-commits",
+		false,
+		"Only merge pull requests whose commits all have a signature GitHub has verified.",
+	)
+	requireSignOffFlag = flag.Bool(
+		"require-signoff",
+		false,
+		"Only merge pull requests whose commits all carry a Signed-off-by trailer from their author, as the Developer Certificate of Origin (DCO) requires.",
+	)
+	codeownersFlag = flag.Bool(
+		"codeowners",
+		false,
+		"Only merge pull requests where every changed file has been approved by one of its owners in the base branch's CODEOWNERS file.",
+	)
+	allowDraftsFlag = flag.Bool(
+		"allow-drafts",
+		false,
+		"Consider draft pull requests for merging. By default drafts are always skipped.",
+	)
+	deleteBranchFlag = flag.Bool(
+		"delete-branch",
+		false,
+		"Delete the head branch of pull requests after merging them. Branches in forks are never deleted.",
+	)
+	dependabotMaxBumpFlag = flag.String(
+		"dependabot-max-bump",
+		"",
+		"Largest version bump a Dependabot pull request may make to be merged. One of patch, minor or major.",
+	)
+	commentOnBlockedFlag = flag.Bool(
+		"comment-on-blocked",
+		false,
+		"Comment on pull requests that are blocked by failing or pending checks, listing the checks. The comment is updated rather than reposted on later runs.",
+	)
+	blockedCommentFlag = flag.String(
+		"blocked-comment",
 		"",
-		"Label to filter pull requests by. Only PRs with this label will be checked and merged.",
+		"Go template for the comment posted by -comment-on-blocked. Has .Number, .Title, .Author, .URL and .FailingChecks (each with .Name, .State and .URL). Defaults to a list of the failing checks.",
+	)
+	commitTitleTemplateFlag = flag.String(
+		"commit-title-template",
+		"",
+		"Go template for the title of merge and squashed commits (e.g. '{{.Title}} (#{{.Number}})'). Has .Number, .Title, .Author, .URL and .Labels. GitHub's default title is used if empty.",
+	)
+	graphQLMergeFlag = flag.Bool(
+		"graphql-merge",
+		false,
+		"Merge pull requests with GraphQL's mergePullRequest mutation instead of the REST API. When authenticated as a GitHub App, GitHub signs the commits it creates this way, so pull requests can be merged into branches that require signed commits.",
+	)
+	conventionalCommitsFlag = flag.Bool(
+		"conventional-commits",
+		false,
+		"When squashing, use the pull request's title and description as the commit message, following Conventional Commits, instead of -merge-message. Pull requests whose titles aren't Conventional Commits (e.g. feat(api): add pagination) aren't merged.",
+	)
+	mergeMessageFlag = flag.String(
+		"merge-message",
+		merger.DefaultMergeMessage,
+		"Go template for the merge commit message. Has .Number, .Title, .Author, .URL and .Labels.",
+	)
+	slackWebhookURLFlag = flag.String(
+		"slack-webhook-url",
+		os.Getenv("SLACK_WEBHOOK_URL"),
+		"Slack incoming webhook URL to notify about merged, failed and persistently blocked pull requests. Uses SLACK_WEBHOOK_URL if not provided.",
+	)
+	teamsWebhookURLFlag = flag.String(
+		"teams-webhook-url",
+		os.Getenv("TEAMS_WEBHOOK_URL"),
+		"Microsoft Teams incoming webhook URL to notify about merged, failed and persistently blocked pull requests. Uses TEAMS_WEBHOOK_URL if not provided.",
+	)
+	discordWebhookURLFlag = flag.String(
+		"discord-webhook-url",
+		os.Getenv("DISCORD_WEBHOOK_URL"),
+		"Discord webhook URL to notify about merged, failed and persistently blocked pull requests. Uses DISCORD_WEBHOOK_URL if not provided.",
+	)
+	eventWebhookURLFlag = flag.String(
+		"event-webhook-url",
+		"",
+		"URL to post a JSON event to whenever a pull request is merged, blocked or fails. Pull requests still blocked or failing on later runs don't get another event.",
+	)
+	eventWebhookSecretFlag = flag.String(
+		"event-webhook-secret",
+		os.Getenv("MERGER_EVENT_WEBHOOK_SECRET"),
+		"Secret to sign events posted to -event-webhook-url with, using HMAC-SHA256 in the X-Merger-Signature-256 header. Uses MERGER_EVENT_WEBHOOK_SECRET if not provided.",
+	)
+	rateLimitThresholdFlag = flag.Int(
+		"rate-limit-threshold",
+		100,
+		"Number of requests left in a GitHub API rate limit below which -rate-limit-action is taken. Zero disables it.",
+	)
+	rateLimitActionFlag = flag.String(
+		"rate-limit-action",
+		"abort",
+		"What to do once the rate limit drops below -rate-limit-threshold. One of abort, which stops checking pull requests until the next run, or pause, which waits for the rate limit to reset.",
+	)
+	smtpAddressFlag = flag.String(
+		"smtp-address",
+		"",
+		"Address of the SMTP server to send emails with, as host:port (e.g. smtp.example.com:587).",
+	)
+	smtpUsernameFlag = flag.String(
+		"smtp-username",
+		"",
+		"Username to authenticate to the SMTP server with. No authentication is used if empty.",
+	)
+	smtpPasswordFlag = flag.String(
+		"smtp-password",
+		os.Getenv("SMTP_PASSWORD"),
+		"Password to authenticate to the SMTP server with. Uses SMTP_PASSWORD if not provided.",
+	)
+	emailFromFlag = flag.String(
+		"email-from",
+		"",
+		"Address to send emails from.",
+	)
+	notifyBlockedAfterFlag = flag.Duration(
+		"notify-blocked-after",
+		24*time.Hour,
+		"How long a pull request must have been blocked for before notifying about it. Only pull requests blocked while merger keeps running with -daemon or serve are notified about.",
+	)
+	mergedNotificationFlag = flag.String(
+		"merged-notification",
+		merger.DefaultMergedNotification,
+		"Go template for notifications about merged pull requests. Has .Repository, .Number, .Title, .Author and .URL.",
+	)
+	blockedNotificationFlag = flag.String(
+		"blocked-notification",
+		merger.DefaultBlockedNotification,
+		"Go template for notifications about persistently blocked pull requests. Has .Repository, .Number, .Title, .Author, .URL and .Reason.",
+	)
+	failedNotificationFlag = flag.String(
+		"failed-notification",
+		merger.DefaultFailedNotification,
+		"Go template for notifications about pull requests that failed to be checked or merged. Has .Repository, .Number, .Title, .Author, .URL and .Reason.",
+	)
+	successLabelFlag = flag.String(
+		"success-label",
+		"",
+		"Label to add to pull requests after merging them (e.g. merged-by-merger).",
+	)
+	failureLabelFlag = flag.String(
+		"failure-label",
+		"",
+		"Label to add to pull requests that failed to be checked or merged (e.g. merger-failed).",
+	)
+	freezeLabelFlag = flag.String(
+		"freeze-label",
+		"",
+		"Label that freezes a repository while an open issue has it or it is one of the repository's topics (e.g. merge-freeze). Runs are dry runs for frozen repositories, reporting ready pull requests as held by the freeze.",
+	)
+	timezoneFlag = flag.String(
+		"timezone",
+		"",
+		"IANA time zone that -merge-window and -freeze are in (e.g. Australia/Sydney). The local time zone is used if not given, which is UTC on GitHub Actions runners.",
+	)
+	staleAfterFlag = flag.Duration(
+		"stale-after",
+		0,
+		"How long a pull request may be blocked for, since it was labelled, before -stale-action is taken on it (e.g. 168h). Blocked pull requests are retried forever if 0.",
+	)
+	staleActionFlag = flag.String(
+		"stale-action",
+		"comment",
+		"What to do about pull requests blocked for longer than -stale-after. One of comment, label (with -stale-label) or unlabel, which removes the labels given by -label so they are no longer retried.",
+	)
+	staleLabelFlag = flag.String(
+		"stale-label",
+		merger.DefaultStaleLabel,
+		"Label to add to pull requests blocked for longer than -stale-after with -stale-action label.",
+	)
+	removeLabelOnMergeFlag = flag.Bool(
+		"remove-label-on-merge",
+		false,
+		"Remove the labels given by -label from pull requests after merging them.",
+	)
+	enableAutoMergeFlag = flag.Bool(
+		"enable-auto-merge",
+		false,
+		"Enable GitHub's auto-merge on eligible pull requests instead of checking and merging them, leaving the merge to GitHub once branch protection is satisfied.",
+	)
+	mergeQueueFlag = flag.Bool(
+		"merge-queue",
+		false,
+		"Add pull requests to their base branch's merge queue instead of merging them. Pull requests targeting branches without a merge queue are merged as normal.",
+	)
+	mergeTrainFlag = flag.Bool(
+		"merge-train",
+		false,
+		"Merge pull requests that are ready in batches. Each batch is merged into a merger/train/<base> branch and the base branch is only fast-forwarded once the checks on it pass. Batches that fail are bisected.",
+	)
+	mergeTrainTimeoutFlag = flag.Duration(
+		"merge-train-timeout",
+		time.Hour,
+		"How long to wait for the checks of a merge train to finish.",
+	)
+	serialFlag = flag.Bool(
+		"serial",
+		false,
+		"Merge pull requests one at a time, updating each one with its base branch and waiting for its checks to pass again if earlier pull requests were merged since they ran.",
+	)
+	serialTimeoutFlag = flag.Duration(
+		"serial-timeout",
+		time.Hour,
+		"How long to wait for the checks of a pull request to finish after updating it in -serial mode.",
+	)
+	rerunFailedChecksFlag = flag.Int(
+		"rerun-failed-checks",
+		0,
+		"How many times to re-run each failed check of a pull request, in case it is flaky, before leaving it blocked. Failed checks aren't re-run if 0.",
+	)
+	stuckCheckAfterFlag = flag.Duration(
+		"stuck-check-after",
+		0,
+		"How long a check run may be queued or in progress before it is reported as stuck (e.g. 2h). Check runs are waited on forever if 0.",
+	)
+	cancelStuckChecksFlag = flag.Bool(
+		"cancel-stuck-checks",
+		false,
+		"Cancel the workflow runs of GitHub Actions jobs stuck for longer than -stuck-check-after, so they fail rather than blocking pull requests. With -rerun-failed-checks they are then re-run.",
+	)
+	waitFlag = flag.Bool(
+		"wait",
+		false,
+		"Wait for the checks of pull requests that are still running to finish, then merge them, rather than leaving them for a later run.",
+	)
+	waitTimeoutFlag = flag.Duration(
+		"wait-timeout",
+		30*time.Minute,
+		"How long to wait for the checks of each pull request to finish with -wait.",
+	)
+	updateBranchFlag = flag.Bool(
+		"update-branch",
+		false,
+		"Update pull requests that are behind their base branch instead of skipping them, then wait for their checks to pass on the new head and merge them.",
+	)
+	updateBranchTimeoutFlag = flag.Duration(
+		"update-branch-timeout",
+		30*time.Minute,
+		"How long to wait for the checks of a pull request to finish after updating it with -update-branch. Pull requests whose checks take longer are merged on a later run.",
+	)
+	dryRunFlag = flag.Bool(
+		"dry-run",
+		false,
+		"Check pull requests as normal but only log which ones would be merged instead of merging them.",
+	)
+	graphQLFlag = flag.Bool(
+		"graphql",
+		false,
+		"Fetch pull requests along with their checks, reviews and mergeability using GraphQL, instead of making several REST requests for each pull request.",
+	)
+	searchFlag = flag.Bool(
+		"search",
+		false,
+		"Use the search API to only fetch open pull requests with the labels, rather than listing every open pull request and filtering them. Search results can lag behind label changes by a few minutes.",
+	)
+	concurrencyFlag = flag.Int(
+		"concurrency",
+		1,
+		"Number of pull requests to evaluate at once. Pull requests are still merged one at a time. Pull requests stacked on or depending on others are merged on the run after them rather than straight after them.",
+	)
+	repositoryConcurrencyFlag = flag.Int(
+		"repository-concurrency",
+		1,
+		"Number of repositories to process at once when merging across several repositories. Can't be used with -max-merges.",
+	)
+	daemonFlag = flag.Bool(
+		"daemon",
+		false,
+		"Keep running and check pull requests every -interval instead of exiting after a single pass.",
+	)
+	intervalFlag = flag.Duration(
+		"interval",
+		5*time.Minute,
+		"How often to check pull requests when running with -daemon.",
+	)
+	intervalJitterFlag = flag.Duration(
+		"interval-jitter",
+		0,
+		"Most to add at random to -interval before each run, so several merger daemons started together don't all hit the API at once.",
+	)
+	maxIntervalFlag = flag.Duration(
+		"max-interval",
+		0,
+		"Double -interval after each run in which nothing changed, up to this, and go back to -interval as soon as something does. 0 disables backing off.",
+	)
+	timeoutFlag = flag.Duration(
+		"timeout",
+		10*time.Minute,
+		"How long a run may take before it is abandoned, so a hung request or a huge repository can't keep merger running forever. With -daemon this applies to each run and with serve to handling each event. 0 disables the timeout.",
+	)
+	metricsAddressFlag = flag.String(
+		"metrics-address",
+		"",
+		"Address to serve Prometheus metrics on at /metrics when running with -daemon.",
+	)
+	otlpEndpointFlag = flag.String(
+		"otlp-endpoint",
+		merger.OTLPEndpointFromEnv(),
+		"OTLP over HTTP endpoint to export traces of each run to, such as http://localhost:4318/v1/traces. Uses OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT if not provided.",
+	)
+	listenAddressFlag = flag.String(
+		"listen-address",
+		":8080",
+		"Address to listen for GitHub webhooks on when running the serve command.",
+	)
+	webhookSecretFlag = flag.String(
+		"webhook-secret",
+		os.Getenv("GITHUB_WEBHOOK_SECRET"),
+		"Secret used to verify the signature of GitHub webhooks when running the serve command. Uses GITHUB_WEBHOOK_SECRET if not provided.",
+	)
+	mergeMethodFlag = flag.String(
+		"merge-method",
+		"merge",
+		"Method used to merge pull requests. One of merge, squash or rebase.",
 	)
 )
 
+var (
+	repositoriesFlag   stringListFlag
+	labelsFlag         stringListFlag
+	blockLabelsFlag    stringListFlag
+	baseBranchesFlag   stringListFlag
+	allowedAuthorsFlag stringListFlag
+	excludePRsFlag     stringListFlag
+	ignoreChecksFlag   stringListFlag
+	requireChecksFlag  stringListFlag
+	expectChecksFlag   stringListFlag
+
+	passingConclusionsFlag stringListFlag
+	priorityLabelsFlag     stringListFlag
+	emailToFlag            stringListFlag
+	mergeWindowsFlag       stringListFlag
+	freezesFlag            stringListFlag
+	checkTimeoutsFlag      stringListFlag
+	expressionsFlag        repeatedFlag
+
+	// serveMode is set when merger is run with the serve command, listening
+	// for webhooks instead of listing pull requests.
+	serveMode bool
+)
+
 func init() {
+	flag.StringVar(
+		mergeMessageFlag,
+		"commit-message-template",
+		merger.DefaultMergeMessage,
+		"Go template for the merge commit message. The same as -merge-message.",
+	)
+	flag.Var(
+		&repositoriesFlag,
+		"repository",
+		"GitHub repository to check issues on. Should be of the for <owner>/<repo>. Can be repeated or given as a comma separated list. Uses GITHUB_REPOSITORY if not provided.",
+	)
+	flag.Var(
+		&labelsFlag,
+		"label",
+		"Label to filter pull requests by. Only PRs with this label will be checked and merged. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&blockLabelsFlag,
+		"block-label",
+		"Label that prevents a pull request from being merged (e.g. do-not-merge). Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&baseBranchesFlag,
+		"base-branch",
+		"Only merge pull requests targeting this branch. Supports glob patterns (e.g. release/*). Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&allowedAuthorsFlag,
+		"allowed-author",
+		"Only merge pull requests opened by this user (e.g. dependabot[bot]). Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&excludePRsFlag,
+		"exclude-pr",
+		"Number of a pull request to never check or merge, even if it has the labels. Given as <number> for pull requests in any repository or <owner>/<repo>#<number>. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&ignoreChecksFlag,
+		"ignore-check",
+		"Name of a check run or commit status to ignore when deciding whether to merge. Supports glob patterns. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&requireChecksFlag,
+		"require-check",
+		"Name of a check run or commit status that must be reported and pass before merging. Supports glob patterns. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&expectChecksFlag,
+		"expect-check",
+		"Name of a check run or commit status expected to be reported for the head commit, so pull requests aren't merged before CI has picked them up. Unlike -require-check, it only has to be reported, not to pass. Supports glob patterns. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&checkTimeoutsFlag,
+		"check-timeout",
+		"How long a check may be pending for, from when it started, as <pattern>=<duration> (e.g. 'codecov/*=10m'). Checks pending for longer count as failed, and -serial, -merge-train and -wait stop waiting for them. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&passingConclusionsFlag,
+		"passing-conclusion",
+		"Check run conclusion, besides success, to treat as passing (e.g. skipped or neutral). Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&priorityLabelsFlag,
+		"priority-label",
+		"Label giving pull requests priority when merging, from highest to lowest (e.g. P0,P1,P2). Pull requests without any of them are merged last. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&priorityLabelsFlag,
+		"priority-labels",
+		"Comma separated list of labels giving pull requests priority when merging, from highest to lowest (e.g. P0,P1,P2). The same as -priority-label.",
+	)
+	flag.Var(
+		&emailToFlag,
+		"email-to",
+		"Address to email a summary of each run to, using -smtp-address. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&mergeWindowsFlag,
+		"merge-window",
+		"Time of the week to merge pull requests in, as [<days>] <start>-<end> (e.g. 'Mon-Fri 09:00-16:00'). Pull requests are still checked outside of it, but are only merged during one. Can be repeated or given as a comma separated list. Pull requests may be merged at any time if not given.",
+	)
+	flag.Var(
+		&freezesFlag,
+		"freeze",
+		"Period to not merge pull requests in, as [<name>=]<start>/<end> with dates (e.g. holidays=2024-12-20/2025-01-03) or times (2006-01-02T15:04). Runs during a freeze are dry runs, reporting ready pull requests as held by the freeze. Can be repeated or given as a comma separated list.",
+	)
+	flag.Var(
+		&expressionsFlag,
+		"expression",
+		"CEL expression over the pull request as pr that must be true for it to be merged (e.g. \"pr.additions < 500 && pr.author in ['dependabot[bot]']\"). See the README for the fields of pr. Can be repeated, and all of them must be true.",
+	)
+}
+
+// parseFlags parses the command line. This is done in main rather than init so
+// that the test binary can register and parse its own flags.
+func parseFlags() {
 	flag.Parse()
+
+	// Flags may be given after the serve command as well as before it.
+	if flag.Arg(0) == "serve" {
+		serveMode = true
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
 }
 
 func main() {
+	parseFlags()
+	if err := merger.SetLogFormat(*logFormatFlag); err != nil {
+		configFatalf("Invalid -log-format: %v", err)
+	}
+	if err := merger.SetLogLevel(*logLevelFlag); err != nil {
+		configFatalf("Invalid -log-level: %v", err)
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	provider := *providerFlag
+	if provider != "github" && provider != "gitlab" && provider != "gitea" && provider != "azure" {
+		configFatalf("Provider must be one of github, gitlab, gitea or azure. '%s' is not.", provider)
+	}
+	if provider != "github" {
+		for _, name := range githubOnlyFlags {
+			if given[name] {
+				configFatalf("-%s can only be used with -provider=github.", name)
+			}
+		}
+		if serveMode {
+			configFatal("The serve command can only be used with -provider=github.")
+		}
+	}
+
+	appID := *appIDFlag
+	installationID := *installationIDFlag
+	privateKeyPath := *privateKeyPathFlag
 	token := *tokenFlag
-	if strings.TrimSpace(token) == "" {
-		log.Fatal("GitHub token not provided via CLI or environment variable.")
+	apiURL := *apiURLFlag
+	switch {
+	case provider == "gitlab":
+		// GitLab CI sets CI_API_V4_URL and CI_PROJECT_PATH like GitHub Actions
+		// sets GITHUB_API_URL and GITHUB_REPOSITORY.
+		if !given["token"] {
+			token = os.Getenv("GITLAB_TOKEN")
+		}
+		if !given["api-url"] {
+			apiURL = os.Getenv("CI_API_V4_URL")
+		}
+		if apiURL == "" {
+			apiURL = merger.DefaultGitLabAPIURL
+		}
+		if strings.TrimSpace(token) == "" {
+			configFatal("GitLab token not provided via CLI or environment variable.")
+		}
+	case provider == "gitea":
+		// Gitea and Forgejo Actions set the same variables as GitHub Actions,
+		// so only GITEA_TOKEN needs checking on top of them.
+		if giteaToken := os.Getenv("GITEA_TOKEN"); !given["token"] && giteaToken != "" {
+			token = giteaToken
+		}
+		if strings.TrimSpace(apiURL) == "" {
+			configFatal("Gitea API URL not provided via CLI or environment variable.")
+		}
+		if strings.TrimSpace(token) == "" {
+			configFatal("Gitea token not provided via CLI or environment variable.")
+		}
+	case provider == "azure":
+		// Azure Pipelines only exposes System.AccessToken to scripts that map
+		// it to SYSTEM_ACCESSTOKEN, so a token for the Azure CLI comes first.
+		if !given["token"] {
+			token = os.Getenv("AZURE_DEVOPS_EXT_PAT")
+			if token == "" {
+				token = os.Getenv("SYSTEM_ACCESSTOKEN")
+			}
+		}
+		if !given["api-url"] {
+			apiURL = os.Getenv("SYSTEM_COLLECTIONURI")
+		}
+		if strings.TrimSpace(apiURL) == "" {
+			configFatal("Azure DevOps organisation URL not provided via CLI or environment variable.")
+		}
+		if strings.TrimSpace(token) == "" {
+			configFatal("Azure DevOps token not provided via CLI or environment variable.")
+		}
+	case appID != 0:
+		if installationID == 0 {
+			configFatal("GitHub App installation ID not provided.")
+		}
+		if strings.TrimSpace(privateKeyPath) == "" {
+			configFatal("GitHub App private key path not provided.")
+		}
+	case strings.TrimSpace(token) == "":
+		configFatal("GitHub token not provided via CLI or environment variable.")
 	}
 
-	repo := *repoFlag
-	if strings.TrimSpace(repo) == "" {
-		log.Fatal("GitHub repository not provided via CLI or environment variable.")
+	org := *orgFlag
+	repoTopic := *repoTopicFlag
+	if repoTopic != "" && org == "" {
+		configFatal("Repository topic can only be used with -org.")
 	}
 
-	label := *labelFlag
-	if strings.TrimSpace(label) == "" {
-		log.Fatal("Label filter not provided.")
+	if len(repositoriesFlag) == 0 && org == "" && provider == "gitlab" {
+		_ = repositoriesFlag.Set(os.Getenv("CI_PROJECT_PATH"))
+	} else if len(repositoriesFlag) == 0 && org == "" && provider == "azure" {
+		if project, name := os.Getenv("SYSTEM_TEAMPROJECT"), os.Getenv("BUILD_REPOSITORY_NAME"); project != "" && name != "" {
+			_ = repositoriesFlag.Set(project + "/" + name)
+		}
+	} else if len(repositoriesFlag) == 0 && org == "" {
+		_ = repositoriesFlag.Set(os.Getenv("GITHUB_REPOSITORY"))
+	}
+	if len(repositoriesFlag) == 0 && org == "" {
+		configFatal("Repository or organisation not provided via CLI or environment variable.")
+	}
+	parseRepository := merger.ParseRepository
+	if provider == "gitlab" {
+		// GitLab projects can be in nested groups.
+		parseRepository = merger.ParseProjectPath
+	}
+	repos := []merger.Repository{}
+	for _, fullName := range repositoriesFlag {
+		repo, err := parseRepository(fullName)
+		if err != nil {
+			configFatal(err)
+		}
+		repos = append(repos, repo)
 	}
 
-	repoParts := strings.Split(repo, "/")
-	if len(repoParts) != 2 {
-		log.Fatalf("Expected GitHub repository name to be of the form <owner>/<repo>. '%s' is not.", repo)
+	pullRequest := *pullRequestFlag
+	if pullRequest < 0 {
+		configFatalf("Pull request number must not be negative. %d is.", pullRequest)
+	}
+	if pullRequest != 0 && (len(repos) != 1 || org != "") {
+		configFatal("-pr can only be used with a single -repository.")
+	}
+	if pullRequest != 0 && (*daemonFlag || serveMode) {
+		configFatal("-pr can't be used with -daemon or the serve command.")
 	}
 
-	ctx := context.TODO()
-	owner := repoParts[0]
-	repoName := repoParts[1]
-	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tokenClient := oauth2.NewClient(ctx, tokenSource)
-	client := github.NewClient(tokenClient)
+	// Labels may instead be given in the repository's config file, which is
+	// checked when the repository is processed.
+	labels := []string(labelsFlag)
+	if len(labels) == 0 && provider != "github" {
+		configFatalf("-label must be given with -provider=%s, as repositories can only configure merger on GitHub.", provider)
+	}
 
-	pullRequests, _, err := client.PullRequests.List(ctx, owner, repoName, &github.PullRequestListOptions{})
-	if err != nil {
-		log.Fatalf("Failed to retrieve pull requests from %s: %v", repo, err)
+	labelMatch := *labelMatchFlag
+	if labelMatch != "all" && labelMatch != "any" {
+		configFatalf("Label match must be one of all or any. '%s' is not.", labelMatch)
+	}
+
+	mergeMethod := *mergeMethodFlag
+	if !merger.IsValidMergeMethod(mergeMethod) {
+		configFatalf("Merge method must be one of merge, squash or rebase. '%s' is not.", mergeMethod)
+	}
+	if mergeMethod == "rebase" && provider == "gitlab" {
+		configFatal("GitLab can't merge with the rebase merge method.")
 	}
-	log.Printf("Retrieved a total of %d pull requests from %s", len(pullRequests), repo)
 
-	labeledPullRequests := filterPullRequestsByLabel(pullRequests, label)
-	log.Printf("Found %d pull requests in %s with the label %s", len(labeledPullRequests), repo, label)
+	sortOrder := *sortFlag
+	if !merger.IsValidSortOrder(sortOrder) {
+		configFatalf("Sort must be one of oldest, newest or least-recently-updated. '%s' is not.", sortOrder)
+	}
+
+	perPage := *perPageFlag
+	if perPage < 1 || perPage > 100 {
+		configFatalf("Per page must be between 1 and 100. %d is not.", perPage)
+	}
 
-	failureCount := 0
-	for _, pullRequest := range labeledPullRequests {
-		if err := checkAndMerge(ctx, client, owner, repoName, pullRequest); err != nil {
-			log.Print(err)
-			failureCount++
+	if err := merger.ValidatePatterns(baseBranchesFlag); err != nil {
+		configFatalf("Invalid -base-branch: %v", err)
+	}
+	if err := merger.ValidatePullRequestReferences(excludePRsFlag); err != nil {
+		configFatalf("Invalid -exclude-pr: %v", err)
+	}
+	var titlePattern *regexp.Regexp
+	if *titlePatternFlag != "" {
+		var err error
+		titlePattern, err = regexp.Compile(*titlePatternFlag)
+		if err != nil {
+			configFatalf("Invalid -title-pattern: %v", err)
+		}
+	}
+	var wipTitlePattern *regexp.Regexp
+	if *wipTitlePatternFlag != "" {
+		var err error
+		wipTitlePattern, err = regexp.Compile(*wipTitlePatternFlag)
+		if err != nil {
+			configFatalf("Invalid -wip-title-pattern: %v", err)
+		}
+	}
+	if *minAgeFlag < 0 || *maxAgeFlag < 0 {
+		configFatalf("-min-age and -max-age must not be negative. %s and %s are not.", *minAgeFlag, *maxAgeFlag)
+	}
+	if *maxAgeFlag > 0 && *maxAgeFlag < *minAgeFlag {
+		configFatalf("-max-age must not be less than -min-age. %s is less than %s.", *maxAgeFlag, *minAgeFlag)
+	}
+	expressions := []*merger.Expression{}
+	for _, source := range expressionsFlag {
+		expression, err := merger.ParseExpression(source)
+		if err != nil {
+			configFatalf("Invalid -expression: %v", err)
+		}
+		expressions = append(expressions, expression)
+	}
+	location := time.Local
+	if *timezoneFlag != "" {
+		var err error
+		if location, err = time.LoadLocation(*timezoneFlag); err != nil {
+			configFatalf("Invalid -timezone: %v", err)
+		}
+	}
+	mergeWindows := []merger.MergeWindow{}
+	for _, source := range mergeWindowsFlag {
+		window, err := merger.ParseMergeWindow(source)
+		if err != nil {
+			configFatalf("Invalid -merge-window: %v", err)
+		}
+		mergeWindows = append(mergeWindows, window)
+	}
+	checkTimeouts := []merger.CheckTimeout{}
+	for _, source := range checkTimeoutsFlag {
+		checkTimeout, err := merger.ParseCheckTimeout(source)
+		if err != nil {
+			configFatalf("Invalid -check-timeout: %v", err)
 		}
+		checkTimeouts = append(checkTimeouts, checkTimeout)
+	}
+	freezes := []merger.Freeze{}
+	for _, source := range freezesFlag {
+		freeze, err := merger.ParseFreeze(source, location)
+		if err != nil {
+			configFatalf("Invalid -freeze: %v", err)
+		}
+		freezes = append(freezes, freeze)
+	}
+	var opaPolicy *merger.OPAPolicy
+	if *opaBundleFlag != "" {
+		var err error
+		opaPolicy, err = merger.NewOPAPolicy(context.Background(), *opaBundleFlag, *opaQueryFlag)
+		if err != nil {
+			configFatalf("Invalid -opa-bundle: %v", err)
+		}
+	}
+	if err := merger.ValidatePatterns(ignoreChecksFlag); err != nil {
+		configFatalf("Invalid -ignore-check: %v", err)
+	}
+	if err := merger.ValidatePatterns(requireChecksFlag); err != nil {
+		configFatalf("Invalid -require-check: %v", err)
+	}
+	if err := merger.ValidatePatterns(expectChecksFlag); err != nil {
+		configFatalf("Invalid -expect-check: %v", err)
 	}
 
-	if failureCount > 0 {
-		log.Fatalf(
-			"Failed to check and merge %d/%d pull requests. See the above logs for details.",
-			failureCount,
-			len(labeledPullRequests),
-		)
+	dependabotMaxBump := *dependabotMaxBumpFlag
+	if dependabotMaxBump != "" && !merger.IsValidBump(dependabotMaxBump) {
+		configFatalf("Dependabot max bump must be one of patch, minor or major. '%s' is not.", dependabotMaxBump)
 	}
-}
 
-func filterPullRequestsByLabel(pullRequests []*github.PullRequest, expectedLabel string) []*github.PullRequest {
-	filteredPullRequests := []*github.PullRequest{}
-	for _, pullRequest := range pullRequests {
-		contains := false
-		for _, label := range pullRequest.Labels {
-			if label.GetName() == expectedLabel {
-				contains = true
-			}
+	requiredApprovals := *requiredApprovalsFlag
+	if requiredApprovals < 0 {
+		configFatalf("Required approvals must not be negative. %d is.", requiredApprovals)
+	}
+
+	if *minChecksFlag < 0 {
+		configFatalf("-min-checks must not be negative. %d is.", *minChecksFlag)
+	}
+	if *minCheckAgeFlag < 0 {
+		configFatalf("-min-check-age must not be negative. %s is.", *minCheckAgeFlag)
+	}
+
+	if err := merger.ValidateConclusions(passingConclusionsFlag); err != nil {
+		configFatalf("Invalid -passing-conclusion: %v", err)
+	}
+
+	if err := merger.ValidateTemplate(*mergeMessageFlag); err != nil {
+		configFatalf("Invalid -merge-message: %v", err)
+	}
+	if err := merger.ValidateTemplate(*commitTitleTemplateFlag); err != nil {
+		configFatalf("Invalid -commit-title-template: %v", err)
+	}
+	blockedComment := *blockedCommentFlag
+	if blockedComment == "" {
+		blockedComment = merger.DefaultBlockedComment
+	}
+	if err := merger.ValidateTemplate(blockedComment); err != nil {
+		configFatalf("Invalid -blocked-comment: %v", err)
+	}
+
+	if err := merger.ValidateTemplate(*mergedNotificationFlag); err != nil {
+		configFatalf("Invalid -merged-notification: %v", err)
+	}
+	if err := merger.ValidateTemplate(*blockedNotificationFlag); err != nil {
+		configFatalf("Invalid -blocked-notification: %v", err)
+	}
+	if err := merger.ValidateTemplate(*failedNotificationFlag); err != nil {
+		configFatalf("Invalid -failed-notification: %v", err)
+	}
+	if *staleAfterFlag < 0 {
+		configFatalf("-stale-after must not be negative. %s is.", *staleAfterFlag)
+	}
+	if !merger.IsValidStaleAction(*staleActionFlag) {
+		configFatalf("Stale action must be one of comment, label or unlabel. '%s' is not.", *staleActionFlag)
+	}
+	if *staleActionFlag == "label" && *staleLabelFlag == "" {
+		configFatal("-stale-action label needs a label given by -stale-label.")
+	}
+	if *notifyBlockedAfterFlag < 0 {
+		configFatalf("-notify-blocked-after must not be negative. %s is.", *notifyBlockedAfterFlag)
+	}
+	notifiers := []merger.Notifier{}
+	if slackWebhookURL := *slackWebhookURLFlag; slackWebhookURL != "" {
+		notifiers = append(notifiers, merger.NewSlackNotifier(slackWebhookURL))
+	}
+	if teamsWebhookURL := *teamsWebhookURLFlag; teamsWebhookURL != "" {
+		notifiers = append(notifiers, merger.NewTeamsNotifier(teamsWebhookURL))
+	}
+	if discordWebhookURL := *discordWebhookURLFlag; discordWebhookURL != "" {
+		notifiers = append(notifiers, merger.NewDiscordNotifier(discordWebhookURL))
+	}
+	var webhook *merger.EventWebhook
+	if eventWebhookURL := *eventWebhookURLFlag; eventWebhookURL != "" {
+		if _, err := url.ParseRequestURI(eventWebhookURL); err != nil {
+			configFatalf("Invalid -event-webhook-url: %v", err)
+		}
+		webhook = merger.NewEventWebhook(eventWebhookURL, *eventWebhookSecretFlag)
+	}
+	var summaryEmailer *merger.Emailer
+	if len(emailToFlag) > 0 {
+		if *smtpAddressFlag == "" || *emailFromFlag == "" {
+			configFatal("-email-to requires -smtp-address and -email-from.")
 		}
-		if contains {
-			filteredPullRequests = append(filteredPullRequests, pullRequest)
+		if _, _, err := net.SplitHostPort(*smtpAddressFlag); err != nil {
+			configFatalf("Invalid -smtp-address: %v", err)
 		}
+		summaryEmailer = merger.NewEmailer(*smtpAddressFlag, *smtpUsernameFlag, *smtpPasswordFlag, *emailFromFlag, emailToFlag)
+	}
+
+	rateLimitThreshold := *rateLimitThresholdFlag
+	if rateLimitThreshold < 0 {
+		configFatalf("Rate limit threshold must not be negative. %d is.", rateLimitThreshold)
+	}
+	rateLimitAction := *rateLimitActionFlag
+	if rateLimitAction != "abort" && rateLimitAction != "pause" {
+		configFatalf("Invalid rate limit action %s. Must be one of abort or pause.", rateLimitAction)
+	}
+
+	concurrency := *concurrencyFlag
+	if concurrency < 1 {
+		configFatalf("Concurrency must be at least 1. %d is not.", concurrency)
+	}
+
+	repositoryConcurrency := *repositoryConcurrencyFlag
+	if repositoryConcurrency < 1 {
+		configFatalf("Repository concurrency must be at least 1. %d is not.", repositoryConcurrency)
+	}
+
+	maxMerges := *maxMergesFlag
+	if maxMerges < 0 {
+		configFatalf("Max merges must not be negative. %d is.", maxMerges)
+	}
+	if maxMerges > 0 && repositoryConcurrency > 1 {
+		configFatal("-max-merges can't be used with -repository-concurrency, as repositories processed at once could merge past the limit.")
+	}
+
+	if *rerunFailedChecksFlag < 0 {
+		configFatalf("-rerun-failed-checks must not be negative. %d is.", *rerunFailedChecksFlag)
+	}
+	if *stuckCheckAfterFlag < 0 {
+		configFatalf("-stuck-check-after must not be negative. %s is.", *stuckCheckAfterFlag)
+	}
+	if *cancelStuckChecksFlag && *stuckCheckAfterFlag == 0 {
+		configFatal("-cancel-stuck-checks needs -stuck-check-after to say when checks are stuck.")
+	}
+	mergeRetries := *mergeRetriesFlag
+	if mergeRetries < 0 {
+		configFatalf("Merge retries must not be negative. %d is.", mergeRetries)
+	}
+
+	apiRetries := *apiRetriesFlag
+	if apiRetries < 0 {
+		configFatalf("API retries must not be negative. %d is.", apiRetries)
+	}
+	apiRetryBackoff := *apiRetryBackoffFlag
+	if apiRetryBackoff < 0 {
+		configFatalf("API retry backoff must not be negative. %s is.", apiRetryBackoff)
+	}
+
+	circuitBreakerThreshold := *circuitBreakerThresholdFlag
+	if circuitBreakerThreshold < 0 {
+		configFatalf("Circuit breaker threshold must not be negative. %d is.", circuitBreakerThreshold)
+	}
+
+	interval := *intervalFlag
+	if *daemonFlag && interval <= 0 {
+		configFatalf("Interval must be greater than zero. %s is not.", interval)
+	}
+
+	intervalJitter := *intervalJitterFlag
+	if intervalJitter < 0 {
+		configFatalf("Interval jitter must not be negative. %s is.", intervalJitter)
+	}
+
+	maxInterval := *maxIntervalFlag
+	if maxInterval < 0 {
+		configFatalf("Max interval must not be negative. %s is.", maxInterval)
+	}
+	if maxInterval > 0 && maxInterval < interval {
+		configFatalf("Max interval must be at least the interval, %s. %s is not.", interval, maxInterval)
+	}
+
+	if *waitFlag && *waitTimeoutFlag <= 0 {
+		configFatalf("Wait timeout must be greater than zero. %s is not.", *waitTimeoutFlag)
+	}
+
+	timeout := *timeoutFlag
+	if timeout < 0 {
+		configFatalf("Timeout must not be negative. %s is.", timeout)
+	}
+
+	metricsAddress := *metricsAddressFlag
+	if metricsAddress != "" && !*daemonFlag {
+		configFatal("-metrics-address can only be used with -daemon.")
+	}
+
+	webhookSecret := *webhookSecretFlag
+	if *mergeTrainFlag {
+		if *enableAutoMergeFlag || *mergeQueueFlag || *serialFlag {
+			configFatal("-merge-train can't be used with -enable-auto-merge, -merge-queue or -serial.")
+		}
+		if *mergeTrainTimeoutFlag <= 0 {
+			configFatalf("Merge train timeout must be greater than zero. %s is not.", *mergeTrainTimeoutFlag)
+		}
+	}
+
+	if *updateBranchFlag && *updateBranchTimeoutFlag <= 0 {
+		configFatalf("Update branch timeout must be greater than zero. %s is not.", *updateBranchTimeoutFlag)
+	}
+	if *serialFlag && *serialTimeoutFlag <= 0 {
+		configFatalf("Serial timeout must be greater than zero. %s is not.", *serialTimeoutFlag)
+	}
+
+	if serveMode {
+		if *daemonFlag {
+			configFatal("The serve command can't be used with -daemon.")
+		}
+		if *mergeTrainFlag || *serialFlag || maxMerges > 0 {
+			configFatal("The serve command can't be used with -merge-train, -serial or -max-merges.")
+		}
+		if strings.TrimSpace(webhookSecret) == "" {
+			configFatal("Webhook secret not provided via CLI or environment variable.")
+		}
+	}
+
+	opts := &merger.Options{
+		Policy: merger.Policy{
+			Labels:               labels,
+			MatchAll:             labelMatch == "all",
+			BlockLabels:          blockLabelsFlag,
+			AllowDrafts:          *allowDraftsFlag,
+			BaseBranches:         baseBranchesFlag,
+			AllowedAuthors:       allowedAuthorsFlag,
+			MinAge:               *minAgeFlag,
+			MaxAge:               *maxAgeFlag,
+			ExcludedPullRequests: excludePRsFlag,
+			TitlePattern:         titlePattern,
+			WIPTitlePattern:      wipTitlePattern,
+			Expressions:          expressions,
+			OPAPolicy:            opaPolicy,
+			DependabotMaxBump:    dependabotMaxBump,
+			RequiredOnly:         *requiredOnlyFlag,
+			IgnoreChecks:         ignoreChecksFlag,
+			RequireChecks:        requireChecksFlag,
+			ExpectChecks:         expectChecksFlag,
+			PassingConclusions:   passingConclusionsFlag,
+			MinChecks:            *minChecksFlag,
+			MinCheckAge:          *minCheckAgeFlag,
+			RequiredApprovals:    requiredApprovals,
+			FreshApprovals:       *freshApprovalsFlag,
+			Codeowners:           *codeownersFlag,
+			RequireSignedCommits: *requireSignedCommitsFlag,
+			RequireSignOff:       *requireSignOffFlag,
+		},
+
+		PriorityLabels:        priorityLabelsFlag,
+		SortOrder:             sortOrder,
+		Renovate:              *renovateFlag,
+		RerunFailedChecks:     *rerunFailedChecksFlag,
+		StuckCheckAfter:       *stuckCheckAfterFlag,
+		CancelStuckChecks:     *cancelStuckChecksFlag,
+		UpdateBranch:          *updateBranchFlag,
+		UpdateBranchTimeout:   *updateBranchTimeoutFlag,
+		EnableAutoMerge:       *enableAutoMergeFlag,
+		MergeQueue:            *mergeQueueFlag,
+		MergeTrain:            *mergeTrainFlag,
+		MergeTrainTimeout:     *mergeTrainTimeoutFlag,
+		Serial:                *serialFlag,
+		SerialTimeout:         *serialTimeoutFlag,
+		Wait:                  *waitFlag,
+		WaitTimeout:           *waitTimeoutFlag,
+		CheckTimeouts:         checkTimeouts,
+		MaxMerges:             maxMerges,
+		PullRequest:           pullRequest,
+		ReportPath:            *reportFlag,
+		GraphQL:               *graphQLFlag,
+		Search:                *searchFlag,
+		Concurrency:           concurrency,
+		RepositoryConcurrency: repositoryConcurrency,
+		Timeout:               timeout,
+		IntervalJitter:        intervalJitter,
+		MaxInterval:           maxInterval,
+		MergeMethod:           mergeMethod,
+		MergeWindows:          mergeWindows,
+		Location:              location,
+		Freezes:               freezes,
+		FreezeLabel:           *freezeLabelFlag,
+		PerPage:               perPage,
+		DryRun:                *dryRunFlag,
+		MergeRetries:          mergeRetries,
+		DeleteBranch:          *deleteBranchFlag,
+		RemoveLabelOnMerge:    *removeLabelOnMergeFlag,
+		SuccessLabel:          *successLabelFlag,
+		FailureLabel:          *failureLabelFlag,
+		CommentOnBlocked:      *commentOnBlockedFlag,
+		StaleAfter:            *staleAfterFlag,
+		StaleAction:           *staleActionFlag,
+		StaleLabel:            *staleLabelFlag,
+		MergeMessage:          *mergeMessageFlag,
+		ConventionalCommits:   *conventionalCommitsFlag,
+		GraphQLMerge:          *graphQLMergeFlag,
+		CommitTitleTemplate:   *commitTitleTemplateFlag,
+		BlockedComment:        blockedComment,
+		PreMergeCommand:       *preMergeCommandFlag,
+		PostMergeCommand:      *postMergeCommandFlag,
+
+		Notifiers:           notifiers,
+		NotifyBlockedAfter:  *notifyBlockedAfterFlag,
+		MergedNotification:  *mergedNotificationFlag,
+		BlockedNotification: *blockedNotificationFlag,
+		FailedNotification:  *failedNotificationFlag,
+		Emailer:             summaryEmailer,
+		EventWebhook:        webhook,
+	}
+
+	ctx := context.Background()
+	clientOpts := merger.ClientOptions{
+		APIURL: apiURL,
+		// Only long-lived mergers make the same requests again.
+		Cache:                   *daemonFlag || serveMode,
+		Retries:                 apiRetries,
+		RetryBackoff:            apiRetryBackoff,
+		CircuitBreakerThreshold: circuitBreakerThreshold,
+		RateLimitThreshold:      rateLimitThreshold,
+		PauseOnRateLimit:        rateLimitAction == "pause",
+	}
+	var m *merger.Merger
+	switch provider {
+	case "gitlab":
+		m = merger.NewWithForge(merger.NewGitLabForge(merger.NewHTTPClient(clientOpts), apiURL, token, perPage), opts)
+	case "gitea":
+		m = merger.NewWithForge(merger.NewGiteaForge(merger.NewHTTPClient(clientOpts), apiURL, token, perPage), opts)
+	case "azure":
+		m = merger.NewWithForge(merger.NewAzureDevOpsForge(merger.NewHTTPClient(clientOpts), apiURL, token, perPage), opts)
+	default:
+		m = merger.New(newGitHubClient(ctx, appID, installationID, privateKeyPath, token, clientOpts), opts)
+	}
+	if otlpEndpoint := *otlpEndpointFlag; otlpEndpoint != "" {
+		if err := m.EnableTracing(otlpEndpoint); err != nil {
+			configFatal(err)
+		}
+	}
+	var metricsHandler http.Handler
+	if metricsAddress != "" {
+		metricsHandler = m.EnableMetrics()
+	}
+
+	if serveMode {
+		// Repositories are only discovered once when serving, restart merger
+		// to pick up new ones.
+		merger.HandleShutdownSignals()
+		if err := m.Serve(ctx, repos, org, repoTopic, *listenAddressFlag, webhookSecret); err != nil {
+			runFatal(err)
+		}
+		merger.Infof("Shut down")
+		return
+	}
+
+	if *daemonFlag {
+		merger.Infof("Running as a daemon, checking pull requests every %s", interval)
+		if metricsHandler != nil {
+			merger.Infof("Serving metrics on %s/metrics", metricsAddress)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metricsHandler)
+			go func() {
+				log.Fatal(http.ListenAndServe(metricsAddress, mux))
+			}()
+		}
+		merger.HandleShutdownSignals()
+		m.RunEvery(ctx, repos, org, repoTopic, interval)
+		merger.Infof("Shut down")
+		return
+	}
+
+	if err := m.Run(ctx, repos, org, repoTopic); err != nil {
+		runFatal(err)
 	}
-	return filteredPullRequests
 }
 
-func checkAndMerge(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) error {
-	checkRunResult, _, err := client.Checks.ListCheckRunsForRef(
-		ctx,
-		owner,
-		repoName,
-		pullRequest.GetHead().GetRef(),
-		&github.ListCheckRunsOptions{},
-	)
-	if err != nil {
-		return fmt.Errorf(
-			"failed to get check run for pull request %d (branch %s): %w",
-			pullRequest.GetNumber(),
-			pullRequest.GetHead().GetLabel(),
-			err,
-		)
-	}
-	log.Printf(
-		"Found %d check runs for pull request %d",
-		checkRunResult.GetTotal(),
-		pullRequest.GetNumber(),
-	)
-
-	allChecksOk := true
-	for _, checkRun := range checkRunResult.CheckRuns {
-		status := checkRun.GetStatus()
-		if status == "completed" {
-			if checkRun.GetConclusion() == "success" {
-				log.Printf("Check run %d for pull request %d successfully completed.", checkRun.GetID(), pullRequest.GetNumber())
-			} else {
-				log.Printf(
-					"Check run %d for pull request %d was not successful (conclusion %s). Not merging it.",
-					checkRun.GetID(),
-					pullRequest.GetNumber(),
-					checkRun.GetConclusion(),
-				)
-				allChecksOk = false
-			}
-		} else {
-			log.Printf(
-				"Check run %d for pull request %d not yet completed (status %s). Not merging it.",
-				checkRun.GetID(),
-				pullRequest.GetNumber(),
-				status,
-			)
-			allChecksOk = false
-		}
-	}
-
-	if allChecksOk {
-		log.Printf("All checks for pull request %d passed", pullRequest.GetNumber())
-		if !pullRequest.GetMergeable() {
-			return fmt.Errorf(
-				"pull request %d it is not in a mergeable state (state %s)",
-				pullRequest.GetNumber(),
-				pullRequest.GetMergeableState(),
-			)
-		}
-
-		mergeResult, _, err := client.PullRequests.Merge(
-			ctx,
-			owner,
-			repoName,
-			pullRequest.GetNumber(),
-			"Merged by merger",
-			&github.PullRequestOptions{},
-		)
+// newGitHubClient creates a GitHub client authenticated as the GitHub App
+// installation if appID is set, otherwise with the token.
+func newGitHubClient(ctx context.Context, appID, installationID int64, privateKeyPath, token string, clientOpts merger.ClientOptions) *github.Client {
+	var tokenSource oauth2.TokenSource
+	if appID != 0 {
+		privateKey, err := ioutil.ReadFile(privateKeyPath)
 		if err != nil {
-			return fmt.Errorf("Failed to merge pull request %d: %w", pullRequest.GetNumber(), err)
+			configFatalf("Failed to read GitHub App private key from %s: %v", privateKeyPath, err)
 		}
-		log.Printf("Successfully merged pull request %d as commit %s", pullRequest.GetNumber(), mergeResult.GetSHA())
+		tokenSource, err = merger.NewAppTokenSource(ctx, clientOpts.APIURL, appID, installationID, privateKey)
+		if err != nil {
+			configFatal(err)
+		}
+	} else {
+		tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
+	client, err := merger.NewClient(ctx, tokenSource, clientOpts)
+	if err != nil {
+		configFatal(err)
 	}
+	return client
+}
 
-	return nil
+// githubOnlyFlags are the flags that rely on features only GitHub has, which
+// can't be used with other providers.
+var githubOnlyFlags = []string{
+	"app-id",
+	"installation-id",
+	"private-key-path",
+	"org",
+	"repo-topic",
+	"renovate",
+	"pr",
+	"merge-retries",
+	"rate-limit-threshold",
+	"rate-limit-action",
+	"required-only",
+	"fresh-approvals",
+	"require-signed-commits",
+	"require-signoff",
+	"expression",
+	"opa-bundle",
+	"opa-query",
+	"codeowners",
+	"delete-branch",
+	"graphql-merge",
+	"success-label",
+	"failure-label",
+	"remove-label-on-merge",
+	"enable-auto-merge",
+	"merge-queue",
+	"merge-train",
+	"merge-train-timeout",
+	"serial",
+	"serial-timeout",
+	"update-branch",
+	"update-branch-timeout",
+	"graphql",
+	"search",
+	"concurrency",
+	"freeze-label",
+	"min-check-age",
+	"stale-after",
+	"stale-action",
+	"stale-label",
+	"rerun-failed-checks",
+	"stuck-check-after",
+	"cancel-stuck-checks",
+	"check-timeout",
+	"wait",
+	"wait-timeout",
 }
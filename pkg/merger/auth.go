@@ -0,0 +1,131 @@
+package merger
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/oauth2"
+)
+
+// GitHub rejects app JWTs that expire more than 10 minutes in the future, so
+// stay comfortably below that.
+const appJWTLifetime = 9 * time.Minute
+
+// NewAppTokenSource creates a token source that authenticates as the
+// installation of a GitHub App. Installation tokens are minted on demand and
+// refreshed automatically when they expire. Tokens are requested from the
+// given API URL, or github.com if it is empty.
+func NewAppTokenSource(ctx context.Context, apiURL string, appID, installationID int64, privateKeyPEM []byte) (oauth2.TokenSource, error) {
+	privateKey, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+
+	jwtSource := oauth2.ReuseTokenSource(nil, &appJWTSource{appID: appID, privateKey: privateKey})
+	appClient, err := newClient(oauth2.NewClient(ctx, jwtSource), apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth2.ReuseTokenSource(nil, &installationTokenSource{
+		ctx:            ctx,
+		client:         appClient,
+		installationID: installationID,
+	}), nil
+}
+
+// appJWTSource produces the short lived JWTs used to authenticate as the
+// GitHub App itself.
+type appJWTSource struct {
+	appID      int64
+	privateKey *rsa.PrivateKey
+}
+
+func (s *appJWTSource) Token() (*oauth2.Token, error) {
+	// Backdate the issue time a little to allow for clock drift between us and
+	// GitHub.
+	now := time.Now()
+	expiry := now.Add(appJWTLifetime)
+	jwt, err := signJWT(s.privateKey, map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": expiry.Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return &oauth2.Token{AccessToken: jwt, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// installationTokenSource exchanges the app's JWT for an installation access
+// token.
+type installationTokenSource struct {
+	ctx            context.Context
+	client         *github.Client
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	installationToken, _, err := s.client.Apps.CreateInstallationToken(s.ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token for installation %d: %w", s.installationID, err)
+	}
+	return &oauth2.Token{
+		AccessToken: installationToken.GetToken(),
+		TokenType:   "token",
+		Expiry:      installationToken.GetExpiresAt(),
+	}, nil
+}
+
+func parseRSAPrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return privateKey, nil
+}
+
+// signJWT creates an RS256 signed JWT with the given claims.
+func signJWT(privateKey *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,37 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) {
+    clientMutationId
+  }
+}`
+
+// enableAutoMerge turns on GitHub's auto-merge for the pull request so GitHub
+// merges it once branch protection is satisfied. GitHub refuses to enable
+// auto-merge on pull requests that can already be merged, in which case false
+// is returned so they can be merged directly.
+func enableAutoMerge(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, mergeMethod string) (bool, error) {
+	err := graphQL(ctx, client, enableAutoMergeMutation, map[string]interface{}{
+		"pullRequestId": pullRequest.GetNodeID(),
+		"mergeMethod":   strings.ToUpper(mergeMethod),
+	}, nil)
+	var errs graphQLErrors
+	if errors.As(err, &errs) && strings.Contains(err.Error(), "clean status") {
+		logInfo(ctx, pullRequestFields(pullRequest), "Pull request %d can already be merged, so auto-merge can't be enabled for it", pullRequest.GetNumber())
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to enable auto-merge for pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(ctx, pullRequestFields(pullRequest).with("decision", "auto-merge enabled"), "Enabled auto-merge for pull request %d", pullRequest.GetNumber())
+	return true, nil
+}
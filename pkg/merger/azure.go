@@ -0,0 +1,314 @@
+package merger
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// The versions of the Azure DevOps REST API merger uses. Policy evaluations
+// are only in the preview of it.
+const (
+	azureAPIVersion       = "7.0"
+	azurePolicyAPIVersion = "7.0-preview.1"
+)
+
+// azureForge is the Forge for Azure DevOps Services and Server. Its
+// repositories are named <project>/<repository> within the organisation or
+// collection the API URL points at.
+type azureForge struct {
+	api     *restClient
+	perPage int
+}
+
+// NewAzureDevOpsForge returns the Forge for the Azure DevOps
+// organisation or collection at apiURL, such as https://dev.azure.com/org,
+// authenticating with a personal access token or a pipeline's
+// System.AccessToken.
+func NewAzureDevOpsForge(httpClient *http.Client, apiURL, token string, perPage int) Forge {
+	credentials := base64.StdEncoding.EncodeToString([]byte(":" + token))
+	return &azureForge{
+		api: &restClient{
+			httpClient: httpClient,
+			baseURL:    apiURL,
+			headers:    map[string]string{"Authorization": "Basic " + credentials},
+		},
+		perPage: perPage,
+	}
+}
+
+// azurePullRequest is the subset of an Azure DevOps pull request merger uses.
+type azurePullRequest struct {
+	PullRequestID int    `json:"pullRequestId"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	CreatedBy     struct {
+		UniqueName string `json:"uniqueName"`
+	} `json:"createdBy"`
+	Labels []struct {
+		Name   string `json:"name"`
+		Active bool   `json:"active"`
+	} `json:"labels"`
+	IsDraft               bool      `json:"isDraft"`
+	SourceRefName         string    `json:"sourceRefName"`
+	TargetRefName         string    `json:"targetRefName"`
+	LastMergeSourceCommit azureRef  `json:"lastMergeSourceCommit"`
+	LastMergeCommit       azureRef  `json:"lastMergeCommit"`
+	MergeStatus           string    `json:"mergeStatus"`
+	CreationDate          time.Time `json:"creationDate"`
+	Repository            struct {
+		WebURL  string `json:"webUrl"`
+		Project struct {
+			ID string `json:"id"`
+		} `json:"project"`
+	} `json:"repository"`
+	Reviewers []struct {
+		UniqueName string `json:"uniqueName"`
+		Vote       int    `json:"vote"`
+	} `json:"reviewers"`
+}
+
+// azureRef is a reference to a commit.
+type azureRef struct {
+	CommitID string `json:"commitId"`
+}
+
+// pullRequest converts the Azure DevOps pull request into a pull request in
+// the repository. Azure DevOps doesn't say when pull requests were last
+// updated, so they count as updated when they were created.
+func (pr *azurePullRequest) pullRequest(repo Repository) *github.PullRequest {
+	pullRequest := &github.PullRequest{
+		Number:    github.Int(pr.PullRequestID),
+		Title:     github.String(pr.Title),
+		Body:      github.String(pr.Description),
+		User:      &github.User{Login: github.String(pr.CreatedBy.UniqueName)},
+		Draft:     github.Bool(pr.IsDraft),
+		HTMLURL:   github.String(pr.Repository.WebURL + "/pullrequest/" + strconv.Itoa(pr.PullRequestID)),
+		CreatedAt: &pr.CreationDate,
+		UpdatedAt: &pr.CreationDate,
+		Head: &github.PullRequestBranch{
+			Ref: github.String(strings.TrimPrefix(pr.SourceRefName, "refs/heads/")),
+			SHA: github.String(pr.LastMergeSourceCommit.CommitID),
+		},
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(strings.TrimPrefix(pr.TargetRefName, "refs/heads/")),
+			Repo: &github.Repository{FullName: github.String(repo.String())},
+		},
+		Mergeable: github.Bool(pr.MergeStatus != "conflicts"),
+	}
+	if pr.MergeStatus == "conflicts" {
+		pullRequest.MergeableState = github.String("dirty")
+	}
+	for _, label := range pr.Labels {
+		if label.Active {
+			pullRequest.Labels = append(pullRequest.Labels, &github.Label{Name: github.String(label.Name)})
+		}
+	}
+	return pullRequest
+}
+
+// repoPath is the path of the repository's Git API.
+func (p *azureForge) repoPath(repo Repository) string {
+	return "/" + url.PathEscape(repo.owner) + "/_apis/git/repositories/" + url.PathEscape(repo.name)
+}
+
+// pullRequestPath is the path of the pull request's API, followed by suffix
+// and the API version.
+func (p *azureForge) pullRequestPath(repo Repository, number int, suffix string) string {
+	return fmt.Sprintf("%s/pullrequests/%d%s?api-version=%s", p.repoPath(repo), number, suffix, azureAPIVersion)
+}
+
+func (p *azureForge) ListCandidates(ctx context.Context, repo Repository, labels []string, matchAll bool) ([]*github.PullRequest, error) {
+	pullRequests := []*github.PullRequest{}
+	for skip := 0; ; skip += p.perPage {
+		var page struct {
+			Value []*azurePullRequest `json:"value"`
+		}
+		_, err := p.api.do(
+			ctx,
+			http.MethodGet,
+			fmt.Sprintf("%s/pullrequests?searchCriteria.status=active&$top=%d&$skip=%d&api-version=%s", p.repoPath(repo), p.perPage, skip, azureAPIVersion),
+			nil,
+			&page,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range page.Value {
+			pullRequests = append(pullRequests, pr.pullRequest(repo))
+		}
+		if len(page.Value) < p.perPage {
+			break
+		}
+	}
+	return filterPullRequestsByLabels(pullRequests, labels, matchAll), nil
+}
+
+// azurePolicyEvaluation is the evaluation of a branch policy, such as build
+// validation or a minimum number of reviewers, on a pull request.
+type azurePolicyEvaluation struct {
+	Status        string `json:"status"`
+	Configuration struct {
+		IsEnabled  bool `json:"isEnabled"`
+		IsBlocking bool `json:"isBlocking"`
+		Type       struct {
+			DisplayName string `json:"displayName"`
+		} `json:"type"`
+		Settings struct {
+			DisplayName string `json:"displayName"`
+		} `json:"settings"`
+	} `json:"configuration"`
+	Context struct {
+		BuildID int `json:"buildId"`
+	} `json:"context"`
+}
+
+// name is the name of the policy, which is the one given to it for build
+// validation and otherwise its type.
+func (e *azurePolicyEvaluation) name() string {
+	if e.Configuration.Settings.DisplayName != "" {
+		return e.Configuration.Settings.DisplayName
+	}
+	return e.Configuration.Type.DisplayName
+}
+
+// state returns the policy's status as a check run conclusion, or pending if
+// it is still being evaluated.
+func (e *azurePolicyEvaluation) state() string {
+	switch e.Status {
+	case "approved":
+		return "success"
+	case "rejected", "broken":
+		return "failure"
+	default:
+		return "pending"
+	}
+}
+
+func (p *azureForge) CheckStatus(ctx context.Context, repo Repository, pullRequest *github.PullRequest, policy *Policy) (CheckStatus, error) {
+	if pullRequest.GetMergeableState() == "dirty" {
+		return CheckStatus{Cause: "conflicts", Reason: "it has conflicts"}, nil
+	}
+
+	// Get the pull request again for the ID its project's policies are
+	// evaluated under and its reviewers' latest votes.
+	var pr azurePullRequest
+	if _, err := p.api.do(ctx, http.MethodGet, p.pullRequestPath(repo, pullRequest.GetNumber(), ""), nil, &pr); err != nil {
+		return CheckStatus{}, fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	var evaluations struct {
+		Value []*azurePolicyEvaluation `json:"value"`
+	}
+	artifactID := fmt.Sprintf("vstfs:///CodeReview/CodeReviewId/%s/%d", pr.Repository.Project.ID, pr.PullRequestID)
+	path := fmt.Sprintf("/%s/_apis/policy/evaluations?artifactId=%s&api-version=%s", url.PathEscape(repo.owner), url.QueryEscape(artifactID), azurePolicyAPIVersion)
+	if _, err := p.api.do(ctx, http.MethodGet, path, nil, &evaluations); err != nil {
+		return CheckStatus{}, fmt.Errorf("failed to get policy evaluations: %w", err)
+	}
+	checks := []BlockingCheck{}
+	for _, evaluation := range evaluations.Value {
+		// Optional policies and those that don't apply, such as build
+		// validation filtered to other paths, never block completing the pull
+		// request.
+		if !evaluation.Configuration.IsEnabled || !evaluation.Configuration.IsBlocking || evaluation.Status == "notApplicable" {
+			continue
+		}
+		check := BlockingCheck{Name: evaluation.name(), State: evaluation.state()}
+		if evaluation.Context.BuildID != 0 {
+			check.URL = fmt.Sprintf("%s/%s/_build/results?buildId=%d", strings.TrimSuffix(p.api.baseURL, "/"), url.PathEscape(repo.owner), evaluation.Context.BuildID)
+		}
+		checks = append(checks, check)
+	}
+	if status := checkStatus(checks, policy); !status.Passed {
+		return status, nil
+	}
+
+	if policy.RequiredApprovals > 0 {
+		approved := 0
+		for _, reviewer := range pr.Reviewers {
+			// 10 is approved and 5 approved with suggestions.
+			if reviewer.Vote >= 5 {
+				approved++
+			}
+		}
+		if approved < policy.RequiredApprovals {
+			return CheckStatus{
+				Cause:  "approvals",
+				Reason: fmt.Sprintf("it has %d/%d required approvals", approved, policy.RequiredApprovals),
+			}, nil
+		}
+	}
+	return CheckStatus{Passed: true}, nil
+}
+
+// azureMergeStrategies are the Azure DevOps merge strategies for each merge
+// method.
+var azureMergeStrategies = map[string]string{
+	"merge":  "noFastForward",
+	"squash": "squash",
+	"rebase": "rebase",
+}
+
+// Merge completes the pull request. Azure DevOps takes the whole commit
+// message at once, so its usual title is used if title is empty.
+func (p *azureForge) Merge(ctx context.Context, repo Repository, pullRequest *github.PullRequest, mergeMethod, title, message string) (string, error) {
+	if title == "" {
+		title = fmt.Sprintf("Merged PR %d: %s", pullRequest.GetNumber(), pullRequest.GetTitle())
+	}
+	body := map[string]interface{}{
+		"status": "completed",
+		// Only complete the pull request if its head is the commit whose
+		// policies were evaluated.
+		"lastMergeSourceCommit": azureRef{CommitID: pullRequest.GetHead().GetSHA()},
+		"completionOptions": map[string]interface{}{
+			"mergeStrategy":      azureMergeStrategies[mergeMethod],
+			"mergeCommitMessage": title + "\n\n" + message,
+		},
+	}
+	var completed azurePullRequest
+	if _, err := p.api.do(ctx, http.MethodPatch, p.pullRequestPath(repo, pullRequest.GetNumber(), ""), body, &completed); err != nil {
+		return "", err
+	}
+	return completed.LastMergeCommit.CommitID, nil
+}
+
+// Comment posts the body as a new comment thread on the pull request, or
+// updates the first comment of the thread containing the marker.
+func (p *azureForge) Comment(ctx context.Context, repo Repository, pullRequest *github.PullRequest, marker, body string) error {
+	var threads struct {
+		Value []struct {
+			ID       int `json:"id"`
+			Comments []struct {
+				ID      int    `json:"id"`
+				Content string `json:"content"`
+			} `json:"comments"`
+		} `json:"value"`
+	}
+	if _, err := p.api.do(ctx, http.MethodGet, p.pullRequestPath(repo, pullRequest.GetNumber(), "/threads"), nil, &threads); err != nil {
+		return err
+	}
+	for _, thread := range threads.Value {
+		if len(thread.Comments) == 0 || !strings.Contains(thread.Comments[0].Content, marker) {
+			continue
+		}
+		if thread.Comments[0].Content == body {
+			return nil
+		}
+		suffix := fmt.Sprintf("/threads/%d/comments/%d", thread.ID, thread.Comments[0].ID)
+		_, err := p.api.do(ctx, http.MethodPatch, p.pullRequestPath(repo, pullRequest.GetNumber(), suffix), map[string]string{"content": body}, nil)
+		return err
+	}
+	thread := map[string]interface{}{
+		"comments": []map[string]interface{}{{"parentCommentId": 0, "content": body, "commentType": "text"}},
+		"status":   "active",
+	}
+	_, err := p.api.do(ctx, http.MethodPost, p.pullRequestPath(repo, pullRequest.GetNumber(), "/threads"), thread, nil)
+	return err
+}
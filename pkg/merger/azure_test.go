@@ -0,0 +1,19 @@
+package merger
+
+import "testing"
+
+func TestAzurePolicyEvaluationState(t *testing.T) {
+	tests := map[string]string{
+		"approved": "success",
+		"rejected": "failure",
+		"broken":   "failure",
+		"running":  "pending",
+		"queued":   "pending",
+	}
+	for status, want := range tests {
+		evaluation := &azurePolicyEvaluation{Status: status}
+		if got := evaluation.state(); got != want {
+			t.Errorf("state() of %s = %s, want %s", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package merger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// etagCacheSize is the most responses the ETag cache holds. Once full, the
+// oldest responses are evicted first.
+const etagCacheSize = 10000
+
+// etagTransport caches the responses to GET requests and revalidates them with
+// If-None-Match. GitHub doesn't count 304 Not Modified responses against the
+// rate limit, so repeatedly polling repositories that haven't changed is
+// mostly free.
+type etagTransport struct {
+	next http.RoundTripper
+
+	mu      sync.Mutex
+	entries map[string]*etagEntry
+	order   []string
+}
+
+// etagEntry is a cached response.
+type etagEntry struct {
+	etag   string
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newETagTransport(next http.RoundTripper) *etagTransport {
+	return &etagTransport{next: next, entries: map[string]*etagEntry{}}
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	// go-github asks for different media types from the same URL, so the
+	// Accept header is part of the key.
+	key := req.URL.String() + " " + req.Header.Get("Accept")
+	t.mu.Lock()
+	cached := t.entries[key]
+	t.mu.Unlock()
+	if cached != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		header := cached.header.Clone()
+		// Keep the rate limit headers up to date, as they are read from
+		// every response.
+		for name, values := range resp.Header {
+			if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Ratelimit-") {
+				header[name] = values
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", cached.status, http.StatusText(cached.status)),
+			StatusCode:    cached.status,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.store(key, &etagEntry{etag: etag, status: resp.StatusCode, header: resp.Header.Clone(), body: body})
+	return resp, nil
+}
+
+// store caches the entry, evicting the oldest entries if the cache is full.
+func (t *etagTransport) store(key string, entry *etagEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.entries[key]; !ok {
+		t.order = append(t.order, key)
+	}
+	t.entries[key] = entry
+	for len(t.order) > etagCacheSize {
+		delete(t.entries, t.order[0])
+		t.order = t.order[1:]
+	}
+}
@@ -0,0 +1,710 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// checksPollInterval is how long to wait between checking the status of
+// checks that are being waited on.
+const checksPollInterval = 30 * time.Second
+
+// errChecksTimedOut is returned by waitForChecks when the checks it is waiting
+// on don't finish in time.
+var errChecksTimedOut = errors.New("checks did not finish in time")
+
+// listCheckRuns retrieves every check run for the given ref, following
+// pagination until the last page has been read.
+func listCheckRuns(ctx context.Context, client *github.Client, owner, repoName, ref string, perPage int) ([]*github.CheckRun, error) {
+	return listCheckRunsFiltered(ctx, client, owner, repoName, ref, "latest", perPage)
+}
+
+// listCheckRunsFiltered retrieves the check runs for the given ref, only the
+// latest run of each check if filter is latest or every run of it if it is
+// all.
+func listCheckRunsFiltered(ctx context.Context, client *github.Client, owner, repoName, ref, filter string, perPage int) ([]*github.CheckRun, error) {
+	opts := &github.ListCheckRunsOptions{
+		Filter:      github.String(filter),
+		ListOptions: github.ListOptions{PerPage: perPage},
+	}
+	allCheckRuns := []*github.CheckRun{}
+	for {
+		checkRunResult, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repoName, ref, opts)
+		if err != nil {
+			return nil, err
+		}
+		allCheckRuns = append(allCheckRuns, checkRunResult.CheckRuns...)
+		if resp.NextPage == 0 {
+			return allCheckRuns, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// pullRequestChecks returns the check runs and commit statuses of the pull
+// request's head, using those fetched along with the pull request if there
+// are any.
+func pullRequestChecks(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, perPage int) ([]*github.CheckRun, []*github.RepoStatus, error) {
+	if prefetched := prefetchedFor(ctx, pullRequest); prefetched != nil && prefetched.checks {
+		return prefetched.checkRuns, prefetched.statuses, nil
+	}
+
+	// The head commit rather than the branch, which may have moved on since
+	// or, for forks, be a different branch of the same name.
+	checkRuns, err := listCheckRuns(ctx, client, owner, repoName, pullRequest.GetHead().GetSHA(), perPage)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"failed to get check run for pull request %d (commit %s): %w",
+			pullRequest.GetNumber(),
+			pullRequest.GetHead().GetSHA(),
+			err,
+		)
+	}
+	logDebug(
+		ctx,
+		pullRequestFields(pullRequest),
+		"Found %d check runs for pull request %d",
+		len(checkRuns),
+		pullRequest.GetNumber(),
+	)
+
+	combinedStatus, err := getCombinedStatus(ctx, client, owner, repoName, pullRequest.GetHead().GetSHA(), perPage)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"failed to get commit statuses for pull request %d (commit %s): %w",
+			pullRequest.GetNumber(),
+			pullRequest.GetHead().GetSHA(),
+			err,
+		)
+	}
+	return checkRuns, combinedStatus.Statuses, nil
+}
+
+// checkRunsPassed reports whether every check run has completed with one of
+// the passing conclusions, logging the state of each one.
+func checkRunsPassed(ctx context.Context, pullRequest *github.PullRequest, checkRuns []*github.CheckRun, passingConclusions []string) bool {
+	allChecksOk := true
+	for _, checkRun := range checkRuns {
+		status := checkRun.GetStatus()
+		if status == "completed" {
+			if isPassingConclusion(checkRun.GetConclusion(), passingConclusions) {
+				logDebug(
+					ctx,
+					pullRequestFields(pullRequest).with("check", checkRun.GetName()).with("state", checkRun.GetConclusion()),
+					"Check run %d for pull request %d successfully completed (conclusion %s).",
+					checkRun.GetID(),
+					pullRequest.GetNumber(),
+					checkRun.GetConclusion(),
+				)
+			} else {
+				logDebug(
+					ctx,
+					pullRequestFields(pullRequest).with("check", checkRun.GetName()).with("state", checkRun.GetConclusion()),
+					"Check run %d for pull request %d was not successful (conclusion %s). Not merging it.",
+					checkRun.GetID(),
+					pullRequest.GetNumber(),
+					checkRun.GetConclusion(),
+				)
+				allChecksOk = false
+			}
+		} else {
+			logDebug(
+				ctx,
+				pullRequestFields(pullRequest).with("check", checkRun.GetName()).with("state", status),
+				"Check run %d for pull request %d not yet completed (status %s). Not merging it.",
+				checkRun.GetID(),
+				pullRequest.GetNumber(),
+				status,
+			)
+			allChecksOk = false
+		}
+	}
+	return allChecksOk
+}
+
+// checkRunConclusions are the conclusions a completed check run can have.
+var checkRunConclusions = []string{
+	"success",
+	"failure",
+	"neutral",
+	"cancelled",
+	"skipped",
+	"timed_out",
+	"action_required",
+	"stale",
+}
+
+func isPassingConclusion(conclusion string, passingConclusions []string) bool {
+	if conclusion == "success" {
+		return true
+	}
+	for _, passingConclusion := range passingConclusions {
+		if conclusion == passingConclusion {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateConclusions checks that each of the conclusions is one a check run
+// can actually have.
+func ValidateConclusions(conclusions []string) error {
+	for _, conclusion := range conclusions {
+		known := false
+		for _, checkRunConclusion := range checkRunConclusions {
+			if conclusion == checkRunConclusion {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("conclusion must be one of %s. '%s' is not", strings.Join(checkRunConclusions, ", "), conclusion)
+		}
+	}
+	return nil
+}
+
+// getCombinedStatus retrieves the combined commit status of the given ref,
+// following pagination so that every status is included.
+func getCombinedStatus(ctx context.Context, client *github.Client, owner, repoName, ref string, perPage int) (*github.CombinedStatus, error) {
+	opts := &github.ListOptions{PerPage: perPage}
+	var combinedStatus *github.CombinedStatus
+	for {
+		page, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, repoName, ref, opts)
+		if err != nil {
+			return nil, err
+		}
+		if combinedStatus == nil {
+			combinedStatus = page
+		} else {
+			combinedStatus.Statuses = append(combinedStatus.Statuses, page.Statuses...)
+		}
+		if resp.NextPage == 0 {
+			return combinedStatus, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// commitStatusesPassed reports whether every commit status is successful.
+// Commits without any statuses pass, as not every repository uses the
+// Statuses API.
+func commitStatusesPassed(ctx context.Context, pullRequest *github.PullRequest, statuses []*github.RepoStatus) bool {
+	allStatusesOk := true
+	for _, status := range statuses {
+		if status.GetState() != "success" {
+			logDebug(
+				ctx,
+				pullRequestFields(pullRequest).with("check", status.GetContext()).with("state", status.GetState()),
+				"Commit status %s for pull request %d was not successful (state %s). Not merging it.",
+				status.GetContext(),
+				pullRequest.GetNumber(),
+				status.GetState(),
+			)
+			allStatusesOk = false
+		}
+	}
+	return allStatusesOk
+}
+
+// filterIgnoredChecks removes the check runs and commit statuses whose names
+// match any of the ignore patterns.
+func filterIgnoredChecks(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, ignorePatterns []string) ([]*github.CheckRun, []*github.RepoStatus) {
+	if len(ignorePatterns) == 0 {
+		return checkRuns, statuses
+	}
+
+	filteredCheckRuns := []*github.CheckRun{}
+	for _, checkRun := range checkRuns {
+		if !matchesAny(checkRun.GetName(), ignorePatterns) {
+			filteredCheckRuns = append(filteredCheckRuns, checkRun)
+		}
+	}
+	filteredStatuses := []*github.RepoStatus{}
+	for _, status := range statuses {
+		if !matchesAny(status.GetContext(), ignorePatterns) {
+			filteredStatuses = append(filteredStatuses, status)
+		}
+	}
+	return filteredCheckRuns, filteredStatuses
+}
+
+// requireChecksPassed reports whether each of the require patterns matches at
+// least one check run or commit status, and whether every match passed. This
+// is evaluated independently of the other checks so that required checks are
+// enforced even when only branch protection's required checks are considered.
+func requireChecksPassed(ctx context.Context, pullRequest *github.PullRequest, checkRuns []*github.CheckRun, statuses []*github.RepoStatus, requirePatterns []string, passingConclusions []string) bool {
+	allPassed := true
+	for _, pattern := range requirePatterns {
+		matchedCheckRuns := []*github.CheckRun{}
+		for _, checkRun := range checkRuns {
+			if matchesAny(checkRun.GetName(), []string{pattern}) {
+				matchedCheckRuns = append(matchedCheckRuns, checkRun)
+			}
+		}
+		matchedStatuses := []*github.RepoStatus{}
+		for _, status := range statuses {
+			if matchesAny(status.GetContext(), []string{pattern}) {
+				matchedStatuses = append(matchedStatuses, status)
+			}
+		}
+
+		if len(matchedCheckRuns) == 0 && len(matchedStatuses) == 0 {
+			logDebug(ctx, pullRequestFields(pullRequest).with("check", pattern).with("state", "missing"), "Required check %s for pull request %d has not been reported. Not merging it.", pattern, pullRequest.GetNumber())
+			allPassed = false
+			continue
+		}
+		checkRunsOk := checkRunsPassed(ctx, pullRequest, matchedCheckRuns, passingConclusions)
+		statusesOk := commitStatusesPassed(ctx, pullRequest, matchedStatuses)
+		if !checkRunsOk || !statusesOk {
+			allPassed = false
+		}
+	}
+	return allPassed
+}
+
+// missingChecks returns the patterns that don't match any of the check runs or
+// commit statuses, as those checks haven't been reported yet.
+func missingChecks(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, patterns []string) []string {
+	missing := []string{}
+	for _, pattern := range patterns {
+		reported := false
+		for _, checkRun := range checkRuns {
+			reported = reported || matchesAny(checkRun.GetName(), []string{pattern})
+		}
+		for _, status := range statuses {
+			reported = reported || matchesAny(status.GetContext(), []string{pattern})
+		}
+		if !reported {
+			missing = append(missing, pattern)
+		}
+	}
+	return missing
+}
+
+// matchesAny reports whether the name matches any of the glob patterns.
+// Patterns are validated up front so malformed ones are treated as not
+// matching.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePatterns checks that each of the glob patterns is well formed.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// CheckTimeout is how long to wait for the checks whose names match a glob
+// pattern before giving up on them.
+type CheckTimeout struct {
+	pattern string
+	timeout time.Duration
+}
+
+// ParseCheckTimeout parses a check timeout of the form <pattern>=<duration>,
+// such as codecov/*=10m.
+func ParseCheckTimeout(checkTimeout string) (CheckTimeout, error) {
+	i := strings.LastIndex(checkTimeout, "=")
+	if i <= 0 {
+		return CheckTimeout{}, fmt.Errorf("expected check timeout to be of the form <pattern>=<duration>. '%s' is not", checkTimeout)
+	}
+	pattern := checkTimeout[:i]
+	if err := ValidatePatterns([]string{pattern}); err != nil {
+		return CheckTimeout{}, err
+	}
+	timeout, err := time.ParseDuration(checkTimeout[i+1:])
+	if err != nil || timeout <= 0 {
+		return CheckTimeout{}, fmt.Errorf("expected the timeout of %s to be a positive duration", checkTimeout)
+	}
+	return CheckTimeout{pattern: pattern, timeout: timeout}, nil
+}
+
+func (c CheckTimeout) String() string {
+	return fmt.Sprintf("%s=%s", c.pattern, c.timeout)
+}
+
+// timedOutCheck returns the name of a check that has been pending for longer
+// than its timeout at now, if any. Check runs are timed from when they
+// started and commit statuses from when they were created, so a check that
+// was stuck before merger got to it isn't given a fresh timeout each run.
+func timedOutCheck(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, checkTimeouts []CheckTimeout, now time.Time) string {
+	for _, checkRun := range checkRuns {
+		if checkRun.GetStatus() != "completed" && checkTimedOut(checkRun.GetName(), checkRun.GetStartedAt().Time, checkTimeouts, now) {
+			return checkRun.GetName()
+		}
+	}
+	for _, status := range statuses {
+		if status.GetState() == "pending" && checkTimedOut(status.GetContext(), status.GetCreatedAt(), checkTimeouts, now) {
+			return status.GetContext()
+		}
+	}
+	return ""
+}
+
+// checkTimedOut reports whether the check with the given name, which started
+// at started, has been pending for longer than its timeout at now. Checks
+// that haven't started yet can't have timed out.
+func checkTimedOut(name string, started time.Time, checkTimeouts []CheckTimeout, now time.Time) bool {
+	if started.IsZero() {
+		return false
+	}
+	for _, checkTimeout := range checkTimeouts {
+		if now.Sub(started) > checkTimeout.timeout && matchesAny(name, []string{checkTimeout.pattern}) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredContexts retrieves the names of the status checks that the branch
+// protection of the given branch requires.
+func requiredContexts(ctx context.Context, client *github.Client, owner, repoName, branch string) (map[string]bool, error) {
+	requiredChecks, resp, err := client.Repositories.GetRequiredStatusChecks(ctx, owner, repoName, branch)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("branch %s does not require any status checks", branch)
+		}
+		return nil, err
+	}
+
+	required := map[string]bool{}
+	for _, name := range requiredChecks.Contexts {
+		required[name] = true
+	}
+	return required, nil
+}
+
+// filterRequiredChecks keeps the check runs and commit statuses that are
+// required, or that match any of the require patterns, leaving out those
+// that are only informational.
+func filterRequiredChecks(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, required map[string]bool, requirePatterns []string) ([]*github.CheckRun, []*github.RepoStatus) {
+	requiredCheckRuns := []*github.CheckRun{}
+	for _, checkRun := range checkRuns {
+		if required[checkRun.GetName()] || matchesAny(checkRun.GetName(), requirePatterns) {
+			requiredCheckRuns = append(requiredCheckRuns, checkRun)
+		}
+	}
+	requiredStatuses := []*github.RepoStatus{}
+	for _, status := range statuses {
+		if required[status.GetContext()] || matchesAny(status.GetContext(), requirePatterns) {
+			requiredStatuses = append(requiredStatuses, status)
+		}
+	}
+	return requiredCheckRuns, requiredStatuses
+}
+
+// requiredReported reports whether every required check has been reported as
+// either a check run or a commit status.
+func requiredReported(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, required map[string]bool) bool {
+	reported := map[string]bool{}
+	for _, checkRun := range checkRuns {
+		reported[checkRun.GetName()] = true
+	}
+	for _, status := range statuses {
+		reported[status.GetContext()] = true
+	}
+	for name := range required {
+		if !reported[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredChecksPassed reports whether every required check has been reported
+// as either a check run or a commit status and was successful. Checks that
+// aren't required are ignored.
+func requiredChecksPassed(ctx context.Context, pullRequest *github.PullRequest, checkRuns []*github.CheckRun, statuses []*github.RepoStatus, required map[string]bool, passingConclusions []string) bool {
+	reported := map[string]bool{}
+
+	requiredCheckRuns := []*github.CheckRun{}
+	for _, checkRun := range checkRuns {
+		if required[checkRun.GetName()] {
+			requiredCheckRuns = append(requiredCheckRuns, checkRun)
+			reported[checkRun.GetName()] = true
+		}
+	}
+	allChecksOk := checkRunsPassed(ctx, pullRequest, requiredCheckRuns, passingConclusions)
+
+	for _, status := range statuses {
+		if !required[status.GetContext()] {
+			continue
+		}
+		reported[status.GetContext()] = true
+		if status.GetState() != "success" {
+			logDebug(
+				ctx,
+				pullRequestFields(pullRequest).with("check", status.GetContext()).with("state", status.GetState()),
+				"Required commit status %s for pull request %d was not successful (state %s). Not merging it.",
+				status.GetContext(),
+				pullRequest.GetNumber(),
+				status.GetState(),
+			)
+			allChecksOk = false
+		}
+	}
+
+	for name := range required {
+		if !reported[name] {
+			logDebug(ctx, pullRequestFields(pullRequest).with("check", name).with("state", "missing"), "Required check %s for pull request %d has not been reported. Not merging it.", name, pullRequest.GetNumber())
+			allChecksOk = false
+		}
+	}
+	return allChecksOk
+}
+
+// waitForChecks waits until every check run and commit status on the given
+// commit has finished, reporting whether they all passed. Checks ignored with
+// -ignore-check are left out and, with -required-only, so are those base's
+// protection doesn't require. A check still pending after its -check-timeout
+// counts as failed, so one that never finishes doesn't hold everything else
+// up until timeout.
+func waitForChecks(ctx context.Context, client *github.Client, owner, repoName, base, head string, timeout time.Duration, opts *Options) (bool, error) {
+	var required map[string]bool
+	if opts.RequiredOnly {
+		var err error
+		required, err = requiredContexts(ctx, client, owner, repoName, base)
+		if err != nil {
+			return false, fmt.Errorf("failed to get required checks for %s: %w", base, err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		checkRuns, err := listCheckRuns(ctx, client, owner, repoName, head, opts.PerPage)
+		if err != nil {
+			return false, fmt.Errorf("failed to get check runs for %s: %w", head, err)
+		}
+		combinedStatus, err := getCombinedStatus(ctx, client, owner, repoName, head, opts.PerPage)
+		if err != nil {
+			return false, fmt.Errorf("failed to get commit statuses for %s: %w", head, err)
+		}
+		checkRuns, statuses := filterIgnoredChecks(checkRuns, combinedStatus.Statuses, opts.IgnoreChecks)
+		if required != nil {
+			checkRuns, statuses = filterRequiredChecks(checkRuns, statuses, required, opts.RequireChecks)
+		}
+
+		state := checksState(checkRuns, statuses, opts.PassingConclusions)
+		if state == "success" && (!requiredReported(checkRuns, statuses, required) || len(missingChecks(checkRuns, statuses, opts.ExpectChecks)) > 0) {
+			state = "pending"
+		}
+		if state != "pending" {
+			return state == "success", nil
+		}
+		if name := timedOutCheck(checkRuns, statuses, opts.CheckTimeouts, time.Now()); name != "" {
+			logWarn(ctx, logFields{"repo": owner + "/" + repoName, "check": name}, "Gave up waiting for check %s on %s as it took longer than its -check-timeout", name, head)
+			return false, nil
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("%w: checks for %s did not finish within %s", errChecksTimedOut, head, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(checksPollInterval):
+		}
+	}
+}
+
+// checksPending reports whether every one of the blocking checks is still
+// queued or running, so they may yet pass.
+func checksPending(blocking []BlockingCheck) bool {
+	for _, check := range blocking {
+		if !isPendingState(check.State) {
+			return false
+		}
+	}
+	return len(blocking) > 0
+}
+
+// isPendingState reports whether the state of a check run or commit status
+// means it hasn't finished.
+func isPendingState(state string) bool {
+	switch state {
+	case "queued", "in_progress", "waiting", "requested", "pending":
+		return true
+	default:
+		return false
+	}
+}
+
+// checksState summarises the checks of a commit as success, failure or
+// pending. Checks are pending until at least one has been reported, as CI
+// may not have picked up the commit yet.
+func checksState(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, passingConclusions []string) string {
+	if len(checkRuns) == 0 && len(statuses) == 0 {
+		return "pending"
+	}
+	pending := false
+	for _, checkRun := range checkRuns {
+		if checkRun.GetStatus() != "completed" {
+			pending = true
+		} else if !isPassingConclusion(checkRun.GetConclusion(), passingConclusions) {
+			return "failure"
+		}
+	}
+	for _, status := range statuses {
+		switch status.GetState() {
+		case "success":
+		case "pending":
+			pending = true
+		default:
+			return "failure"
+		}
+	}
+	if pending {
+		return "pending"
+	}
+	return "success"
+}
+
+// enoughChecks reports whether at least minChecks check runs and commit
+// statuses have finished, and why not if they haven't. Checks that are still
+// running don't count, as they could yet be skipped.
+func enoughChecks(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, minChecks int) (bool, string) {
+	finished := 0
+	for _, checkRun := range checkRuns {
+		if checkRun.GetStatus() == "completed" {
+			finished++
+		}
+	}
+	for _, status := range statuses {
+		if status.GetState() != "pending" {
+			finished++
+		}
+	}
+	if finished < minChecks {
+		return false, fmt.Sprintf("it has %d/%d finished checks", finished, minChecks)
+	}
+	return true, ""
+}
+
+// checksAged reports whether the checks have all been finished for at least
+// minAge, and when they will have been if they haven't. Only the required
+// checks are considered if required isn't nil.
+func checksAged(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, required map[string]bool, minAge time.Duration) (bool, string) {
+	var finished time.Time
+	for _, checkRun := range checkRuns {
+		if completed := checkRun.GetCompletedAt().Time; (required == nil || required[checkRun.GetName()]) && completed.After(finished) {
+			finished = completed
+		}
+	}
+	for _, status := range statuses {
+		if updated := status.GetUpdatedAt(); (required == nil || required[status.GetContext()]) && updated.After(finished) {
+			finished = updated
+		}
+	}
+	if aged := finished.Add(minAge); time.Now().Before(aged) {
+		return false, fmt.Sprintf(
+			"its checks finished less than %s ago. It can be merged from %s",
+			minAge,
+			aged.Format("Mon 2 Jan 15:04 MST"),
+		)
+	}
+	return true, ""
+}
+
+// checksPassed reports whether the pull request's checks have passed, as
+// decided by opts. If they haven't, the status says why and which checks are
+// blocking it. Why is left to the caller to log, so it is only recorded once.
+func checksPassed(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (CheckStatus, error) {
+	checkRuns, allStatuses, err := pullRequestChecks(ctx, client, owner, repoName, pullRequest, opts.PerPage)
+	if err != nil {
+		return CheckStatus{}, err
+	}
+	checkRuns, statuses := filterIgnoredChecks(checkRuns, allStatuses, opts.IgnoreChecks)
+
+	var allChecksOk bool
+	var required map[string]bool
+	if opts.RequiredOnly {
+		required, err = requiredContexts(ctx, client, owner, repoName, pullRequest.GetBase().GetRef())
+		if err != nil {
+			return CheckStatus{}, fmt.Errorf(
+				"failed to get required checks for pull request %d (base %s): %w",
+				pullRequest.GetNumber(),
+				pullRequest.GetBase().GetRef(),
+				err,
+			)
+		}
+		allChecksOk = requiredChecksPassed(ctx, pullRequest, checkRuns, statuses, required, opts.PassingConclusions)
+	} else {
+		checkRunsOk := checkRunsPassed(ctx, pullRequest, checkRuns, opts.PassingConclusions)
+		statusesOk := commitStatusesPassed(ctx, pullRequest, statuses)
+		allChecksOk = checkRunsOk && statusesOk
+	}
+	if !requireChecksPassed(ctx, pullRequest, checkRuns, statuses, opts.RequireChecks, opts.PassingConclusions) {
+		allChecksOk = false
+	}
+
+	// The first reason the checks haven't passed is the one given.
+	status := CheckStatus{Passed: true}
+	var timedOut string
+	if !allChecksOk {
+		status = CheckStatus{Cause: "checks", Reason: "its checks haven't all passed"}
+		timeoutCheckRuns, timeoutStatuses := checkRuns, statuses
+		if required != nil {
+			timeoutCheckRuns, timeoutStatuses = filterRequiredChecks(checkRuns, statuses, required, opts.RequireChecks)
+		}
+		if timedOut = timedOutCheck(timeoutCheckRuns, timeoutStatuses, opts.CheckTimeouts, time.Now()); timedOut != "" {
+			status = CheckStatus{Cause: "check timeout", Reason: fmt.Sprintf("its check %s has been pending for longer than its -check-timeout", timedOut)}
+		}
+	}
+	missing := missingChecks(checkRuns, statuses, opts.ExpectChecks)
+	for _, name := range missing {
+		logDebug(ctx, pullRequestFields(pullRequest).with("check", name).with("state", "missing"), "Expected check %s for pull request %d has not been reported. Not merging it.", name, pullRequest.GetNumber())
+	}
+	if status.Passed && len(missing) > 0 {
+		status = CheckStatus{
+			Cause:  "missing check",
+			Reason: fmt.Sprintf("its expected checks %s haven't been reported", strings.Join(missing, ", ")),
+		}
+	}
+	if status.Passed && opts.Renovate && isRenovatePullRequest(pullRequest) {
+		if passed, reason := renovateStabilityPassed(allStatuses); !passed {
+			status = CheckStatus{Cause: "renovate stability", Reason: reason}
+		}
+	}
+	if status.Passed && opts.MinChecks > 0 {
+		if enough, reason := enoughChecks(checkRuns, statuses, opts.MinChecks); !enough {
+			status = CheckStatus{Cause: "too few checks", Reason: reason}
+		}
+	}
+	if status.Passed && opts.MinCheckAge > 0 {
+		if aged, reason := checksAged(checkRuns, statuses, required, opts.MinCheckAge); !aged {
+			status = CheckStatus{Cause: "check age", Reason: reason}
+		}
+	}
+	if !status.Passed {
+		status.Blocking = blockingChecks(checkRuns, statuses, required, opts.PassingConclusions)
+		// A check that has timed out has failed rather than being waited on.
+		for i := range status.Blocking {
+			if status.Blocking[i].Name == timedOut {
+				status.Blocking[i].State = "timed_out"
+			}
+		}
+		for _, name := range missing {
+			status.Blocking = append(status.Blocking, BlockingCheck{Name: name, State: "missing"})
+		}
+		return status, nil
+	}
+	logDebug(ctx, pullRequestFields(pullRequest).with("checks", "passed"), "All checks for pull request %d passed", pullRequest.GetNumber())
+	return status, nil
+}
@@ -0,0 +1,225 @@
+package merger
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestTimedOutCheck(t *testing.T) {
+	var checkTimeouts []CheckTimeout
+	for _, source := range []string{"codecov/*=10m", "security-scan=30m"} {
+		checkTimeout, err := ParseCheckTimeout(source)
+		if err != nil {
+			t.Fatalf("ParseCheckTimeout(%s) failed: %v", source, err)
+		}
+		checkTimeouts = append(checkTimeouts, checkTimeout)
+	}
+	now := time.Now()
+	started := func(ago time.Duration) *github.Timestamp {
+		return &github.Timestamp{Time: now.Add(-ago)}
+	}
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("build"), Status: github.String("in_progress"), StartedAt: started(time.Hour)},
+		{Name: github.String("security-scan"), Status: github.String("queued"), StartedAt: started(20 * time.Minute)},
+	}
+	statuses := []*github.RepoStatus{
+		{Context: github.String("codecov/patch"), State: github.String("pending"), CreatedAt: &started(5 * time.Minute).Time},
+		{Context: github.String("codecov/project"), State: github.String("pending")},
+	}
+	tests := []struct {
+		later time.Duration
+		want  string
+	}{
+		{0, ""},
+		{10 * time.Minute, "codecov/patch"},
+		{15 * time.Minute, "security-scan"},
+	}
+	for _, test := range tests {
+		if got := timedOutCheck(checkRuns, statuses, checkTimeouts, now.Add(test.later)); got != test.want {
+			t.Errorf("timedOutCheck %s later = %q, want %q", test.later, got, test.want)
+		}
+	}
+}
+
+func TestParseCheckTimeoutErrors(t *testing.T) {
+	for _, source := range []string{"", "codecov", "=10m", "codecov=soon", "codecov=-1m", "[=10m"} {
+		if _, err := ParseCheckTimeout(source); err == nil {
+			t.Errorf("ParseCheckTimeout(%q) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestWaitForChecksRequiredOnly(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/nick96/merger/branches/main/protection/required_status_checks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.RequiredStatusChecks{Contexts: []string{"build"}})
+	})
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{
+			{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String("success")},
+			{Name: github.String("lint"), Status: github.String("completed"), Conclusion: github.String("failure")},
+		}})
+	})
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.CombinedStatus{Statuses: []*github.RepoStatus{
+			{Context: github.String("codecov/patch"), State: github.String("failure")},
+		}})
+	})
+	client := newTestClient(t, mux)
+
+	passed, err := waitForChecks(context.Background(), client, "nick96", "merger", "main", "abc", time.Minute, &Options{Policy: Policy{RequiredOnly: true}})
+	if err != nil {
+		t.Fatalf("waitForChecks failed: %v", err)
+	}
+	if !passed {
+		t.Error("waitForChecks with -required-only failed on checks that aren't required")
+	}
+
+	passed, err = waitForChecks(context.Background(), client, "nick96", "merger", "main", "abc", time.Minute, &Options{})
+	if err != nil {
+		t.Fatalf("waitForChecks failed: %v", err)
+	}
+	if passed {
+		t.Error("waitForChecks passed with failing checks")
+	}
+}
+
+func TestEnoughChecks(t *testing.T) {
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String("success")},
+		{Name: github.String("test"), Status: github.String("in_progress")},
+	}
+	statuses := []*github.RepoStatus{
+		{Context: github.String("codecov/patch"), State: github.String("success")},
+		{Context: github.String("deploy"), State: github.String("pending")},
+	}
+	tests := []struct {
+		minChecks int
+		want      bool
+	}{
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+	for _, test := range tests {
+		got, reason := enoughChecks(checkRuns, statuses, test.minChecks)
+		if got != test.want {
+			t.Errorf("enoughChecks with %d = %v (%s), want %v", test.minChecks, got, reason, test.want)
+		}
+		if !got && reason != "it has 2/3 finished checks" {
+			t.Errorf("enoughChecks with %d gave reason %q", test.minChecks, reason)
+		}
+	}
+}
+
+func TestChecksAged(t *testing.T) {
+	now := time.Now()
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("build"), CompletedAt: &github.Timestamp{Time: now.Add(-2 * time.Hour)}},
+		{Name: github.String("lint"), CompletedAt: &github.Timestamp{Time: now.Add(-10 * time.Minute)}},
+	}
+	updatedAt := now.Add(-30 * time.Minute)
+	statuses := []*github.RepoStatus{
+		{Context: github.String("codecov/patch"), UpdatedAt: &updatedAt},
+	}
+	tests := []struct {
+		required map[string]bool
+		minAge   time.Duration
+		want     bool
+	}{
+		{nil, 5 * time.Minute, true},
+		{nil, 20 * time.Minute, false},
+		{map[string]bool{"build": true}, 20 * time.Minute, true},
+		{map[string]bool{"build": true, "codecov/patch": true}, time.Hour, false},
+	}
+	for _, test := range tests {
+		got, reason := checksAged(checkRuns, statuses, test.required, test.minAge)
+		if got != test.want {
+			t.Errorf("checksAged(%v, %s) = %v, want %v", test.required, test.minAge, got, test.want)
+		}
+		if got != (reason == "") {
+			t.Errorf("checksAged(%v, %s) gave reason %q", test.required, test.minAge, reason)
+		}
+	}
+}
+
+func TestChecksPassed(t *testing.T) {
+	completedAt := &github.Timestamp{Time: time.Now().Add(-time.Minute)}
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String("success"), CompletedAt: completedAt},
+		{Name: github.String("lint"), Status: github.String("completed"), Conclusion: github.String("failure"), CompletedAt: completedAt},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.ListCheckRunsResults{CheckRuns: checkRuns})
+	})
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.CombinedStatus{})
+	})
+	client := newTestClient(t, mux)
+	pullRequest := fakePullRequest(1, "Add a feature")
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		wantCause string
+	}{
+		{"failing check", Policy{}, "checks"},
+		{"ignored check", Policy{IgnoreChecks: []string{"lint"}}, ""},
+		{"too few checks", Policy{IgnoreChecks: []string{"lint"}, MinChecks: 2}, "too few checks"},
+		{"failing check and too few checks", Policy{MinChecks: 3}, "checks"},
+		{"check age", Policy{IgnoreChecks: []string{"lint"}, MinCheckAge: time.Hour}, "check age"},
+		{"expected check reported", Policy{IgnoreChecks: []string{"lint"}, ExpectChecks: []string{"build"}}, ""},
+		{"expected check missing", Policy{IgnoreChecks: []string{"lint"}, ExpectChecks: []string{"deploy*"}}, "missing check"},
+	}
+	for _, test := range tests {
+		status, err := checksPassed(context.Background(), client, "nick96", "merger", pullRequest, &Options{Policy: test.policy})
+		if err != nil {
+			t.Fatalf("%s: checksPassed failed: %v", test.name, err)
+		}
+		if status.Passed != (test.wantCause == "") || status.Cause != test.wantCause {
+			t.Errorf("%s: checksPassed = %+v, want cause %q", test.name, status, test.wantCause)
+		}
+		if !status.Passed && status.Reason == "" {
+			t.Errorf("%s: checksPassed didn't say why the checks haven't passed", test.name)
+		}
+	}
+}
+
+func TestChecksPassedCheckTimeout(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{
+			{Name: github.String("build"), Status: github.String("in_progress"), StartedAt: &github.Timestamp{Time: time.Now().Add(-time.Hour)}},
+		}})
+	})
+	mux.HandleFunc("/repos/nick96/merger/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, &github.CombinedStatus{})
+	})
+	client := newTestClient(t, mux)
+	pullRequest := fakePullRequest(1, "Add a feature")
+
+	status, err := checksPassed(context.Background(), client, "nick96", "merger", pullRequest, &Options{})
+	if err != nil {
+		t.Fatalf("checksPassed failed: %v", err)
+	}
+	if status.Cause != "checks" || !checksPending(status.Blocking) {
+		t.Errorf("checksPassed without a timeout = %+v, want the check to be pending", status)
+	}
+
+	checkTimeout, err := ParseCheckTimeout("build=30m")
+	if err != nil {
+		t.Fatalf("ParseCheckTimeout failed: %v", err)
+	}
+	status, err = checksPassed(context.Background(), client, "nick96", "merger", pullRequest, &Options{CheckTimeouts: []CheckTimeout{checkTimeout}})
+	if err != nil {
+		t.Fatalf("checksPassed failed: %v", err)
+	}
+	if status.Cause != "check timeout" || checksPending(status.Blocking) {
+		t.Errorf("checksPassed with a timeout = %+v, want the check to have timed out", status)
+	}
+}
@@ -0,0 +1,74 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of making a request once too many
+// requests in a row have failed.
+var ErrCircuitOpen = errors.New("GitHub API requests keep failing")
+
+// circuitBreakerCooldown is how long requests are failed for once the circuit
+// breaker trips, before requests are let through again to see if GitHub has
+// recovered. A single failure then trips it again.
+const circuitBreakerCooldown = time.Minute
+
+// circuitBreakerTransport fails requests straight away with ErrCircuitOpen
+// once threshold requests in a row have failed with a network error, a 5xx
+// response or a 401 response, such as when GitHub is down or the token has
+// been revoked. That way a run stops early rather than logging the same
+// failure for every pull request.
+type circuitBreakerTransport struct {
+	next      http.RoundTripper
+	threshold int
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	// Requests cancelled by merger itself say nothing about GitHub.
+	if req.Context().Err() == nil {
+		t.record(req.Context(), err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusUnauthorized)
+	}
+	return resp, err
+}
+
+// allow returns ErrCircuitOpen if the breaker has tripped and hasn't cooled
+// down since.
+func (t *circuitBreakerTransport) allow() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failures < t.threshold || time.Since(t.openedAt) >= circuitBreakerCooldown {
+		return nil
+	}
+	return fmt.Errorf("%w: %d requests in a row failed", ErrCircuitOpen, t.failures)
+}
+
+// record counts a failed request, tripping the breaker once there have been
+// threshold in a row, or resets the count after a successful one.
+func (t *circuitBreakerTransport) record(ctx context.Context, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !failed {
+		t.failures = 0
+		return
+	}
+	t.failures++
+	if t.failures >= t.threshold {
+		if t.failures == t.threshold {
+			logError(ctx, nil, "%d GitHub API requests in a row failed, failing the rest for %s", t.failures, circuitBreakerCooldown)
+		}
+		t.openedAt = time.Now()
+	}
+}
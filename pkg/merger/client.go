@@ -0,0 +1,76 @@
+package merger
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/oauth2"
+)
+
+// ClientOptions controls how the GitHub client made by NewClient talks to
+// GitHub.
+type ClientOptions struct {
+	// APIURL is the base URL of the GitHub API, or empty for github.com.
+	APIURL string
+	// Cache makes conditional requests for responses that have been fetched
+	// before, which only helps clients that make the same requests again.
+	Cache bool
+	// Retries is how many times to retry requests that fail with a server
+	// error, waiting RetryBackoff before the first retry and twice as long
+	// before each one after it.
+	Retries      int
+	RetryBackoff time.Duration
+	// CircuitBreakerThreshold is how many requests in a row may fail before
+	// requests fail straight away with ErrCircuitOpen. Zero disables the
+	// circuit breaker.
+	CircuitBreakerThreshold int
+	// RateLimitThreshold is the number of remaining requests below which
+	// requests fail, or wait for the rate limit to reset if
+	// PauseOnRateLimit is set. Zero disables the check.
+	RateLimitThreshold int
+	PauseOnRateLimit   bool
+}
+
+// NewClient creates a GitHub client authenticated with the token source. Its
+// requests are recorded in the metrics and traces of the Merger making them,
+// if it has any.
+func NewClient(ctx context.Context, tokenSource oauth2.TokenSource, clientOpts ClientOptions) (*github.Client, error) {
+	tokenClient := oauth2.NewClient(ctx, tokenSource)
+	if clientOpts.Cache {
+		tokenClient.Transport = newETagTransport(tokenClient.Transport)
+	}
+	tokenClient.Transport = withRetries(tokenClient.Transport, clientOpts)
+	tokenClient.Transport = &secondaryRateLimitTransport{next: tokenClient.Transport}
+	if clientOpts.RateLimitThreshold > 0 {
+		tokenClient.Transport = newRateLimitTransport(tokenClient.Transport, clientOpts.RateLimitThreshold, clientOpts.PauseOnRateLimit)
+	}
+	tokenClient.Transport = withInstrumentation(tokenClient.Transport)
+	return newClient(tokenClient, clientOpts.APIURL)
+}
+
+// NewHTTPClient creates an HTTP client for the API of a forge other than
+// GitHub, retrying requests and breaking the circuit as clientOpts say. The
+// options that only apply to GitHub are ignored.
+func NewHTTPClient(clientOpts ClientOptions) *http.Client {
+	return &http.Client{Transport: withInstrumentation(withRetries(http.DefaultTransport, clientOpts))}
+}
+
+// withRetries wraps the transport to retry failed requests and to stop making
+// them once too many in a row have failed.
+func withRetries(next http.RoundTripper, clientOpts ClientOptions) http.RoundTripper {
+	if clientOpts.Retries > 0 {
+		next = &retryTransport{next: next, retries: clientOpts.Retries, backoff: clientOpts.RetryBackoff}
+	}
+	if clientOpts.CircuitBreakerThreshold > 0 {
+		next = &circuitBreakerTransport{next: next, threshold: clientOpts.CircuitBreakerThreshold}
+	}
+	return next
+}
+
+// withInstrumentation wraps the transport to record metrics and traces of each
+// request in those of its context.
+func withInstrumentation(next http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{next: &metricsTransport{next: next}}
+}
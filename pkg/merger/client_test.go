@@ -0,0 +1,32 @@
+package merger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// newTestClient returns a client for a fake GitHub API served by handler.
+func newTestClient(t *testing.T, handler http.Handler) *github.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("failed to parse the fake API's URL: %v", err)
+	}
+	client.BaseURL = baseURL
+	return client
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// coAuthorTrailerPattern matches a Co-authored-by trailer in a commit message.
+var coAuthorTrailerPattern = regexp.MustCompile(`(?im)^co-authored-by:\s*(.+?)\s*$`)
+
+// listPullRequestCommits retrieves every commit in the pull request.
+func listPullRequestCommits(ctx context.Context, client *github.Client, owner, repoName string, number, perPage int) ([]*github.RepositoryCommit, error) {
+	opts := &github.ListOptions{PerPage: perPage}
+	allCommits := []*github.RepositoryCommit{}
+	for {
+		commits, resp, err := client.PullRequests.ListCommits(ctx, owner, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		allCommits = append(allCommits, commits...)
+		if resp.NextPage == 0 {
+			return allCommits, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// coAuthorTrailers returns the Co-authored-by trailers crediting everyone who
+// contributed to the commits besides the pull request's author: the authors
+// of the commits and anyone they credited as co-authors themselves. GitHub
+// only adds these to squashed commits when it writes the message itself.
+func coAuthorTrailers(commits []*github.RepositoryCommit, author string) []string {
+	seen := map[string]bool{}
+	trailers := []string{}
+	add := func(coAuthor string) {
+		key := strings.ToLower(coAuthor)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		trailers = append(trailers, "Co-authored-by: "+coAuthor)
+	}
+	for _, commit := range commits {
+		commitAuthor := commit.GetCommit().GetAuthor()
+		if !strings.EqualFold(commit.GetAuthor().GetLogin(), author) && commitAuthor.GetEmail() != "" {
+			add(fmt.Sprintf("%s <%s>", commitAuthor.GetName(), commitAuthor.GetEmail()))
+		}
+		for _, match := range coAuthorTrailerPattern.FindAllStringSubmatch(commit.GetCommit().GetMessage(), -1) {
+			add(match[1])
+		}
+	}
+	return trailers
+}
+
+// withTrailers appends the trailers the message doesn't already have to it.
+func withTrailers(message string, trailers []string) string {
+	missing := []string{}
+	for _, trailer := range trailers {
+		if !strings.Contains(strings.ToLower(message), strings.ToLower(trailer)) {
+			missing = append(missing, trailer)
+		}
+	}
+	if len(missing) == 0 {
+		return message
+	}
+	if message == "" {
+		return strings.Join(missing, "\n")
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + strings.Join(missing, "\n")
+}
@@ -0,0 +1,54 @@
+package merger
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestCoAuthorTrailers(t *testing.T) {
+	commit := func(login, name, email, message string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			Author: &github.User{Login: github.String(login)},
+			Commit: &github.Commit{
+				Author:  &github.CommitAuthor{Name: github.String(name), Email: github.String(email)},
+				Message: github.String(message),
+			},
+		}
+	}
+	commits := []*github.RepositoryCommit{
+		commit("nick96", "Nick", "nick@example.com", "Add -pr"),
+		commit("octocat", "Octo Cat", "octo@example.com", "Fix typo\n\nCo-authored-by: Mona <mona@example.com>"),
+		commit("octocat", "Octo Cat", "octo@example.com", "Fix another typo\n\nco-authored-by: mona <MONA@example.com>"),
+	}
+
+	trailers := coAuthorTrailers(commits, "nick96")
+	want := []string{"Co-authored-by: Octo Cat <octo@example.com>", "Co-authored-by: Mona <mona@example.com>"}
+	if len(trailers) != len(want) {
+		t.Fatalf("coAuthorTrailers() = %v, want %v", trailers, want)
+	}
+	for i := range want {
+		if trailers[i] != want[i] {
+			t.Errorf("coAuthorTrailers()[%d] = %s, want %s", i, trailers[i], want[i])
+		}
+	}
+}
+
+func TestWithTrailers(t *testing.T) {
+	tests := []struct {
+		message  string
+		trailers []string
+		want     string
+	}{
+		{"Add -pr", nil, "Add -pr"},
+		{"Add -pr\n", []string{"Co-authored-by: Mona <mona@example.com>"}, "Add -pr\n\nCo-authored-by: Mona <mona@example.com>"},
+		{"", []string{"Co-authored-by: Mona <mona@example.com>"}, "Co-authored-by: Mona <mona@example.com>"},
+		{"Add -pr\n\nCo-authored-by: Mona <mona@example.com>", []string{"Co-authored-by: Mona <mona@example.com>"}, "Add -pr\n\nCo-authored-by: Mona <mona@example.com>"},
+	}
+
+	for _, test := range tests {
+		if got := withTrailers(test.message, test.trailers); got != test.want {
+			t.Errorf("withTrailers(%q, %v) = %q, want %q", test.message, test.trailers, got, test.want)
+		}
+	}
+}
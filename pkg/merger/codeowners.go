@@ -0,0 +1,244 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// codeownersPaths are the locations GitHub looks for a CODEOWNERS file in, in
+// order of precedence.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is a single line of a CODEOWNERS file.
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// loadCodeowners fetches and parses the CODEOWNERS file at the given ref.
+func loadCodeowners(ctx context.Context, client *github.Client, owner, repoName, ref string) ([]codeownersRule, error) {
+	for _, path := range codeownersPaths {
+		fileContent, _, resp, err := client.Repositories.GetContents(
+			ctx,
+			owner,
+			repoName,
+			path,
+			&github.RepositoryContentGetOptions{Ref: ref},
+		)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, fmt.Errorf("failed to retrieve %s: %w", path, err)
+		}
+		if fileContent == nil {
+			continue
+		}
+
+		content, err := fileContent.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		rules, err := parseCodeowners(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return rules, nil
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file found on %s", ref)
+}
+
+func parseCodeowners(content string) ([]codeownersRule, error) {
+	rules := []codeownersRule{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		pattern, err := codeownersPatternToRegexp(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", fields[0], err)
+		}
+		rules = append(rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return rules, nil
+}
+
+// codeownersPatternToRegexp converts a CODEOWNERS pattern, which follows the
+// same rules as .gitignore, to a regular expression matching file paths.
+func codeownersPatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	// Patterns starting with or containing a slash are relative to the root
+	// of the repository, otherwise they match at any depth.
+	directory := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	// A pattern naming a directory owns everything beneath it. A trailing
+	// wildcard only matches the files directly inside the directory.
+	switch {
+	case directory:
+		b.WriteString("/.*$")
+	case strings.HasSuffix(pattern, "*"):
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// ownersFor returns the owners of the path. As in GitHub, the last matching
+// rule takes precedence.
+func ownersFor(rules []codeownersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// listChangedFiles retrieves the paths of every file the pull request touches.
+func listChangedFiles(ctx context.Context, client *github.Client, owner, repoName string, number, perPage int) ([]string, error) {
+	opts := &github.ListOptions{PerPage: perPage}
+	paths := []string{}
+	for {
+		files, resp, err := client.PullRequests.ListFiles(ctx, owner, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			paths = append(paths, file.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return paths, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// codeownersApproved reports whether every file touched by the pull request
+// that has code owners has been approved by at least one of them. Owners are
+// taken from the CODEOWNERS file on the pull request's base branch.
+func codeownersApproved(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, approvers []string, perPage int) (bool, error) {
+	rules, err := loadCodeowners(ctx, client, owner, repoName, pullRequest.GetBase().GetRef())
+	if err != nil {
+		return false, err
+	}
+	paths, err := listChangedFiles(ctx, client, owner, repoName, pullRequest.GetNumber(), perPage)
+	if err != nil {
+		return false, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	matcher := &ownerMatcher{ctx: ctx, client: client, memberships: map[string]bool{}}
+	allApproved := true
+	for _, path := range paths {
+		owners := ownersFor(rules, path)
+		if len(owners) == 0 {
+			continue
+		}
+		approved, err := matcher.anyApproved(owners, approvers)
+		if err != nil {
+			return false, err
+		}
+		if !approved {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "code owners"),
+				"%s in pull request %d has not been approved by any of its code owners (%s). Not merging it.",
+				path,
+				pullRequest.GetNumber(),
+				strings.Join(owners, ", "),
+			)
+			allApproved = false
+		}
+	}
+	return allApproved, nil
+}
+
+// ownerMatcher matches approvers against code owners, caching team
+// memberships so each is only looked up once per pull request.
+type ownerMatcher struct {
+	ctx         context.Context
+	client      *github.Client
+	memberships map[string]bool
+}
+
+func (m *ownerMatcher) anyApproved(owners, approvers []string) (bool, error) {
+	for _, codeowner := range owners {
+		// Owners given by email can't be mapped to a GitHub user.
+		if !strings.HasPrefix(codeowner, "@") {
+			continue
+		}
+		codeowner = strings.TrimPrefix(codeowner, "@")
+		for _, approver := range approvers {
+			if !strings.Contains(codeowner, "/") {
+				if strings.EqualFold(codeowner, approver) {
+					return true, nil
+				}
+				continue
+			}
+
+			member, err := m.isTeamMember(codeowner, approver)
+			if err != nil {
+				return false, err
+			}
+			if member {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *ownerMatcher) isTeamMember(team, user string) (bool, error) {
+	key := team + " " + user
+	if member, ok := m.memberships[key]; ok {
+		return member, nil
+	}
+
+	parts := strings.SplitN(team, "/", 2)
+	membership, resp, err := m.client.Teams.GetTeamMembershipBySlug(m.ctx, parts[0], parts[1], user)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			m.memberships[key] = false
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check membership of %s in %s: %w", user, team, err)
+	}
+	m.memberships[key] = membership.GetState() == "active"
+	return m.memberships[key], nil
+}
@@ -0,0 +1,78 @@
+package merger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCodeownersPatternToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"*", "README.md", true},
+		{"*", "src/main.go", true},
+		{"*.js", "app.js", true},
+		{"*.js", "web/src/app.js", true},
+		{"*.js", "app.go", false},
+		{"/docs/", "docs/index.md", true},
+		{"/docs/", "docs/guide/setup.md", true},
+		{"/docs/", "src/docs/index.md", false},
+		{"apps/", "apps/web/main.go", true},
+		{"apps/", "src/apps/web/main.go", true},
+		{"apps/", "apps.go", false},
+		{"docs/*", "docs/getting-started.md", true},
+		{"docs/*", "docs/build-app/troubleshooting.md", false},
+		{"docs/*", "src/docs/getting-started.md", false},
+		{"**/logs", "logs/app.log", true},
+		{"**/logs", "build/logs/app.log", true},
+		{"**/logs", "build/logs", true},
+		{"**/logs", "build/logsheet.txt", false},
+		{"/build/logs/", "build/logs/app.log", true},
+		{"/build/logs/", "src/build/logs/app.log", false},
+		{"main.go", "main.go", true},
+		{"main.go", "cmd/main.go", true},
+	}
+
+	for _, test := range tests {
+		pattern, err := codeownersPatternToRegexp(test.pattern)
+		if err != nil {
+			t.Fatalf("codeownersPatternToRegexp(%q) returned error: %v", test.pattern, err)
+		}
+		if matches := pattern.MatchString(test.path); matches != test.matches {
+			t.Errorf("pattern %q matching %q = %v, want %v", test.pattern, test.path, matches, test.matches)
+		}
+	}
+}
+
+func TestOwnersFor(t *testing.T) {
+	rules, err := parseCodeowners(`
+# Default owners
+*       @global-owner
+
+*.js    @js-owner # frontend team
+/docs/  @docs-owner docs@example.com
+/docs/generated/
+`)
+	if err != nil {
+		t.Fatalf("parseCodeowners returned error: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		owners []string
+	}{
+		{"main.go", []string{"@global-owner"}},
+		{"web/app.js", []string{"@js-owner"}},
+		{"docs/index.md", []string{"@docs-owner", "docs@example.com"}},
+		{"docs/app.js", []string{"@docs-owner", "docs@example.com"}},
+		{"docs/generated/api.md", []string{}},
+	}
+
+	for _, test := range tests {
+		if owners := ownersFor(rules, test.path); !reflect.DeepEqual(owners, test.owners) {
+			t.Errorf("ownersFor(%q) = %v, want %v", test.path, owners, test.owners)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// blockedCommentMarker is a hidden marker in the comment merger posts on
+// blocked pull requests, used to find and update it rather than posting a new
+// comment every run.
+const blockedCommentMarker = "<!-- merger:blocked -->"
+
+// BlockingCheck is a check run or commit status that is preventing a pull
+// request from being merged.
+type BlockingCheck struct {
+	Name  string
+	State string
+	URL   string
+}
+
+// blockingChecks returns the check runs and commit statuses that haven't
+// passed. When required is non-nil only the checks in it are considered, to
+// match -required-only.
+func blockingChecks(checkRuns []*github.CheckRun, statuses []*github.RepoStatus, required map[string]bool, passingConclusions []string) []BlockingCheck {
+	blocking := []BlockingCheck{}
+	for _, checkRun := range checkRuns {
+		if required != nil && !required[checkRun.GetName()] {
+			continue
+		}
+		state := checkRun.GetStatus()
+		if state == "completed" {
+			if isPassingConclusion(checkRun.GetConclusion(), passingConclusions) {
+				continue
+			}
+			state = checkRun.GetConclusion()
+		}
+		blocking = append(blocking, BlockingCheck{
+			Name:  checkRun.GetName(),
+			State: state,
+			URL:   checkRun.GetDetailsURL(),
+		})
+	}
+	for _, status := range statuses {
+		if required != nil && !required[status.GetContext()] {
+			continue
+		}
+		if status.GetState() == "success" {
+			continue
+		}
+		blocking = append(blocking, BlockingCheck{
+			Name:  status.GetContext(),
+			State: status.GetState(),
+			URL:   status.GetTargetURL(),
+		})
+	}
+	return blocking
+}
+
+// commentOnBlocked posts a comment on the pull request listing the checks
+// blocking it. If merger has already commented the comment is updated
+// instead, and left alone if nothing has changed.
+func commentOnBlocked(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, blocking []BlockingCheck, opts *Options) error {
+	if len(blocking) == 0 {
+		return nil
+	}
+	comment, err := renderTemplate(opts.BlockedComment, newTemplateData(pullRequest, blocking))
+	if err != nil {
+		return fmt.Errorf("failed to render comment for pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	// The marker is added outside of the template so a custom template can't
+	// stop merger from finding its comment again.
+	body := blockedCommentMarker + "\n" + comment
+
+	existing, err := findComment(ctx, client, owner, repoName, pullRequest.GetNumber(), blockedCommentMarker, opts.PerPage)
+	if err != nil {
+		return fmt.Errorf("failed to list comments of pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	if existing != nil {
+		if existing.GetBody() == body {
+			return nil
+		}
+		_, _, err = client.Issues.EditComment(ctx, owner, repoName, existing.GetID(), &github.IssueComment{Body: &body})
+		if err != nil {
+			return fmt.Errorf("failed to update comment on pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		logInfo(ctx, pullRequestFields(pullRequest), "Updated the comment listing blocking checks on pull request %d", pullRequest.GetNumber())
+		return nil
+	}
+
+	_, _, err = client.Issues.CreateComment(ctx, owner, repoName, pullRequest.GetNumber(), &github.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("failed to comment on pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(ctx, pullRequestFields(pullRequest), "Commented the blocking checks on pull request %d", pullRequest.GetNumber())
+	return nil
+}
+
+// findComment returns the first comment on the issue or pull request that
+// contains the marker, or nil if there isn't one.
+func findComment(ctx context.Context, client *github.Client, owner, repoName string, number int, marker string, perPage int) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: perPage}}
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), marker) {
+				return comment, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
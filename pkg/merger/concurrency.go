@@ -0,0 +1,42 @@
+package merger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// evaluation is whether a pull request is ready to merge, as decided by
+// readyToMerge.
+type evaluation struct {
+	ready *github.PullRequest
+	err   error
+}
+
+// evaluateConcurrently runs readyToMergeOrStale for each of the pull requests using
+// -concurrency workers. The evaluations are returned in the same order as the
+// pull requests.
+func evaluateConcurrently(ctx context.Context, client *github.Client, owner, repoName string, pullRequests []*github.PullRequest, opts *Options) []evaluation {
+	evaluations := make([]evaluation, len(pullRequests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				pullRequestCtx, span := startSpan(ctx, "evaluate pull request", pullRequestFields(pullRequests[i]))
+				ready, err := readyToMergeOrStale(pullRequestCtx, client, owner, repoName, pullRequests[i], opts)
+				span.end(err)
+				evaluations[i] = evaluation{ready: ready, err: err}
+			}
+		}()
+	}
+	for i := range pullRequests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return evaluations
+}
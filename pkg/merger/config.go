@@ -0,0 +1,233 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"gopkg.in/yaml.v2"
+)
+
+// repositoryConfigPath is where a repository can define its own merge policy.
+const repositoryConfigPath = ".github/merger.yml"
+
+// repositoryConfig is the policy a repository defines for itself in
+// .github/merger.yml. Any field that is left out falls back to the value given
+// on the command line.
+type repositoryConfig struct {
+	Labels               []string `yaml:"labels"`
+	LabelMatch           string   `yaml:"label_match"`
+	BlockLabels          []string `yaml:"block_labels"`
+	PriorityLabels       []string `yaml:"priority_labels"`
+	Sort                 string   `yaml:"sort"`
+	BaseBranches         []string `yaml:"base_branches"`
+	AllowedAuthors       []string `yaml:"allowed_authors"`
+	TitlePattern         string   `yaml:"title_pattern"`
+	Expressions          []string `yaml:"expressions"`
+	DependabotMaxBump    string   `yaml:"dependabot_max_bump"`
+	Renovate             *bool    `yaml:"renovate"`
+	MergeMethod          string   `yaml:"merge_method"`
+	MergeWindows         []string `yaml:"merge_windows"`
+	Timezone             string   `yaml:"timezone"`
+	RequiredApprovals    *int     `yaml:"required_approvals"`
+	PassingConclusions   []string `yaml:"passing_conclusions"`
+	FreshApprovals       *bool    `yaml:"fresh_approvals"`
+	Codeowners           *bool    `yaml:"codeowners"`
+	RequireSignedCommits *bool    `yaml:"require_signed_commits"`
+	RequireSignOff       *bool    `yaml:"require_signoff"`
+	MergeMessage         string   `yaml:"merge_message"`
+	ConventionalCommits  *bool    `yaml:"conventional_commits"`
+	CommitTitle          string   `yaml:"commit_title"`
+	BlockedComment       string   `yaml:"blocked_comment"`
+}
+
+// loadRepositoryConfig fetches and parses the repository's config file from
+// its default branch. If the repository doesn't have a config file, nil is
+// returned.
+func loadRepositoryConfig(ctx context.Context, client *github.Client, owner, repoName string) (*repositoryConfig, error) {
+	fileContent, _, resp, err := client.Repositories.GetContents(ctx, owner, repoName, repositoryConfigPath, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve %s: %w", repositoryConfigPath, err)
+	}
+	if fileContent == nil {
+		return nil, fmt.Errorf("expected %s to be a file", repositoryConfigPath)
+	}
+
+	content, err := fileContent.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", repositoryConfigPath, err)
+	}
+
+	config := &repositoryConfig{}
+	if err := yaml.UnmarshalStrict([]byte(content), config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", repositoryConfigPath, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", repositoryConfigPath, err)
+	}
+	return config, nil
+}
+
+func (c *repositoryConfig) validate() error {
+	if c.LabelMatch != "" && c.LabelMatch != "all" && c.LabelMatch != "any" {
+		return fmt.Errorf("label_match must be one of all or any. '%s' is not", c.LabelMatch)
+	}
+	if err := ValidatePatterns(c.BaseBranches); err != nil {
+		return fmt.Errorf("invalid base_branches: %w", err)
+	}
+	if _, err := regexp.Compile(c.TitlePattern); err != nil {
+		return fmt.Errorf("invalid title_pattern: %w", err)
+	}
+	for _, expression := range c.Expressions {
+		if _, err := ParseExpression(expression); err != nil {
+			return fmt.Errorf("invalid expressions: %w", err)
+		}
+	}
+	if _, ok := bumpNames[c.DependabotMaxBump]; c.DependabotMaxBump != "" && !ok {
+		return fmt.Errorf("dependabot_max_bump must be one of patch, minor or major. '%s' is not", c.DependabotMaxBump)
+	}
+	if !IsValidSortOrder(c.Sort) {
+		return fmt.Errorf("sort must be one of oldest, newest or least-recently-updated. '%s' is not", c.Sort)
+	}
+	if c.MergeMethod != "" && !IsValidMergeMethod(c.MergeMethod) {
+		return fmt.Errorf("merge_method must be one of merge, squash or rebase. '%s' is not", c.MergeMethod)
+	}
+	for _, window := range c.MergeWindows {
+		if _, err := ParseMergeWindow(window); err != nil {
+			return fmt.Errorf("invalid merge_windows: %w", err)
+		}
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	if err := ValidateConclusions(c.PassingConclusions); err != nil {
+		return fmt.Errorf("invalid passing_conclusions: %w", err)
+	}
+	if err := ValidateTemplate(c.MergeMessage); err != nil {
+		return fmt.Errorf("invalid merge_message: %w", err)
+	}
+	if err := ValidateTemplate(c.CommitTitle); err != nil {
+		return fmt.Errorf("invalid commit_title: %w", err)
+	}
+	if err := ValidateTemplate(c.BlockedComment); err != nil {
+		return fmt.Errorf("invalid blocked_comment: %w", err)
+	}
+	if c.RequiredApprovals != nil && *c.RequiredApprovals < 0 {
+		return fmt.Errorf("required_approvals must not be negative. %d is", *c.RequiredApprovals)
+	}
+	return nil
+}
+
+// apply returns a copy of opts with the values set in the config overriding
+// those given on the command line.
+func (c *repositoryConfig) apply(opts *Options) *Options {
+	applied := *opts
+	if c == nil {
+		return &applied
+	}
+	if len(c.Labels) > 0 {
+		applied.Labels = c.Labels
+	}
+	if c.LabelMatch != "" {
+		applied.MatchAll = c.LabelMatch == "all"
+	}
+	if len(c.BlockLabels) > 0 {
+		applied.BlockLabels = c.BlockLabels
+	}
+	if len(c.PriorityLabels) > 0 {
+		applied.PriorityLabels = c.PriorityLabels
+	}
+	if c.Sort != "" {
+		applied.SortOrder = c.Sort
+	}
+	if len(c.BaseBranches) > 0 {
+		applied.BaseBranches = c.BaseBranches
+	}
+	if len(c.AllowedAuthors) > 0 {
+		applied.AllowedAuthors = c.AllowedAuthors
+	}
+	if c.TitlePattern != "" {
+		// The pattern was checked when the config was loaded.
+		applied.TitlePattern = regexp.MustCompile(c.TitlePattern)
+	}
+	if len(c.Expressions) > 0 {
+		applied.Expressions = nil
+		for _, source := range c.Expressions {
+			// The expressions were checked when the config was loaded.
+			expression, _ := ParseExpression(source)
+			applied.Expressions = append(applied.Expressions, expression)
+		}
+	}
+	if c.DependabotMaxBump != "" {
+		applied.DependabotMaxBump = c.DependabotMaxBump
+	}
+	if c.Renovate != nil {
+		applied.Renovate = *c.Renovate
+	}
+	if c.MergeMethod != "" {
+		applied.MergeMethod = c.MergeMethod
+	}
+	if len(c.MergeWindows) > 0 {
+		applied.MergeWindows = nil
+		for _, source := range c.MergeWindows {
+			// The windows were checked when the config was loaded.
+			window, _ := ParseMergeWindow(source)
+			applied.MergeWindows = append(applied.MergeWindows, window)
+		}
+	}
+	if c.Timezone != "" {
+		// The time zone was checked when the config was loaded.
+		applied.Location, _ = time.LoadLocation(c.Timezone)
+	}
+	if c.RequiredApprovals != nil {
+		applied.RequiredApprovals = *c.RequiredApprovals
+	}
+	if c.FreshApprovals != nil {
+		applied.FreshApprovals = *c.FreshApprovals
+	}
+	if c.Codeowners != nil {
+		applied.Codeowners = *c.Codeowners
+	}
+	if c.RequireSignedCommits != nil {
+		applied.RequireSignedCommits = *c.RequireSignedCommits
+	}
+	if c.RequireSignOff != nil {
+		applied.RequireSignOff = *c.RequireSignOff
+	}
+	if len(c.PassingConclusions) > 0 {
+		applied.PassingConclusions = c.PassingConclusions
+	}
+	if c.MergeMessage != "" {
+		applied.MergeMessage = c.MergeMessage
+	}
+	if c.CommitTitle != "" {
+		applied.CommitTitleTemplate = c.CommitTitle
+	}
+	if c.ConventionalCommits != nil {
+		applied.ConventionalCommits = *c.ConventionalCommits
+	}
+	if c.BlockedComment != "" {
+		applied.BlockedComment = c.BlockedComment
+	}
+	return &applied
+}
+
+// repositoryOptions loads the repository's config file and applies it on top
+// of opts, making it a dry run if the repository is frozen.
+func repositoryOptions(ctx context.Context, client *github.Client, owner, repoName string, opts *Options) (*Options, error) {
+	config, err := loadRepositoryConfig(ctx, client, owner, repoName)
+	if err != nil {
+		return nil, err
+	}
+	repoOpts := config.apply(opts)
+	if len(repoOpts.Labels) == 0 && repoOpts.PullRequest == 0 {
+		return nil, fmt.Errorf("no labels given on the command line or in %s", repositoryConfigPath)
+	}
+	return frozenRepositoryOptions(ctx, client, owner, repoName, repoOpts)
+}
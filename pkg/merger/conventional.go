@@ -0,0 +1,30 @@
+package merger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// conventionalCommitPattern matches a Conventional Commits header, such as
+// "feat(api)!: add pagination", with one of the types release tooling like
+// semantic-release and release-please understand.
+var conventionalCommitPattern = regexp.MustCompile(`^(build|chore|ci|docs|feat|fix|perf|refactor|revert|style|test)(\([\w./-]+\))?!?: \S`)
+
+// isConventionalCommit reports whether the title is a valid Conventional
+// Commits header.
+func isConventionalCommit(title string) bool {
+	return conventionalCommitPattern.MatchString(title)
+}
+
+// conventionalCommitMessage returns the title and message of the squashed
+// commit for the pull request following Conventional Commits: its title, with
+// its number like GitHub adds, and its description as the body, which carries
+// any BREAKING CHANGE footer.
+func conventionalCommitMessage(pullRequest *github.PullRequest) (string, string) {
+	title := fmt.Sprintf("%s (#%d)", strings.TrimSpace(pullRequest.GetTitle()), pullRequest.GetNumber())
+	body := strings.TrimSpace(strings.ReplaceAll(pullRequest.GetBody(), "\r\n", "\n"))
+	return title, body
+}
@@ -0,0 +1,45 @@
+package merger
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestIsConventionalCommit(t *testing.T) {
+	tests := []struct {
+		title string
+		valid bool
+	}{
+		{"feat: add -pr", true},
+		{"fix(checks): ignore skipped check runs", true},
+		{"chore(deps)!: bump go-github to v32", true},
+		{"build(deps/go.mod): bump yaml.v2", true},
+		{"Bump yaml.v2 from 2.3.0 to 2.4.0", false},
+		{"feature: add -pr", false},
+		{"feat:add -pr", false},
+		{"feat(): add -pr", false},
+		{"Feat: add -pr", false},
+	}
+
+	for _, test := range tests {
+		if valid := isConventionalCommit(test.title); valid != test.valid {
+			t.Errorf("isConventionalCommit(%q) = %t, want %t", test.title, valid, test.valid)
+		}
+	}
+}
+
+func TestConventionalCommitMessage(t *testing.T) {
+	pullRequest := &github.PullRequest{
+		Number: github.Int(42),
+		Title:  github.String("feat(api)!: paginate repositories "),
+		Body:   github.String("Lists every page.\r\n\r\nBREAKING CHANGE: -per-page is required\r\n"),
+	}
+	title, body := conventionalCommitMessage(pullRequest)
+	if title != "feat(api)!: paginate repositories (#42)" {
+		t.Errorf("conventionalCommitMessage() title = %q", title)
+	}
+	if body != "Lists every page.\n\nBREAKING CHANGE: -per-page is required" {
+		t.Errorf("conventionalCommitMessage() body = %q", body)
+	}
+}
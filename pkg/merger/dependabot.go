@@ -0,0 +1,104 @@
+package merger
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Version bumps in increasing order of size.
+const (
+	bumpPatch = iota
+	bumpMinor
+	bumpMajor
+)
+
+var bumpNames = map[string]int{
+	"patch": bumpPatch,
+	"minor": bumpMinor,
+	"major": bumpMajor,
+}
+
+// IsValidBump reports whether bump is patch, minor or major.
+func IsValidBump(bump string) bool {
+	_, ok := bumpNames[bump]
+	return ok
+}
+
+// dependabotTitleRegexp matches the versions in Dependabot PR titles such as
+// "Bump lodash from 4.17.19 to 4.17.20" or "Update rake requirement from ~>
+// 12.3 to ~> 13.0".
+var dependabotTitleRegexp = regexp.MustCompile(`(?i)\bfrom (?:[~^<>=]+\s*)?v?(\S+) to (?:[~^<>=]+\s*)?v?(\S+)`)
+
+func isDependabotPullRequest(pullRequest *github.PullRequest) bool {
+	return pullRequest.GetUser().GetLogin() == "dependabot[bot]" ||
+		strings.HasPrefix(pullRequest.GetHead().GetRef(), "dependabot/")
+}
+
+// dependabotBump returns the size of the version bump in the title of a
+// Dependabot pull request.
+func dependabotBump(title string) (int, error) {
+	matches := dependabotTitleRegexp.FindStringSubmatch(title)
+	if matches == nil {
+		return 0, fmt.Errorf("no versions found in title '%s'", title)
+	}
+
+	from, err := parseVersion(matches[1])
+	if err != nil {
+		return 0, err
+	}
+	to, err := parseVersion(matches[2])
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case from[0] != to[0]:
+		return bumpMajor, nil
+	case from[1] != to[1]:
+		return bumpMinor, nil
+	default:
+		return bumpPatch, nil
+	}
+}
+
+// parseVersion parses the major, minor and patch components of a version,
+// treating missing components as zero and ignoring any pre-release or build
+// suffix.
+func parseVersion(version string) ([3]int, error) {
+	var components [3]int
+	version = strings.TrimRight(version, ".,")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	for i := 0; i < len(parts) && i < len(components); i++ {
+		component, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return components, fmt.Errorf("invalid version '%s'", version)
+		}
+		components[i] = component
+	}
+	return components, nil
+}
+
+// dependabotSkipReason returns why a Dependabot pull request bumps its
+// dependency by more than maxBump, or an empty string if it doesn't.
+func dependabotSkipReason(pullRequest *github.PullRequest, maxBump string) string {
+	bump, err := dependabotBump(pullRequest.GetTitle())
+	if err != nil {
+		return fmt.Sprintf("its dependency update couldn't be determined: %v", err)
+	}
+	if bump > bumpNames[maxBump] {
+		for name, value := range bumpNames {
+			if value == bump {
+				return fmt.Sprintf("it is a %s update and -dependabot-max-bump is %s", name, maxBump)
+			}
+		}
+	}
+	return ""
+}
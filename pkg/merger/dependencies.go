@@ -0,0 +1,86 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// dependsOnRegexp matches "Depends-on:" trailers in pull request bodies, such
+// as "Depends-on: #123" or "Depends on: #123, #456".
+var dependsOnRegexp = regexp.MustCompile(`(?im)^\s*depends[- ]on:(.*)$`)
+
+// pullRequestNumberRegexp matches references to pull requests in the same
+// repository, such as "#123".
+var pullRequestNumberRegexp = regexp.MustCompile(`(?:^|[\s,])#(\d+)\b`)
+
+// parseDependencies returns the numbers of the pull requests that the body
+// says must be merged first.
+func parseDependencies(body string) []int {
+	dependencies := []int{}
+	for _, trailer := range dependsOnRegexp.FindAllStringSubmatch(body, -1) {
+		for _, reference := range pullRequestNumberRegexp.FindAllStringSubmatch(trailer[1], -1) {
+			number, err := strconv.Atoi(reference[1])
+			if err == nil {
+				dependencies = append(dependencies, number)
+			}
+		}
+	}
+	return dependencies
+}
+
+// orderByDependencies orders the pull requests so that each one comes after
+// the pull requests it depends on, keeping the existing order otherwise.
+// Dependency cycles are broken arbitrarily; the pull requests in them are
+// never merged anyway.
+func orderByDependencies(pullRequests []*github.PullRequest) []*github.PullRequest {
+	byNumber := map[int]*github.PullRequest{}
+	for _, pullRequest := range pullRequests {
+		byNumber[pullRequest.GetNumber()] = pullRequest
+	}
+
+	ordered := []*github.PullRequest{}
+	visited := map[int]bool{}
+	var visit func(pullRequest *github.PullRequest)
+	visit = func(pullRequest *github.PullRequest) {
+		if visited[pullRequest.GetNumber()] {
+			return
+		}
+		visited[pullRequest.GetNumber()] = true
+		for _, dependency := range parseDependencies(pullRequest.GetBody()) {
+			if dependencyPullRequest, ok := byNumber[dependency]; ok {
+				visit(dependencyPullRequest)
+			}
+		}
+		ordered = append(ordered, pullRequest)
+	}
+	for _, pullRequest := range pullRequests {
+		visit(pullRequest)
+	}
+	return ordered
+}
+
+// dependenciesMerged reports whether every pull request that the pull request
+// depends on has been merged.
+func dependenciesMerged(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) (bool, error) {
+	for _, dependency := range parseDependencies(pullRequest.GetBody()) {
+		dependencyPullRequest, _, err := client.PullRequests.Get(ctx, owner, repoName, dependency)
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve pull request %d that pull request %d depends on: %w", dependency, pullRequest.GetNumber(), err)
+		}
+		if !dependencyPullRequest.GetMerged() {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "dependency"),
+				"Pull request %d depends on pull request %d which hasn't been merged. Not merging it.",
+				pullRequest.GetNumber(),
+				dependency,
+			)
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package merger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		body         string
+		dependencies []int
+	}{
+		{"", []int{}},
+		{"Fixes #12", []int{}},
+		{"Depends-on: #123", []int{123}},
+		{"depends on: #1, #2", []int{1, 2}},
+		{"Some description.\n\nDepends-on: #4\nDepends-on: #5\n", []int{4, 5}},
+		{"  Depends-On: #7 and #8", []int{7, 8}},
+		{"Depends-on: owner/repo#9", []int{}},
+		{"This depends-on: #10 being merged", []int{}},
+	}
+
+	for _, test := range tests {
+		if dependencies := parseDependencies(test.body); !reflect.DeepEqual(dependencies, test.dependencies) {
+			t.Errorf("parseDependencies(%q) = %v, want %v", test.body, dependencies, test.dependencies)
+		}
+	}
+}
+
+func TestOrderByDependencies(t *testing.T) {
+	pullRequest := func(number int, body string) *github.PullRequest {
+		return &github.PullRequest{Number: github.Int(number), Body: github.String(body)}
+	}
+	ordered := orderByDependencies([]*github.PullRequest{
+		pullRequest(1, "Depends-on: #3"),
+		pullRequest(2, ""),
+		pullRequest(3, "Depends-on: #4"),
+		pullRequest(4, ""),
+		pullRequest(5, "Depends-on: #6"),
+		pullRequest(6, "Depends-on: #5"),
+	})
+
+	numbers := []int{}
+	for _, pullRequest := range ordered {
+		numbers = append(numbers, pullRequest.GetNumber())
+	}
+	if want := []int{4, 3, 1, 2, 6, 5}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("orderByDependencies = %v, want %v", numbers, want)
+	}
+}
@@ -0,0 +1,31 @@
+package merger
+
+import "context"
+
+// discordMaxContent is the longest message Discord accepts from a webhook.
+const discordMaxContent = 2000
+
+// discordNotifier posts notifications to a Discord webhook.
+type discordNotifier struct {
+	webhookURL string
+}
+
+// NewDiscordNotifier returns a Notifier that posts to a Discord webhook.
+func NewDiscordNotifier(webhookURL string) Notifier {
+	return &discordNotifier{webhookURL: webhookURL}
+}
+
+func (n *discordNotifier) notify(ctx context.Context, event, message string) error {
+	if runes := []rune(message); len(runes) > discordMaxContent {
+		message = string(runes[:discordMaxContent-1]) + "…"
+	}
+	return postJSON(ctx, n.webhookURL, map[string]interface{}{
+		"content": message,
+		// Stop pull request titles from pinging anyone.
+		"allowed_mentions": map[string][]string{"parse": {}},
+	})
+}
+
+func (n *discordNotifier) String() string {
+	return "Discord"
+}
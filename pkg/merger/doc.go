@@ -0,0 +1,9 @@
+// Package merger checks and merges GitHub pull requests that have the
+// configured labels once their checks have passed.
+//
+// A Policy decides which pull requests may be merged and is part of the
+// Options that control how they are merged. An Evaluator decides whether a
+// single pull request is ready to be merged without changing anything, while
+// a Merger checks and merges the pull requests in whole repositories, either
+// once, at an interval or as GitHub webhooks arrive.
+package merger
@@ -0,0 +1,86 @@
+package merger
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Emailer emails a summary of each run over SMTP.
+type Emailer struct {
+	// address is the host:port of the SMTP server.
+	address  string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewEmailer returns an Emailer that sends summaries from one address to the
+// others through the SMTP server at address, a host:port. The username and
+// password are only used if username is set.
+func NewEmailer(address, username, password, from string, to []string) *Emailer {
+	return &Emailer{address: address, username: username, password: password, from: from, to: to}
+}
+
+// sendSummary emails the merged, blocked and failed pull requests in the
+// report. Nothing is sent unless a pull request was merged or failed, so
+// long-lived mergers don't send the same list of blocked pull requests every
+// run.
+func (e *Emailer) sendSummary(r *report) error {
+	r.mu.Lock()
+	sections := map[string][]string{}
+	for _, entry := range r.entries {
+		line := fmt.Sprintf("* %s#%d: %s", entry.repo, entry.number, entry.message)
+		if entry.url != "" {
+			line += "\n  " + entry.url
+		}
+		sections[entry.decision] = append(sections[entry.decision], line)
+	}
+	r.mu.Unlock()
+
+	merged, blocked, failed := sections["merged"], sections["blocked"], sections["failed"]
+	if len(merged) == 0 && len(failed) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	for _, section := range []struct {
+		heading string
+		lines   []string
+	}{
+		{"Merged", merged},
+		{"Failed", failed},
+		{"Blocked", blocked},
+	} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&body, "%s:\n\n%s\n\n", section.heading, strings.Join(section.lines, "\n"))
+	}
+
+	subject := fmt.Sprintf("merger merged %d, failed %d and was blocked on %d pull requests", len(merged), len(failed), len(blocked))
+	message := strings.Join([]string{
+		"From: " + e.from,
+		"To: " + strings.Join(e.to, ", "),
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body.String(),
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, err := net.SplitHostPort(e.address)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %s: %w", e.address, err)
+		}
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	// SendMail upgrades to TLS with STARTTLS when the server supports it.
+	return smtp.SendMail(e.address, auth, e.from, e.to, []byte(message))
+}
@@ -0,0 +1,31 @@
+package merger
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// ErrAuth is wrapped by errors caused by authentication or rate limit errors
+// that have been summarised, so they can be told apart from other failures.
+var ErrAuth = errors.New("authentication or rate limit error")
+
+// IsAuthError reports whether the error was caused by the forge rejecting
+// merger's credentials or rate limiting it.
+func IsAuthError(err error) bool {
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	var errorResponse *github.ErrorResponse
+	var apiErr *apiError
+	switch {
+	case errors.Is(err, ErrAuth), errors.As(err, &rateLimitErr), errors.As(err, &abuseRateLimitErr), errors.Is(err, errRateLimitLow):
+		return true
+	case errors.As(err, &errorResponse):
+		return errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusUnauthorized
+	case errors.As(err, &apiErr):
+		return apiErr.statusCode == http.StatusUnauthorized
+	default:
+		return false
+	}
+}
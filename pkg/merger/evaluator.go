@@ -0,0 +1,78 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Decision is whether a pull request is ready to be merged and, if it isn't,
+// why not.
+type Decision struct {
+	Ready bool
+	// Cause is a short name for why the pull request isn't ready, such as
+	// checks or approvals, as logged in the cause field. It is empty for
+	// pull requests that are ready.
+	Cause string
+	// Reason describes why the pull request isn't ready.
+	Reason string
+}
+
+// Evaluator decides whether pull requests are ready to be merged without
+// merging them or changing them in any other way.
+type Evaluator struct {
+	client *github.Client
+	opts   *Options
+}
+
+// NewEvaluator creates an Evaluator that uses the client to decide whether
+// pull requests are ready to be merged as opts says.
+func NewEvaluator(client *github.Client, opts *Options) *Evaluator {
+	evaluatorOpts := *opts
+	evaluatorOpts.DryRun = true
+	return &Evaluator{client: client, opts: &evaluatorOpts}
+}
+
+// Evaluate decides whether the pull request in the repository is ready to be
+// merged, taking the repository's config file into account. An error is
+// returned if that couldn't be decided.
+func (e *Evaluator) Evaluate(ctx context.Context, repo Repository, number int) (Decision, error) {
+	// The decision is worked out from what is logged about the pull request,
+	// which is recorded in its own report.
+	r := newReport()
+	ctx = withReport(ctx, r)
+
+	pullRequest, _, err := e.client.PullRequests.Get(ctx, repo.owner, repo.name, number)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to retrieve pull request %d from %s: %w", number, repo, err)
+	}
+	if pullRequest.GetState() != "open" {
+		return Decision{Cause: "closed", Reason: fmt.Sprintf("it is %s", pullRequest.GetState())}, nil
+	}
+
+	opts, err := repositoryOptions(ctx, e.client, repo.owner, repo.name, e.opts)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to configure %s: %w", repo, err)
+	}
+	if len(filterPullRequestsByLabels([]*github.PullRequest{pullRequest}, opts.Labels, opts.MatchAll)) == 0 {
+		return Decision{Cause: "labels", Reason: "it doesn't have the labels"}, nil
+	}
+	if reason := skipReason(pullRequest, opts); reason != "" {
+		return Decision{Cause: "ineligible", Reason: reason}, nil
+	}
+
+	ready, err := readyToMerge(ctx, e.client, repo.owner, repo.name, pullRequest, opts)
+	if err != nil {
+		return Decision{}, err
+	}
+	if ready != nil {
+		return Decision{Ready: true}, nil
+	}
+	decision := Decision{Cause: "blocked", Reason: "it isn't ready to be merged"}
+	if entry := r.byKey[fmt.Sprintf("%s#%d", repo, number)]; entry != nil && entry.decision != "" {
+		decision.Cause = entry.cause
+		decision.Reason = entry.message
+	}
+	return decision, nil
+}
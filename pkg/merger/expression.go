@@ -0,0 +1,178 @@
+package merger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/go-github/v32/github"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Expression is a condition on pull requests written in the Common Expression
+// Language (CEL), such as pr.additions < 500 && pr.author in ['dependabot[bot]'].
+// The pull request is the variable pr, with the fields number, title, body,
+// author, labels, draft, base, head, repository, additions, deletions,
+// changed_files, commits and mergeable_state.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+// expressionFields are the fields of pr in expressions.
+var expressionFields = map[string]bool{
+	"number":          true,
+	"title":           true,
+	"body":            true,
+	"author":          true,
+	"labels":          true,
+	"draft":           true,
+	"base":            true,
+	"head":            true,
+	"repository":      true,
+	"additions":       true,
+	"deletions":       true,
+	"changed_files":   true,
+	"commits":         true,
+	"mergeable_state": true,
+}
+
+var (
+	expressionEnvOnce sync.Once
+	expressionEnv     *cel.Env
+	expressionEnvErr  error
+)
+
+// newExpressionEnv is the CEL environment expressions are compiled in, where
+// pr is a map as its fields have different types.
+func newExpressionEnv() (*cel.Env, error) {
+	expressionEnvOnce.Do(func() {
+		expressionEnv, expressionEnvErr = cel.NewEnv(cel.Variable("pr", cel.MapType(cel.StringType, cel.DynType)))
+	})
+	return expressionEnv, expressionEnvErr
+}
+
+// ParseExpression compiles the expression, checking that it only refers to pr
+// and its fields and could be a bool.
+func ParseExpression(source string) (*Expression, error) {
+	env, err := newExpressionEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+	ast, issues := env.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression %s: %w", source, issues.Err())
+	}
+	if outputType := ast.OutputType(); outputType != cel.BoolType && outputType != cel.DynType {
+		return nil, fmt.Errorf("invalid expression %s: it is a %s rather than a bool", source, outputType)
+	}
+	if err := checkExpressionFields(ast.Expr(), false); err != nil {
+		return nil, fmt.Errorf("invalid expression %s: %w", source, err)
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %s: %w", source, err)
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+// checkExpressionFields checks that every field of pr selected in the
+// expression exists, as pr is a map and the type checker can't. shadowed is
+// whether a macro's variable is called pr.
+func checkExpressionFields(expr *exprpb.Expr, shadowed bool) error {
+	switch kind := expr.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		operand := kind.SelectExpr.GetOperand()
+		if !shadowed && operand.GetIdentExpr().GetName() == "pr" && !expressionFields[kind.SelectExpr.GetField()] {
+			return fmt.Errorf("pr has no field %s", kind.SelectExpr.GetField())
+		}
+		return checkExpressionFields(operand, shadowed)
+	case *exprpb.Expr_CallExpr:
+		if target := kind.CallExpr.GetTarget(); target != nil {
+			if err := checkExpressionFields(target, shadowed); err != nil {
+				return err
+			}
+		}
+		for _, arg := range kind.CallExpr.GetArgs() {
+			if err := checkExpressionFields(arg, shadowed); err != nil {
+				return err
+			}
+		}
+	case *exprpb.Expr_ListExpr:
+		for _, element := range kind.ListExpr.GetElements() {
+			if err := checkExpressionFields(element, shadowed); err != nil {
+				return err
+			}
+		}
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range kind.StructExpr.GetEntries() {
+			if key := entry.GetMapKey(); key != nil {
+				if err := checkExpressionFields(key, shadowed); err != nil {
+					return err
+				}
+			}
+			if err := checkExpressionFields(entry.GetValue(), shadowed); err != nil {
+				return err
+			}
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		comprehension := kind.ComprehensionExpr
+		if err := checkExpressionFields(comprehension.GetIterRange(), shadowed); err != nil {
+			return err
+		}
+		if err := checkExpressionFields(comprehension.GetAccuInit(), shadowed); err != nil {
+			return err
+		}
+		inner := shadowed || comprehension.GetIterVar() == "pr" || comprehension.GetAccuVar() == "pr"
+		for _, step := range []*exprpb.Expr{comprehension.GetLoopCondition(), comprehension.GetLoopStep(), comprehension.GetResult()} {
+			if err := checkExpressionFields(step, inner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Matches evaluates the expression against the pull request. An error is
+// returned if it can't be evaluated, such as when comparing values of
+// different types, or if it isn't a bool.
+func (e *Expression) Matches(pullRequest *github.PullRequest) (bool, error) {
+	value, _, err := e.program.Eval(map[string]interface{}{"pr": expressionVariables(pullRequest)})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate %s: %w", e.source, err)
+	}
+	matched, ok := value.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("%s evaluated to %s rather than a bool", e.source, value.Type().TypeName())
+	}
+	return bool(matched), nil
+}
+
+// expressionVariables describes the pull request as pr in expressions.
+func expressionVariables(pullRequest *github.PullRequest) map[string]interface{} {
+	labels := []interface{}{}
+	for _, label := range pullRequest.Labels {
+		labels = append(labels, label.GetName())
+	}
+	return map[string]interface{}{
+		"number":          int64(pullRequest.GetNumber()),
+		"title":           pullRequest.GetTitle(),
+		"body":            pullRequest.GetBody(),
+		"author":          pullRequest.GetUser().GetLogin(),
+		"labels":          labels,
+		"draft":           pullRequest.GetDraft(),
+		"base":            pullRequest.GetBase().GetRef(),
+		"head":            pullRequest.GetHead().GetRef(),
+		"repository":      pullRequest.GetBase().GetRepo().GetFullName(),
+		"additions":       int64(pullRequest.GetAdditions()),
+		"deletions":       int64(pullRequest.GetDeletions()),
+		"changed_files":   int64(pullRequest.GetChangedFiles()),
+		"commits":         int64(pullRequest.GetCommits()),
+		"mergeable_state": pullRequest.GetMergeableState(),
+	}
+}
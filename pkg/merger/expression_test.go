@@ -0,0 +1,93 @@
+package merger
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestExpressionMatches(t *testing.T) {
+	pullRequest := fakePullRequest(7, "chore(deps): bump yaml", "automerge", "area/ci")
+	pullRequest.User = &github.User{Login: github.String("dependabot[bot]")}
+	pullRequest.Additions = github.Int(120)
+	pullRequest.Deletions = github.Int(30)
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"pr.additions < 500 && pr.author in ['dependabot[bot]']", true},
+		{"pr.additions + pr.deletions > 200", false},
+		{"pr.title.startsWith('chore(deps)') || pr.draft", true},
+		{"!pr.draft && pr.base == \"main\"", true},
+		{"pr.labels.exists(l, l.startsWith('area/'))", true},
+		{"pr.labels.all(l, l.contains('/'))", false},
+		{"size(pr.labels.filter(l, l.matches('^area/'))) == 1", true},
+		{"pr.labels.size() == 2 && pr.labels[0] == 'automerge'", true},
+		{"pr.number % 2 == 1 ? pr.head.endsWith('ure') : false", true},
+		{"'needs-review' in pr.labels", false},
+		{"-pr.additions < -100 && (1 + 2) * 3 == 9", true},
+		{"1 + 2 * 3 == 7 && 10 - 4 - 3 == 3", true},
+		{"true || false && false", true},
+		{"!(pr.draft || pr.additions > 100)", false},
+		{"pr.additions < 150.5", true},
+		{"pr.labels.exists_one(l, l.startsWith('auto'))", true},
+		{"pr.labels.map(l, size(l)) == [9, 7]", true},
+		{"[{'pr': 1}].exists(pr, pr.pr == 1)", true},
+		{"pr.title.contains('yaml') ? pr.commits == 0 : pr.draft", true},
+	}
+	for _, test := range tests {
+		expression, err := ParseExpression(test.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%s) failed: %v", test.source, err)
+			continue
+		}
+		got, err := expression.Matches(pullRequest)
+		if err != nil {
+			t.Errorf("Matches() of %s failed: %v", test.source, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Matches() of %s = %t, want %t", test.source, got, test.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, source := range []string{
+		"pr.size < 10",
+		"author == 'me'",
+		"pr.additions + 'x' < 5 && pr.foo",
+		"pr.labels.exists(l)",
+		"1 + 2",
+		"'title' + 1 == 'title1'",
+		"pr.title == 'unterminated",
+		"pr.additions <",
+		"pr.labels.exists(l, m)",
+		"(pr.draft",
+	} {
+		if _, err := ParseExpression(source); err == nil {
+			t.Errorf("ParseExpression(%s) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestExpressionMatchesErrors(t *testing.T) {
+	for _, source := range []string{
+		"pr.additions",
+		"pr.title < 5",
+		"pr.additions / 0 == 1",
+		"pr.labels[5] == 'x'",
+		"!pr.draft && pr.title",
+		"pr.title.matches('[')",
+		"pr.labels.all(l, l > 1)",
+	} {
+		expression, err := ParseExpression(source)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", source, err)
+		}
+		if _, err := expression.Matches(fakePullRequest(1, "Title", "automerge")); err == nil {
+			t.Errorf("Matches() of %s succeeded, want an error", source)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// DefaultWIPTitlePattern matches the titles of pull requests that are marked
+// as a work in progress by their title rather than by being a draft.
+const DefaultWIPTitlePattern = `(?i)^(WIP\b|\[WIP\]|Draft:)`
+
+// filterPullRequestsByLabels returns the pull requests that carry all of the
+// expected labels if matchAll is set, otherwise those that carry at least one
+// of them.
+func filterPullRequestsByLabels(pullRequests []*github.PullRequest, expectedLabels []string, matchAll bool) []*github.PullRequest {
+	filteredPullRequests := []*github.PullRequest{}
+	for _, pullRequest := range pullRequests {
+		matched := 0
+		for _, expectedLabel := range expectedLabels {
+			if hasLabel(pullRequest, expectedLabel) {
+				matched++
+			}
+		}
+		if (matchAll && matched == len(expectedLabels)) || (!matchAll && matched > 0) {
+			filteredPullRequests = append(filteredPullRequests, pullRequest)
+		}
+	}
+	return filteredPullRequests
+}
+
+// filterIneligiblePullRequests removes any pull requests that shouldn't be
+// merged regardless of the state of their checks, logging why each one was
+// skipped.
+func filterIneligiblePullRequests(ctx context.Context, pullRequests []*github.PullRequest, opts *Options) []*github.PullRequest {
+	filteredPullRequests := []*github.PullRequest{}
+	for _, pullRequest := range pullRequests {
+		if reason := skipReason(pullRequest, opts); reason != "" {
+			logInfo(ctx, pullRequestFields(pullRequest).with("decision", "skipped").with("cause", "ineligible"), "Skipping pull request %d as %s", pullRequest.GetNumber(), reason)
+			continue
+		}
+		filteredPullRequests = append(filteredPullRequests, pullRequest)
+	}
+	return filteredPullRequests
+}
+
+// skipReason returns why the pull request isn't eligible to be merged, or an
+// empty string if it is.
+func skipReason(pullRequest *github.PullRequest, opts *Options) string {
+	for _, blockLabel := range opts.BlockLabels {
+		if hasLabel(pullRequest, blockLabel) {
+			return fmt.Sprintf("it has the block label %s", blockLabel)
+		}
+	}
+	if isExcluded(pullRequest, opts.ExcludedPullRequests) {
+		return "it is excluded by -exclude-pr"
+	}
+	if opts.TitlePattern != nil && !opts.TitlePattern.MatchString(pullRequest.GetTitle()) {
+		return fmt.Sprintf("its title doesn't match %s", opts.TitlePattern)
+	}
+	if pullRequest.GetDraft() && !opts.AllowDrafts {
+		return "it is a draft"
+	}
+	if opts.ConventionalCommits && opts.MergeMethod == "squash" && !isConventionalCommit(pullRequest.GetTitle()) {
+		return "its title isn't a Conventional Commit, which it would be squashed into"
+	}
+	if opts.WIPTitlePattern != nil && opts.WIPTitlePattern.MatchString(pullRequest.GetTitle()) {
+		return "its title marks it as a work in progress"
+	}
+	if len(opts.AllowedAuthors) > 0 && !isAllowedAuthor(pullRequest.GetUser().GetLogin(), opts.AllowedAuthors) {
+		return fmt.Sprintf("its author %s isn't one of %s", pullRequest.GetUser().GetLogin(), strings.Join(opts.AllowedAuthors, ", "))
+	}
+	if opts.DependabotMaxBump != "" && isDependabotPullRequest(pullRequest) {
+		if reason := dependabotSkipReason(pullRequest, opts.DependabotMaxBump); reason != "" {
+			return reason
+		}
+	}
+	if opts.Renovate && isRenovatePullRequest(pullRequest) {
+		if reason := renovateSkipReason(pullRequest); reason != "" {
+			return reason
+		}
+	}
+	if age := time.Since(pullRequest.GetCreatedAt()); opts.MinAge > 0 && age < opts.MinAge {
+		return fmt.Sprintf("it was opened %s ago, less than the minimum age of %s", age.Round(time.Minute), opts.MinAge)
+	} else if opts.MaxAge > 0 && age > opts.MaxAge {
+		return fmt.Sprintf("it was opened %s ago, more than the maximum age of %s", age.Round(time.Minute), opts.MaxAge)
+	}
+	if len(opts.BaseBranches) > 0 && !matchesAny(pullRequest.GetBase().GetRef(), opts.BaseBranches) {
+		return fmt.Sprintf("its base branch %s isn't one of %s", pullRequest.GetBase().GetRef(), strings.Join(opts.BaseBranches, ", "))
+	}
+	return ""
+}
+
+// isExcluded reports whether the pull request is one of the excluded pull
+// requests, given as either its number or <owner>/<repo>#<number>.
+func isExcluded(pullRequest *github.PullRequest, excluded []string) bool {
+	number := strconv.Itoa(pullRequest.GetNumber())
+	fullName := pullRequest.GetBase().GetRepo().GetFullName() + "#" + number
+	for _, reference := range excluded {
+		if reference == number || strings.EqualFold(reference, fullName) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePullRequestReferences checks that each reference is either a pull
+// request number or <owner>/<repo>#<number>.
+func ValidatePullRequestReferences(references []string) error {
+	for _, reference := range references {
+		number := reference
+		if i := strings.LastIndex(reference, "#"); i >= 0 {
+			if _, err := ParseRepository(reference[:i]); err != nil {
+				return fmt.Errorf("%s: %w", reference, err)
+			}
+			number = reference[i+1:]
+		}
+		if n, err := strconv.Atoi(number); err != nil || n < 1 {
+			return fmt.Errorf("%s isn't a pull request number or <owner>/<repo>#<number>", reference)
+		}
+	}
+	return nil
+}
+
+func isAllowedAuthor(author string, allowedAuthors []string) bool {
+	for _, allowedAuthor := range allowedAuthors {
+		if strings.EqualFold(author, allowedAuthor) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLabel(pullRequest *github.PullRequest, expectedLabel string) bool {
+	for _, label := range pullRequest.Labels {
+		if label.GetName() == expectedLabel {
+			return true
+		}
+	}
+	return false
+}
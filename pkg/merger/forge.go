@@ -0,0 +1,200 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Forge is a forge other than GitHub hosting repositories whose pull requests
+// merger checks and merges. GitHub itself is used through its client, as
+// merger supports much more of it than a Forge exposes. Pull requests are
+// described with go-github's PullRequest whichever forge they are on, so that
+// the Policy applies to all of them alike. Forges fill in at least the number,
+// title, author, labels, draft state, head and base refs, the head SHA and the
+// full name of the base repository.
+type Forge interface {
+	// ListCandidates returns the open pull requests in the repository that
+	// have the labels, or all of them if matchAll is set.
+	ListCandidates(ctx context.Context, repo Repository, labels []string, matchAll bool) ([]*github.PullRequest, error)
+	// CheckStatus reports whether the checks and reviews the policy asks
+	// for have passed on the pull request.
+	CheckStatus(ctx context.Context, repo Repository, pullRequest *github.PullRequest, policy *Policy) (CheckStatus, error)
+	// Merge merges the pull request with the merge method, as long as its
+	// head hasn't moved, and returns the SHA of the resulting commit. An
+	// empty title leaves the commit title up to the forge.
+	Merge(ctx context.Context, repo Repository, pullRequest *github.PullRequest, mergeMethod, title, message string) (string, error)
+	// Comment posts the body as a comment on the pull request, or updates
+	// the comment containing the marker if there already is one.
+	Comment(ctx context.Context, repo Repository, pullRequest *github.PullRequest, marker, body string) error
+}
+
+// CheckStatus is whether a pull request's checks and reviews have passed.
+type CheckStatus struct {
+	Passed bool
+	// Cause is a short name for what is blocking the pull request, such as
+	// checks or approvals, and Reason describes it.
+	Cause  string
+	Reason string
+	// Blocking are the checks that haven't passed.
+	Blocking []BlockingCheck
+}
+
+// NewWithForge creates a Merger that checks and merges pull requests on the
+// forge as opts says. Only the options that apply to every forge are used:
+// labels, the Policy, ordering, the merge method and messages, comments on
+// blocked pull requests, merge commands, -max-merges, dry runs, reports and
+// notifications. Repositories can't define their own config on other forges.
+func NewWithForge(forge Forge, opts *Options) *Merger {
+	return &Merger{forge: forge, opts: opts, blocked: newBlockedTracker(), decisions: newDecisionTracker()}
+}
+
+// processForgeRepositories processes the repositories on the Merger's forge.
+func (m *Merger) processForgeRepositories(ctx context.Context, repos []Repository) error {
+	ctx, cancel := withTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "run", nil)
+	err := m.processRepositories(ctx, repos, func(ctx context.Context, repo Repository, opts *Options) (result, error) {
+		return processForgeRepository(ctx, m.forge, repo, opts)
+	})
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("run didn't finish within the -timeout of %s: %w", m.opts.Timeout, err)
+	}
+	span.end(err)
+	return err
+}
+
+// processForgeRepository checks and merges the pull requests in the
+// repository that match the labels in opts, like processRepository does for
+// GitHub.
+func processForgeRepository(ctx context.Context, forge Forge, repo Repository, opts *Options) (result, error) {
+	pullRequests, err := forge.ListCandidates(ctx, repo, opts.Labels, opts.MatchAll)
+	if err != nil {
+		return result{}, fmt.Errorf("failed to retrieve pull requests from %s: %w", repo, err)
+	}
+	for _, pullRequest := range pullRequests {
+		reportFor(ctx).track(pullRequest)
+	}
+	logDebug(ctx, nil, "Found %d pull requests in %s matching the labels %s", len(pullRequests), repo, strings.Join(opts.Labels, ", "))
+
+	pullRequests = filterIneligiblePullRequests(ctx, pullRequests, opts)
+	sortPullRequests(pullRequests, opts.SortOrder)
+	sortByPriority(pullRequests, opts.PriorityLabels)
+
+	repoResult := result{candidates: len(pullRequests)}
+	for i, pullRequest := range pullRequests {
+		if shuttingDown() {
+			logInfo(ctx, nil, "Shutting down. Not checking the remaining %d pull requests in %s.", len(pullRequests)-i, repo)
+			break
+		}
+		if opts.MaxMerges > 0 && repoResult.merged >= opts.MaxMerges {
+			logInfo(ctx, nil, "Reached the limit of %d merges set by -max-merges. Not checking any more pull requests.", opts.MaxMerges)
+			break
+		}
+
+		pullRequestCtx, span := startSpan(ctx, "evaluate pull request", pullRequestFields(pullRequest))
+		merged, err := checkAndMergeOnForge(pullRequestCtx, forge, repo, pullRequest, opts)
+		span.end(err)
+		if err != nil {
+			logError(ctx, pullRequestFields(pullRequest).with("decision", "failed").with("error", err.Error()), "%v", err)
+			repoResult.failures++
+			repoResult.authFailed = repoResult.authFailed || IsAuthError(err)
+			continue
+		}
+		if merged {
+			repoResult.merged++
+		}
+	}
+	return repoResult, nil
+}
+
+// checkAndMergeOnForge merges the pull request if its checks and reviews
+// have passed, reporting whether it was merged.
+func checkAndMergeOnForge(ctx context.Context, forge Forge, repo Repository, pullRequest *github.PullRequest, opts *Options) (bool, error) {
+	status, err := forge.CheckStatus(ctx, repo, pullRequest, &opts.Policy)
+	if err != nil {
+		return false, fmt.Errorf("failed to check pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	if !status.Passed {
+		logInfo(
+			ctx,
+			pullRequestFields(pullRequest).with("decision", "blocked").with("cause", status.Cause),
+			"Pull request %d is blocked as %s. Not merging it.",
+			pullRequest.GetNumber(),
+			status.Reason,
+		)
+		if opts.CommentOnBlocked && !opts.DryRun && len(status.Blocking) > 0 {
+			comment, err := renderTemplate(opts.BlockedComment, newTemplateData(pullRequest, status.Blocking))
+			if err != nil {
+				return false, fmt.Errorf("failed to render comment for pull request %d: %w", pullRequest.GetNumber(), err)
+			}
+			body := blockedCommentMarker + "\n" + comment
+			if err := forge.Comment(ctx, repo, pullRequest, blockedCommentMarker, body); err != nil {
+				return false, fmt.Errorf("failed to comment on pull request %d: %w", pullRequest.GetNumber(), err)
+			}
+		}
+		return false, nil
+	}
+
+	if outsideMergeWindows(ctx, pullRequest, opts) || heldByFreeze(ctx, pullRequest, opts) {
+		return false, nil
+	}
+	if opts.DryRun {
+		logInfo(ctx, pullRequestFields(pullRequest).with("decision", "would merge"), "Would merge pull request %d (dry run)", pullRequest.GetNumber())
+		return false, nil
+	}
+	if passed, err := preMergeHookPassed(ctx, pullRequest, opts); err != nil || !passed {
+		return false, err
+	}
+	title, message, err := renderCommitMessage(pullRequest, opts)
+	if err != nil {
+		return false, err
+	}
+	sha, err := forge.Merge(ctx, repo, pullRequest, opts.MergeMethod, title, message)
+	if err != nil {
+		return false, fmt.Errorf("Failed to merge pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(ctx, pullRequestFields(pullRequest).with("decision", "merged").with("sha", sha), "Successfully merged pull request %d as commit %s", pullRequest.GetNumber(), sha)
+	runPostMergeHook(ctx, pullRequest, sha, opts)
+	return true, nil
+}
+
+// checkStatus decides whether the checks a forge reported have passed under
+// the policy, like checksPassed does for GitHub. Each check's state is
+// success, a check run conclusion or pending. As pending checks block it, every
+// check that isn't ignored has finished by the time MinChecks is enforced.
+func checkStatus(checks []BlockingCheck, policy *Policy) CheckStatus {
+	blocking := []BlockingCheck{}
+	ignored := 0
+	for _, check := range checks {
+		if matchesAny(check.Name, policy.IgnoreChecks) {
+			ignored++
+			continue
+		}
+		if !isPassingConclusion(check.State, policy.PassingConclusions) {
+			blocking = append(blocking, check)
+		}
+	}
+	for _, pattern := range append(append([]string{}, policy.RequireChecks...), policy.ExpectChecks...) {
+		reported := false
+		for _, check := range checks {
+			if matchesAny(check.Name, []string{pattern}) {
+				reported = true
+				break
+			}
+		}
+		if !reported {
+			blocking = append(blocking, BlockingCheck{Name: pattern, State: "missing"})
+		}
+	}
+	if len(blocking) > 0 {
+		return CheckStatus{Cause: "checks", Reason: "its checks haven't all passed", Blocking: blocking}
+	}
+	if finished := len(checks) - ignored; finished < policy.MinChecks {
+		return CheckStatus{Cause: "too few checks", Reason: fmt.Sprintf("it has %d/%d finished checks", finished, policy.MinChecks)}
+	}
+	return CheckStatus{Passed: true}
+}
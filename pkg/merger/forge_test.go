@@ -0,0 +1,181 @@
+package merger
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// fakeForge is a forge with pull requests whose checks have passed if they
+// are listed in passing.
+type fakeForge struct {
+	pullRequests []*github.PullRequest
+	passing      map[int]bool
+	merged       []int
+	comments     map[int]string
+}
+
+func (p *fakeForge) ListCandidates(ctx context.Context, repo Repository, labels []string, matchAll bool) ([]*github.PullRequest, error) {
+	return filterPullRequestsByLabels(p.pullRequests, labels, matchAll), nil
+}
+
+func (p *fakeForge) CheckStatus(ctx context.Context, repo Repository, pullRequest *github.PullRequest, policy *Policy) (CheckStatus, error) {
+	if p.passing[pullRequest.GetNumber()] {
+		return CheckStatus{Passed: true}, nil
+	}
+	return CheckStatus{
+		Cause:    "checks",
+		Reason:   "its checks haven't all passed",
+		Blocking: []BlockingCheck{{Name: "test", State: "failure"}},
+	}, nil
+}
+
+func (p *fakeForge) Merge(ctx context.Context, repo Repository, pullRequest *github.PullRequest, mergeMethod, title, message string) (string, error) {
+	p.merged = append(p.merged, pullRequest.GetNumber())
+	return "abc123", nil
+}
+
+func (p *fakeForge) Comment(ctx context.Context, repo Repository, pullRequest *github.PullRequest, marker, body string) error {
+	p.comments[pullRequest.GetNumber()] = body
+	return nil
+}
+
+func fakePullRequest(number int, title string, labels ...string) *github.PullRequest {
+	pullRequest := &github.PullRequest{
+		Number: github.Int(number),
+		Title:  github.String(title),
+		Base:   &github.PullRequestBranch{Ref: github.String("main"), Repo: &github.Repository{FullName: github.String("nick96/merger")}},
+		Head:   &github.PullRequestBranch{Ref: github.String("feature"), SHA: github.String("abc")},
+	}
+	for _, label := range labels {
+		pullRequest.Labels = append(pullRequest.Labels, &github.Label{Name: github.String(label)})
+	}
+	return pullRequest
+}
+
+func TestProcessForgeRepository(t *testing.T) {
+	forge := &fakeForge{
+		pullRequests: []*github.PullRequest{
+			fakePullRequest(1, "Passing", "automerge"),
+			fakePullRequest(2, "Failing", "automerge"),
+			fakePullRequest(3, "Unlabelled"),
+			fakePullRequest(4, "WIP: passing", "automerge"),
+		},
+		passing:  map[int]bool{1: true, 3: true, 4: true},
+		comments: map[int]string{},
+	}
+	opts := &Options{
+		Policy: Policy{
+			Labels:          []string{"automerge"},
+			WIPTitlePattern: regexp.MustCompile(DefaultWIPTitlePattern),
+		},
+		MergeMethod:      "merge",
+		MergeMessage:     DefaultMergeMessage,
+		BlockedComment:   DefaultBlockedComment,
+		CommentOnBlocked: true,
+	}
+
+	repo := Repository{owner: "nick96", name: "merger"}
+	repoResult, err := processForgeRepository(context.Background(), forge, repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repoResult.candidates != 2 || repoResult.merged != 1 || repoResult.failures != 0 {
+		t.Errorf("processForgeRepository() = %+v, want 2 candidates and 1 merged", repoResult)
+	}
+	if len(forge.merged) != 1 || forge.merged[0] != 1 {
+		t.Errorf("merged %v, want [1]", forge.merged)
+	}
+	if _, ok := forge.comments[2]; !ok || len(forge.comments) != 1 {
+		t.Errorf("commented on %v, want only 2", forge.comments)
+	}
+}
+
+func TestProcessForgeRepositoryDryRun(t *testing.T) {
+	forge := &fakeForge{
+		pullRequests: []*github.PullRequest{fakePullRequest(1, "Passing", "automerge")},
+		passing:      map[int]bool{1: true},
+		comments:     map[int]string{},
+	}
+	opts := &Options{
+		Policy:       Policy{Labels: []string{"automerge"}},
+		MergeMethod:  "merge",
+		MergeMessage: DefaultMergeMessage,
+		DryRun:       true,
+	}
+
+	repo := Repository{owner: "nick96", name: "merger"}
+	repoResult, err := processForgeRepository(context.Background(), forge, repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repoResult.candidates != 1 || repoResult.merged != 0 {
+		t.Errorf("processForgeRepository() = %+v, want 1 candidate and nothing merged", repoResult)
+	}
+	if len(forge.merged) != 0 {
+		t.Errorf("merged %v in a dry run, want nothing", forge.merged)
+	}
+}
+
+func TestProcessForgeRepositoryFrozen(t *testing.T) {
+	forge := &fakeForge{
+		pullRequests: []*github.PullRequest{fakePullRequest(1, "Passing", "automerge")},
+		passing:      map[int]bool{1: true},
+		comments:     map[int]string{},
+	}
+	now := time.Now()
+	freeze, err := ParseFreeze(now.AddDate(0, 0, -1).Format("2006-01-02")+"/"+now.AddDate(0, 0, 1).Format("2006-01-02"), time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReport()
+	ctx := withReport(context.Background(), r)
+	opts := frozenOptions(ctx, &Options{
+		Policy:       Policy{Labels: []string{"automerge"}},
+		MergeMethod:  "merge",
+		MergeMessage: DefaultMergeMessage,
+		Freezes:      []Freeze{freeze},
+	})
+
+	repo := Repository{owner: "nick96", name: "merger"}
+	repoResult, err := processForgeRepository(ctx, forge, repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repoResult.merged != 0 || len(forge.merged) != 0 {
+		t.Errorf("processForgeRepository() = %+v and merged %v during a freeze, want nothing merged", repoResult, forge.merged)
+	}
+	if entry := r.byKey["nick96/merger#1"]; entry == nil || entry.decision != "blocked" || entry.cause != "freeze" {
+		t.Errorf("pull request 1 was %+v, want blocked (freeze)", entry)
+	}
+}
+
+func TestCheckStatusMinChecks(t *testing.T) {
+	checks := []BlockingCheck{
+		{Name: "build", State: "success"},
+		{Name: "lint", State: "success"},
+	}
+	tests := []struct {
+		name   string
+		checks []BlockingCheck
+		policy Policy
+		want   string
+	}{
+		{"enough checks", checks, Policy{MinChecks: 2}, ""},
+		{"too few checks", checks, Policy{MinChecks: 3}, "too few checks"},
+		{"ignored checks don't count", checks, Policy{IgnoreChecks: []string{"lint"}, MinChecks: 2}, "too few checks"},
+		{"no checks", nil, Policy{MinChecks: 1}, "too few checks"},
+		{"pending check", []BlockingCheck{{Name: "build", State: "pending"}}, Policy{MinChecks: 2}, "checks"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := checkStatus(test.checks, &test.policy)
+			if status.Passed != (test.want == "") || status.Cause != test.want {
+				t.Errorf("checkStatus() = %+v, want cause %q", status, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// giteaForge is the Forge for Gitea and Forgejo, which share an API.
+type giteaForge struct {
+	api     *restClient
+	perPage int
+}
+
+// NewGiteaForge returns the Forge for the Gitea or Forgejo API at apiURL,
+// such as https://codeberg.org/api/v1, authenticating with an access token.
+func NewGiteaForge(httpClient *http.Client, apiURL, token string, perPage int) Forge {
+	return &giteaForge{
+		api: &restClient{
+			httpClient: httpClient,
+			baseURL:    apiURL,
+			headers:    map[string]string{"Authorization": "token " + token},
+		},
+		perPage: perPage,
+	}
+}
+
+// giteaPullRequest is the subset of a Gitea pull request merger uses.
+type giteaPullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Draft bool `json:"draft"`
+	Head  struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	HTMLURL        string    `json:"html_url"`
+	Mergeable      bool      `json:"mergeable"`
+	MergeCommitSHA string    `json:"merge_commit_sha"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// pullRequest converts the Gitea pull request into a pull request in the
+// repository.
+func (pr *giteaPullRequest) pullRequest(repo Repository) *github.PullRequest {
+	pullRequest := &github.PullRequest{
+		Number:    github.Int(pr.Number),
+		Title:     github.String(pr.Title),
+		Body:      github.String(pr.Body),
+		User:      &github.User{Login: github.String(pr.User.Login)},
+		Draft:     github.Bool(pr.Draft),
+		HTMLURL:   github.String(pr.HTMLURL),
+		CreatedAt: &pr.CreatedAt,
+		UpdatedAt: &pr.UpdatedAt,
+		Head:      &github.PullRequestBranch{Ref: github.String(pr.Head.Ref), SHA: github.String(pr.Head.SHA)},
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(pr.Base.Ref),
+			Repo: &github.Repository{FullName: github.String(repo.String())},
+		},
+		Mergeable: github.Bool(pr.Mergeable),
+	}
+	if !pr.Mergeable {
+		pullRequest.MergeableState = github.String("dirty")
+	}
+	for _, label := range pr.Labels {
+		pullRequest.Labels = append(pullRequest.Labels, &github.Label{Name: github.String(label.Name)})
+	}
+	return pullRequest
+}
+
+// repoPath is the path of the repository's API.
+func (p *giteaForge) repoPath(repo Repository) string {
+	return "/repos/" + url.PathEscape(repo.owner) + "/" + url.PathEscape(repo.name)
+}
+
+func (p *giteaForge) ListCandidates(ctx context.Context, repo Repository, labels []string, matchAll bool) ([]*github.PullRequest, error) {
+	pullRequests := []*github.PullRequest{}
+	for page := 1; ; page++ {
+		var giteaPullRequests []*giteaPullRequest
+		_, err := p.api.do(
+			ctx,
+			http.MethodGet,
+			fmt.Sprintf("%s/pulls?state=open&limit=%d&page=%d", p.repoPath(repo), p.perPage, page),
+			nil,
+			&giteaPullRequests,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range giteaPullRequests {
+			pullRequests = append(pullRequests, pr.pullRequest(repo))
+		}
+		// Gitea caps the page size, which may be less than perPage.
+		if len(giteaPullRequests) == 0 {
+			break
+		}
+	}
+	return filterPullRequestsByLabels(pullRequests, labels, matchAll), nil
+}
+
+// giteaState returns the state of a Gitea commit status as a check run
+// conclusion, or pending if it hasn't finished.
+func giteaState(state string) string {
+	switch state {
+	case "success":
+		return "success"
+	case "failure", "error":
+		return "failure"
+	case "warning":
+		return "neutral"
+	default:
+		return "pending"
+	}
+}
+
+func (p *giteaForge) CheckStatus(ctx context.Context, repo Repository, pullRequest *github.PullRequest, policy *Policy) (CheckStatus, error) {
+	if !pullRequest.GetMergeable() {
+		return CheckStatus{Cause: "conflicts", Reason: "it can't be merged cleanly"}, nil
+	}
+
+	var combined struct {
+		Statuses []struct {
+			Context   string `json:"context"`
+			Status    string `json:"status"`
+			TargetURL string `json:"target_url"`
+		} `json:"statuses"`
+	}
+	ref := url.PathEscape(pullRequest.GetHead().GetSHA())
+	if _, err := p.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/commits/%s/status", p.repoPath(repo), ref), nil, &combined); err != nil {
+		return CheckStatus{}, fmt.Errorf("failed to get commit statuses: %w", err)
+	}
+	checks := []BlockingCheck{}
+	for _, status := range combined.Statuses {
+		checks = append(checks, BlockingCheck{Name: status.Context, State: giteaState(status.Status), URL: status.TargetURL})
+	}
+	if status := checkStatus(checks, policy); !status.Passed {
+		return status, nil
+	}
+
+	if policy.RequiredApprovals > 0 {
+		var reviews []struct {
+			State string `json:"state"`
+			User  struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			Stale     bool `json:"stale"`
+			Dismissed bool `json:"dismissed"`
+		}
+		path := fmt.Sprintf("%s/pulls/%d/reviews", p.repoPath(repo), pullRequest.GetNumber())
+		if _, err := p.api.do(ctx, http.MethodGet, path, nil, &reviews); err != nil {
+			return CheckStatus{}, fmt.Errorf("failed to get reviews: %w", err)
+		}
+		approvers := map[string]bool{}
+		for _, review := range reviews {
+			// Reviews are in the order they were made, so a later review
+			// replaces an earlier approval.
+			approvers[review.User.Login] = review.State == "APPROVED" && !review.Stale && !review.Dismissed
+		}
+		approved := 0
+		for _, approves := range approvers {
+			if approves {
+				approved++
+			}
+		}
+		if approved < policy.RequiredApprovals {
+			return CheckStatus{
+				Cause:  "approvals",
+				Reason: fmt.Sprintf("it has %d/%d required approvals", approved, policy.RequiredApprovals),
+			}, nil
+		}
+	}
+	return CheckStatus{Passed: true}, nil
+}
+
+func (p *giteaForge) Merge(ctx context.Context, repo Repository, pullRequest *github.PullRequest, mergeMethod, title, message string) (string, error) {
+	path := fmt.Sprintf("%s/pulls/%d", p.repoPath(repo), pullRequest.GetNumber())
+	body := map[string]string{
+		"Do":                mergeMethod,
+		"MergeTitleField":   title,
+		"MergeMessageField": message,
+		// Only merge the commit whose checks were evaluated.
+		"head_commit_id": pullRequest.GetHead().GetSHA(),
+	}
+	if _, err := p.api.do(ctx, http.MethodPost, path+"/merge", body, nil); err != nil {
+		return "", err
+	}
+	// Merging doesn't respond with anything, so the commit has to be looked
+	// up afterwards.
+	var merged giteaPullRequest
+	if _, err := p.api.do(ctx, http.MethodGet, path, nil, &merged); err != nil {
+		return "", fmt.Errorf("failed to retrieve merged pull request: %w", err)
+	}
+	return merged.MergeCommitSHA, nil
+}
+
+func (p *giteaForge) Comment(ctx context.Context, repo Repository, pullRequest *github.PullRequest, marker, body string) error {
+	commentsPath := fmt.Sprintf("%s/issues/%d/comments", p.repoPath(repo), pullRequest.GetNumber())
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	if _, err := p.api.do(ctx, http.MethodGet, commentsPath, nil, &comments); err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if !strings.Contains(comment.Body, marker) {
+			continue
+		}
+		if comment.Body == body {
+			return nil
+		}
+		_, err := p.api.do(ctx, http.MethodPatch, fmt.Sprintf("%s/issues/comments/%d", p.repoPath(repo), comment.ID), map[string]string{"body": body}, nil)
+		return err
+	}
+	_, err := p.api.do(ctx, http.MethodPost, commentsPath, map[string]string{"body": body}, nil)
+	return err
+}
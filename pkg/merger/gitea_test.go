@@ -0,0 +1,18 @@
+package merger
+
+import "testing"
+
+func TestGiteaState(t *testing.T) {
+	tests := map[string]string{
+		"success": "success",
+		"failure": "failure",
+		"error":   "failure",
+		"warning": "neutral",
+		"pending": "pending",
+	}
+	for state, want := range tests {
+		if got := giteaState(state); got != want {
+			t.Errorf("giteaState(%s) = %s, want %s", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// DefaultGitLabAPIURL is the API of gitlab.com.
+const DefaultGitLabAPIURL = "https://gitlab.com/api/v4"
+
+// gitLabForge is the Forge for GitLab, whose merge requests merger
+// treats as pull requests.
+type gitLabForge struct {
+	api     *restClient
+	perPage int
+}
+
+// NewGitLabForge returns the Forge for the GitLab API at apiURL, such as
+// DefaultGitLabAPIURL, authenticating with a personal, group or project
+// access token.
+func NewGitLabForge(httpClient *http.Client, apiURL, token string, perPage int) Forge {
+	return &gitLabForge{
+		api: &restClient{
+			httpClient: httpClient,
+			baseURL:    apiURL,
+			headers:    map[string]string{"PRIVATE-TOKEN": token},
+		},
+		perPage: perPage,
+	}
+}
+
+// gitLabMergeRequest is the subset of a GitLab merge request merger uses.
+type gitLabMergeRequest struct {
+	IID         int    `json:"iid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Author      struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Labels         []string  `json:"labels"`
+	Draft          bool      `json:"draft"`
+	WorkInProgress bool      `json:"work_in_progress"`
+	SourceBranch   string    `json:"source_branch"`
+	TargetBranch   string    `json:"target_branch"`
+	SHA            string    `json:"sha"`
+	WebURL         string    `json:"web_url"`
+	HasConflicts   bool      `json:"has_conflicts"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	MergeCommitSHA string    `json:"merge_commit_sha"`
+	SquashSHA      string    `json:"squash_commit_sha"`
+}
+
+// pullRequest converts the merge request into a pull request in the
+// repository.
+func (mr *gitLabMergeRequest) pullRequest(repo Repository) *github.PullRequest {
+	pullRequest := &github.PullRequest{
+		Number:    github.Int(mr.IID),
+		Title:     github.String(mr.Title),
+		Body:      github.String(mr.Description),
+		User:      &github.User{Login: github.String(mr.Author.Username)},
+		Draft:     github.Bool(mr.Draft || mr.WorkInProgress),
+		HTMLURL:   github.String(mr.WebURL),
+		CreatedAt: &mr.CreatedAt,
+		UpdatedAt: &mr.UpdatedAt,
+		Head:      &github.PullRequestBranch{Ref: github.String(mr.SourceBranch), SHA: github.String(mr.SHA)},
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(mr.TargetBranch),
+			Repo: &github.Repository{FullName: github.String(repo.String())},
+		},
+		Mergeable: github.Bool(!mr.HasConflicts),
+	}
+	if mr.HasConflicts {
+		pullRequest.MergeableState = github.String("dirty")
+	}
+	for _, label := range mr.Labels {
+		pullRequest.Labels = append(pullRequest.Labels, &github.Label{Name: github.String(label)})
+	}
+	return pullRequest
+}
+
+// projectPath is the path of the project's API, which takes the project's
+// URL encoded full path in place of its ID.
+func projectPath(repo Repository) string {
+	return "/projects/" + url.PathEscape(repo.String())
+}
+
+func (p *gitLabForge) ListCandidates(ctx context.Context, repo Repository, labels []string, matchAll bool) ([]*github.PullRequest, error) {
+	pullRequests := []*github.PullRequest{}
+	for page := "1"; page != ""; {
+		var mergeRequests []*gitLabMergeRequest
+		headers, err := p.api.do(
+			ctx,
+			http.MethodGet,
+			fmt.Sprintf("%s/merge_requests?state=opened&per_page=%d&page=%s", projectPath(repo), p.perPage, page),
+			nil,
+			&mergeRequests,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, mr := range mergeRequests {
+			pullRequests = append(pullRequests, mr.pullRequest(repo))
+		}
+		page = headers.Get("X-Next-Page")
+	}
+	return filterPullRequestsByLabels(pullRequests, labels, matchAll), nil
+}
+
+// gitLabStatus is the status of a job or an external check on a commit.
+type gitLabStatus struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	AllowFailure bool   `json:"allow_failure"`
+	TargetURL    string `json:"target_url"`
+}
+
+// state returns the status as a check run conclusion, or pending if it
+// hasn't finished. Jobs that are allowed to fail always succeed.
+func (s *gitLabStatus) state() string {
+	switch s.Status {
+	case "success":
+		return "success"
+	case "failed", "canceled", "manual":
+		if s.AllowFailure {
+			return "success"
+		}
+		if s.Status == "failed" {
+			return "failure"
+		}
+		if s.Status == "canceled" {
+			return "cancelled"
+		}
+		return "action_required"
+	case "skipped":
+		return "skipped"
+	default:
+		return "pending"
+	}
+}
+
+func (p *gitLabForge) CheckStatus(ctx context.Context, repo Repository, pullRequest *github.PullRequest, policy *Policy) (CheckStatus, error) {
+	if pullRequest.GetMergeableState() == "dirty" {
+		return CheckStatus{Cause: "conflicts", Reason: "it has conflicts"}, nil
+	}
+
+	checks := []BlockingCheck{}
+	for page := "1"; page != ""; {
+		var statuses []*gitLabStatus
+		headers, err := p.api.do(
+			ctx,
+			http.MethodGet,
+			fmt.Sprintf("%s/repository/commits/%s/statuses?per_page=%d&page=%s", projectPath(repo), pullRequest.GetHead().GetSHA(), p.perPage, page),
+			nil,
+			&statuses,
+		)
+		if err != nil {
+			return CheckStatus{}, fmt.Errorf("failed to get pipeline statuses: %w", err)
+		}
+		for _, status := range statuses {
+			checks = append(checks, BlockingCheck{Name: status.Name, State: status.state(), URL: status.TargetURL})
+		}
+		page = headers.Get("X-Next-Page")
+	}
+	if status := checkStatus(checks, policy); !status.Passed {
+		return status, nil
+	}
+
+	if policy.RequiredApprovals > 0 {
+		var approvals struct {
+			Approved   bool `json:"approved"`
+			ApprovedBy []struct {
+				User struct {
+					Username string `json:"username"`
+				} `json:"user"`
+			} `json:"approved_by"`
+		}
+		_, err := p.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/approvals", projectPath(repo), pullRequest.GetNumber()), nil, &approvals)
+		if err != nil {
+			return CheckStatus{}, fmt.Errorf("failed to get approvals: %w", err)
+		}
+		if !approvals.Approved || len(approvals.ApprovedBy) < policy.RequiredApprovals {
+			return CheckStatus{
+				Cause:  "approvals",
+				Reason: fmt.Sprintf("it has %d/%d required approvals", len(approvals.ApprovedBy), policy.RequiredApprovals),
+			}, nil
+		}
+	}
+	return CheckStatus{Passed: true}, nil
+}
+
+// Merge merges the merge request, squashing it with the squash merge method.
+// GitLab takes the whole commit message at once, so GitLab's usual title is
+// used if title is empty.
+func (p *gitLabForge) Merge(ctx context.Context, repo Repository, pullRequest *github.PullRequest, mergeMethod, title, message string) (string, error) {
+	if mergeMethod == "rebase" {
+		return "", errors.New("GitLab can't merge with the rebase merge method")
+	}
+	if title == "" && mergeMethod == "squash" {
+		title = pullRequest.GetTitle()
+	} else if title == "" {
+		title = fmt.Sprintf("Merge branch '%s' into '%s'", pullRequest.GetHead().GetRef(), pullRequest.GetBase().GetRef())
+	}
+	commitMessage := title + "\n\n" + message
+	body := map[string]interface{}{
+		"sha":    pullRequest.GetHead().GetSHA(),
+		"squash": mergeMethod == "squash",
+	}
+	if mergeMethod == "squash" {
+		body["squash_commit_message"] = commitMessage
+	} else {
+		body["merge_commit_message"] = commitMessage
+	}
+	var merged gitLabMergeRequest
+	_, err := p.api.do(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d/merge", projectPath(repo), pullRequest.GetNumber()), body, &merged)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case merged.MergeCommitSHA != "":
+		return merged.MergeCommitSHA, nil
+	case merged.SquashSHA != "":
+		return merged.SquashSHA, nil
+	default:
+		return merged.SHA, nil
+	}
+}
+
+func (p *gitLabForge) Comment(ctx context.Context, repo Repository, pullRequest *github.PullRequest, marker, body string) error {
+	notesPath := fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(repo), pullRequest.GetNumber())
+	for page := "1"; page != ""; {
+		var notes []struct {
+			ID   int    `json:"id"`
+			Body string `json:"body"`
+		}
+		headers, err := p.api.do(ctx, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%s", notesPath, p.perPage, page), nil, &notes)
+		if err != nil {
+			return err
+		}
+		for _, note := range notes {
+			if !strings.Contains(note.Body, marker) {
+				continue
+			}
+			if note.Body == body {
+				return nil
+			}
+			_, err := p.api.do(ctx, http.MethodPut, notesPath+"/"+strconv.Itoa(note.ID), map[string]string{"body": body}, nil)
+			return err
+		}
+		page = headers.Get("X-Next-Page")
+	}
+	_, err := p.api.do(ctx, http.MethodPost, notesPath, map[string]string{"body": body}, nil)
+	return err
+}
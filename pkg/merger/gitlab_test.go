@@ -0,0 +1,27 @@
+package merger
+
+import "testing"
+
+func TestGitLabStatusState(t *testing.T) {
+	tests := []struct {
+		status       string
+		allowFailure bool
+		want         string
+	}{
+		{"success", false, "success"},
+		{"failed", false, "failure"},
+		{"failed", true, "success"},
+		{"canceled", false, "cancelled"},
+		{"manual", false, "action_required"},
+		{"manual", true, "success"},
+		{"skipped", false, "skipped"},
+		{"running", false, "pending"},
+		{"created", false, "pending"},
+	}
+	for _, test := range tests {
+		status := &gitLabStatus{Status: test.status, AllowFailure: test.allowFailure}
+		if got := status.state(); got != test.want {
+			t.Errorf("state() of %s (allow failure %t) = %s, want %s", test.status, test.allowFailure, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// graphQLPath is the GraphQL endpoint relative to the REST API's base URL.
+// This resolves to https://api.github.com/graphql for GitHub.com and to
+// https://HOST/api/graphql for GitHub Enterprise Server, whose REST API is
+// served from /api/v3/.
+const graphQLPath = "../graphql"
+
+// graphQLError is an error returned in the body of a GraphQL response.
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQLErrors are the errors returned by a GraphQL request. GitHub responds
+// with 200 OK even when a query or mutation fails.
+type graphQLErrors []graphQLError
+
+func (e graphQLErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// graphQL runs the GraphQL query or mutation with the given variables and
+// decodes its data into result, which may be nil.
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, result interface{}) error {
+	request, err := client.NewRequest("POST", graphQLPath, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors graphQLErrors   `json:"errors"`
+	}
+	if _, err := client.Do(ctx, request, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return response.Errors
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Data, result); err != nil {
+		return fmt.Errorf("failed to decode GraphQL response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// hookEnv is the environment merge commands are run with: merger's own,
+// along with the pull request's metadata. mergeSHA is only set after merging.
+func hookEnv(pullRequest *github.PullRequest, mergeMethod, mergeSHA string) []string {
+	env := append(
+		os.Environ(),
+		"MERGER_REPOSITORY="+pullRequest.GetBase().GetRepo().GetFullName(),
+		"MERGER_PR_NUMBER="+strconv.Itoa(pullRequest.GetNumber()),
+		"MERGER_PR_TITLE="+pullRequest.GetTitle(),
+		"MERGER_PR_AUTHOR="+pullRequest.GetUser().GetLogin(),
+		"MERGER_PR_URL="+pullRequest.GetHTMLURL(),
+		"MERGER_PR_BASE="+pullRequest.GetBase().GetRef(),
+		"MERGER_PR_HEAD="+pullRequest.GetHead().GetRef(),
+		"MERGER_PR_HEAD_SHA="+pullRequest.GetHead().GetSHA(),
+		"MERGER_MERGE_METHOD="+mergeMethod,
+	)
+	if mergeSHA != "" {
+		env = append(env, "MERGER_MERGE_SHA="+mergeSHA)
+	}
+	return env
+}
+
+// runHook runs the command with sh for the pull request. A command that
+// exits with a non-zero status returns an *exec.ExitError, wrapped along with
+// what it printed.
+func runHook(ctx context.Context, command string, pullRequest *github.PullRequest, mergeMethod, mergeSHA string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = hookEnv(pullRequest, mergeMethod, mergeSHA)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if trimmed := strings.TrimSpace(string(output)); trimmed != "" {
+			return fmt.Errorf("%w: %s", err, trimmed)
+		}
+		return err
+	}
+	return nil
+}
+
+// preMergeHookPassed runs opts.PreMergeCommand, if there is one, before the
+// pull request is merged, reporting whether it succeeded. A command that
+// fails blocks the pull request, while one that can't be run at all is an
+// error.
+func preMergeHookPassed(ctx context.Context, pullRequest *github.PullRequest, opts *Options) (bool, error) {
+	if opts.PreMergeCommand == "" {
+		return true, nil
+	}
+	err := runHook(ctx, opts.PreMergeCommand, pullRequest, opts.MergeMethod, "")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		logInfo(
+			ctx,
+			pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "pre-merge command"),
+			"Pre-merge command failed for pull request %d: %v. Not merging it.",
+			pullRequest.GetNumber(),
+			err,
+		)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to run pre-merge command for pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	return true, nil
+}
+
+// runPostMergeHook runs opts.PostMergeCommand, if there is one, after the pull
+// request has been merged as mergeSHA. As the pull request has already been
+// merged, the command failing is only logged.
+func runPostMergeHook(ctx context.Context, pullRequest *github.PullRequest, mergeSHA string, opts *Options) {
+	if opts.PostMergeCommand == "" {
+		return
+	}
+	if err := runHook(ctx, opts.PostMergeCommand, pullRequest, opts.MergeMethod, mergeSHA); err != nil {
+		logWarn(ctx, pullRequestFields(pullRequest), "Post-merge command failed for pull request %d: %v", pullRequest.GetNumber(), err)
+	}
+}
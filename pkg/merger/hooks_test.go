@@ -0,0 +1,29 @@
+package merger
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPreMergeHookPassed(t *testing.T) {
+	pullRequest := fakePullRequest(7, "Title", "automerge")
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"", true},
+		{`test "$MERGER_PR_NUMBER" = 7 && test "$MERGER_REPOSITORY" = nick96/merger && test "$MERGER_MERGE_METHOD" = squash`, true},
+		{"exit 1", false},
+	}
+	for _, test := range tests {
+		opts := &Options{MergeMethod: "squash", PreMergeCommand: test.command}
+		passed, err := preMergeHookPassed(context.Background(), pullRequest, opts)
+		if err != nil {
+			t.Errorf("preMergeHookPassed() with %q failed: %v", test.command, err)
+			continue
+		}
+		if passed != test.want {
+			t.Errorf("preMergeHookPassed() with %q = %t, want %t", test.command, passed, test.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package merger
+
+import (
+	"math/rand"
+	"time"
+)
+
+// nextInterval returns how long to wait before the next run. The interval
+// doubles after each run in which nothing changed, up to maxInterval, and
+// goes back to base as soon as something does. It stays at base if
+// maxInterval isn't greater than it.
+func nextInterval(current, base, maxInterval time.Duration, changed bool) time.Duration {
+	if changed || maxInterval <= base {
+		return base
+	}
+	if current*2 > maxInterval {
+		return maxInterval
+	}
+	return current * 2
+}
+
+// withJitter adds a random duration of up to jitter to the interval, so
+// several merger daemons started together don't all hit the API at once.
+func withJitter(interval, jitter time.Duration, random *rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(random.Int63n(int64(jitter)))
+}
@@ -0,0 +1,39 @@
+package merger
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestNextInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     time.Duration
+		maxInterval time.Duration
+		changed     bool
+		want        time.Duration
+	}{
+		{"no backoff", time.Minute, 0, false, time.Minute},
+		{"unchanged doubles", time.Minute, 10 * time.Minute, false, 2 * time.Minute},
+		{"capped at max", 8 * time.Minute, 10 * time.Minute, false, 10 * time.Minute},
+		{"changed resets", 8 * time.Minute, 10 * time.Minute, true, time.Minute},
+	}
+	for _, test := range tests {
+		if got := nextInterval(test.current, time.Minute, test.maxInterval, test.changed); got != test.want {
+			t.Errorf("%s: nextInterval() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	if got := withJitter(time.Minute, 0, random); got != time.Minute {
+		t.Errorf("withJitter() without jitter = %s, want %s", got, time.Minute)
+	}
+	for i := 0; i < 100; i++ {
+		if got := withJitter(time.Minute, 10*time.Second, random); got < time.Minute || got >= time.Minute+10*time.Second {
+			t.Fatalf("withJitter() = %s, want between %s and %s", got, time.Minute, time.Minute+10*time.Second)
+		}
+	}
+}
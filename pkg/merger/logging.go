@@ -0,0 +1,163 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// logFields are structured fields attached to a log line, such as the
+// repository and pull request it is about. They are only written with
+// -log-format json, as text log lines already include what matters in the
+// message.
+type logFields map[string]interface{}
+
+// pullRequestFields returns the fields identifying the pull request.
+func pullRequestFields(pullRequest *github.PullRequest) logFields {
+	return logFields{
+		"repo": pullRequest.GetBase().GetRepo().GetFullName(),
+		"pr":   pullRequest.GetNumber(),
+		"url":  pullRequest.GetHTMLURL(),
+	}
+}
+
+// with returns a copy of the fields with the given field added.
+func (f logFields) with(key string, value interface{}) logFields {
+	fields := logFields{}
+	for k, v := range f {
+		fields[k] = v
+	}
+	fields[key] = value
+	return fields
+}
+
+// Log levels in increasing order of severity.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// logLevel is the least severe level that is logged, set with -log-level.
+var logLevel = levelInfo
+
+// jsonLog writes log lines as JSON objects, one per line.
+type jsonLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// logJSON is set when logging with -log-format json.
+var logJSON *jsonLog
+
+func (l *jsonLog) write(message string, fields logFields) {
+	entry := logFields{}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339)
+	entry["message"] = message
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(logFields{"time": entry["time"], "message": message})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(append(line, '\n'))
+}
+
+// Write lets the standard logger write through the JSON log, so fatal errors
+// are still JSON.
+func (l *jsonLog) Write(p []byte) (int, error) {
+	l.write(strings.TrimSuffix(string(p), "\n"), logFields{"level": "error"})
+	return len(p), nil
+}
+
+// SetLogFormat configures logging to use the given format, either text or
+// json.
+func SetLogFormat(format string) error {
+	switch format {
+	case "text":
+		logJSON = nil
+		return nil
+	case "json":
+		logJSON = &jsonLog{out: os.Stderr}
+		log.SetFlags(0)
+		log.SetOutput(logJSON)
+		return nil
+	default:
+		return fmt.Errorf("log format must be one of text or json. '%s' is not", format)
+	}
+}
+
+// SetLogLevel sets the least severe level that is logged.
+func SetLogLevel(level string) error {
+	value, ok := levelNames[level]
+	if !ok {
+		return fmt.Errorf("log level must be one of debug, info, warn or error. '%s' is not", level)
+	}
+	logLevel = value
+	return nil
+}
+
+// logAt logs the formatted message along with the structured fields, if the
+// level is severe enough, and records it in the report of the run in ctx.
+func logAt(ctx context.Context, level int, name string, fields logFields, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	// Everything is reported, regardless of the log level, so the report
+	// doesn't depend on how verbose the logs are.
+	if r := reportFor(ctx); r != nil {
+		r.record(fields, message)
+	}
+	if level < logLevel {
+		return
+	}
+	if logJSON == nil {
+		log.Print(message)
+		return
+	}
+	logJSON.write(message, fields.with("level", name))
+}
+
+// logDebug logs details that are only useful when troubleshooting, like the
+// state of each check.
+func logDebug(ctx context.Context, fields logFields, format string, args ...interface{}) {
+	logAt(ctx, levelDebug, "debug", fields, format, args...)
+}
+
+// logInfo logs what merger decided to do with pull requests.
+func logInfo(ctx context.Context, fields logFields, format string, args ...interface{}) {
+	logAt(ctx, levelInfo, "info", fields, format, args...)
+}
+
+// logWarn logs failures that don't stop a pull request from being handled.
+func logWarn(ctx context.Context, fields logFields, format string, args ...interface{}) {
+	logAt(ctx, levelWarn, "warn", fields, format, args...)
+}
+
+// logError logs failures to check or merge pull requests.
+func logError(ctx context.Context, fields logFields, format string, args ...interface{}) {
+	logAt(ctx, levelError, "error", fields, format, args...)
+}
+
+// Infof logs an informational message that isn't about a pull request.
+func Infof(format string, args ...interface{}) {
+	logInfo(context.Background(), nil, format, args...)
+}
@@ -0,0 +1,262 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+const (
+	// mergeabilityPollDelay is how long to wait before first re-fetching a
+	// pull request whose mergeability hasn't been computed yet. It doubles
+	// on each attempt, up to mergeabilityPollAttempts attempts.
+	mergeabilityPollDelay    = time.Second
+	mergeabilityPollAttempts = 5
+)
+
+// mergeRetryDelay is how long to wait before retrying a merge, multiplied by
+// the number of attempts so far.
+const mergeRetryDelay = time.Second
+
+// mergePullRequest merges the pull request, retrying when GitHub reports that
+// the base branch was modified while merging. This happens in busy
+// repositories when another pull request is merged at the same time.
+func mergePullRequest(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (*github.PullRequestMergeResult, error) {
+	title, message, err := commitMessage(ctx, client, owner, repoName, pullRequest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var mergeResult *github.PullRequestMergeResult
+		if opts.GraphQLMerge {
+			mergeResult, err = mergePullRequestGraphQL(ctx, client, pullRequest, title, message, opts.MergeMethod)
+		} else {
+			mergeResult, _, err = client.PullRequests.Merge(
+				ctx,
+				owner,
+				repoName,
+				pullRequest.GetNumber(),
+				message,
+				&github.PullRequestOptions{
+					CommitTitle: title,
+					MergeMethod: opts.MergeMethod,
+					// Only merge the commit whose checks were evaluated. If
+					// anything was pushed since, GitHub rejects the merge.
+					SHA: pullRequest.GetHead().GetSHA(),
+				},
+			)
+		}
+		if err == nil {
+			return mergeResult, nil
+		}
+		if !isBaseBranchModifiedError(err) || attempt >= opts.MergeRetries {
+			return nil, err
+		}
+
+		logInfo(
+			ctx,
+			pullRequestFields(pullRequest),
+			"Base branch of pull request %d was modified while merging, retrying (attempt %d/%d)",
+			pullRequest.GetNumber(),
+			attempt+1,
+			opts.MergeRetries,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(mergeRetryDelay * time.Duration(attempt+1)):
+		}
+
+		// Make sure nothing was pushed to the pull request in the meantime,
+		// as its checks would no longer apply.
+		refreshed, _, err := client.PullRequests.Get(ctx, owner, repoName, pullRequest.GetNumber())
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		if refreshed.GetHead().GetSHA() != pullRequest.GetHead().GetSHA() {
+			return nil, fmt.Errorf(
+				"head of pull request %d changed from %s to %s while merging",
+				pullRequest.GetNumber(),
+				pullRequest.GetHead().GetSHA(),
+				refreshed.GetHead().GetSHA(),
+			)
+		}
+		pullRequest = refreshed
+	}
+}
+
+// commitMessage returns the title and message of the commit merging the pull
+// request. An empty title leaves it up to GitHub. Squashed commits credit
+// everyone who contributed to the pull request's commits as co-authors.
+func commitMessage(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (string, string, error) {
+	title, message, err := renderCommitMessage(pullRequest, opts)
+	if err != nil {
+		return "", "", err
+	}
+	if opts.MergeMethod == "squash" {
+		commits, err := listPullRequestCommits(ctx, client, owner, repoName, pullRequest.GetNumber(), opts.PerPage)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to list commits of pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		message = withTrailers(message, coAuthorTrailers(commits, pullRequest.GetUser().GetLogin()))
+	}
+	return title, message, nil
+}
+
+// renderCommitMessage renders the title and message of the commit merging the
+// pull request from the templates in opts, or from the pull request itself
+// with -conventional-commits.
+func renderCommitMessage(pullRequest *github.PullRequest, opts *Options) (string, string, error) {
+	var title, message string
+	if opts.ConventionalCommits && opts.MergeMethod == "squash" {
+		title, message = conventionalCommitMessage(pullRequest)
+	} else {
+		var err error
+		message, err = renderTemplate(opts.MergeMessage, newTemplateData(pullRequest, nil))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to render merge message: %w", err)
+		}
+	}
+	if opts.CommitTitleTemplate != "" {
+		var err error
+		title, err = renderTemplate(opts.CommitTitleTemplate, newTemplateData(pullRequest, nil))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to render commit title: %w", err)
+		}
+	}
+	return title, message, nil
+}
+
+// fetchMergeability retrieves the pull request, waiting for GitHub to compute
+// whether it is mergeable. GitHub does this in the background, so mergeable is
+// often null when a pull request is first fetched.
+func fetchMergeability(ctx context.Context, client *github.Client, owner, repoName string, number int) (*github.PullRequest, error) {
+	delay := mergeabilityPollDelay
+	for attempt := 1; ; attempt++ {
+		pullRequest, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve pull request %d: %w", number, err)
+		}
+		if pullRequest.Mergeable != nil || attempt >= mergeabilityPollAttempts {
+			return pullRequest, nil
+		}
+
+		logDebug(ctx, nil, "Mergeability of pull request %d hasn't been computed yet, checking again in %s", number, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// deleteBranch deletes the head branch of a merged pull request. Branches in
+// forks are left alone as they belong to someone else. Failing to delete the
+// branch is only logged as the pull request has already been merged.
+func deleteBranch(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) {
+	if isFromFork(pullRequest) {
+		logInfo(ctx, pullRequestFields(pullRequest), "Not deleting the branch of pull request %d as it is from a fork", pullRequest.GetNumber())
+		return
+	}
+
+	branch := pullRequest.GetHead().GetRef()
+	if _, err := client.Git.DeleteRef(ctx, owner, repoName, "heads/"+branch); err != nil {
+		logWarn(ctx, pullRequestFields(pullRequest), "Failed to delete branch %s of pull request %d: %v", branch, pullRequest.GetNumber(), err)
+		return
+	}
+	logInfo(ctx, pullRequestFields(pullRequest), "Deleted branch %s of pull request %d", branch, pullRequest.GetNumber())
+}
+
+// removeLabels removes the given labels from a merged pull request so it
+// isn't picked up again if it is reopened. Like deleteBranch, failures are
+// only logged.
+func removeLabels(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, labels []string) {
+	for _, label := range labels {
+		if !hasLabel(pullRequest, label) {
+			continue
+		}
+		if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repoName, pullRequest.GetNumber(), label); err != nil {
+			logWarn(ctx, pullRequestFields(pullRequest), "Failed to remove label %s from pull request %d: %v", label, pullRequest.GetNumber(), err)
+			continue
+		}
+		logInfo(ctx, pullRequestFields(pullRequest), "Removed label %s from pull request %d", label, pullRequest.GetNumber())
+	}
+}
+
+// addLabel adds a label to a pull request to record what merger did with it.
+// Nothing is done if label is empty and failures are only logged.
+func addLabel(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, label string) {
+	if label == "" {
+		return
+	}
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repoName, pullRequest.GetNumber(), []string{label}); err != nil {
+		logWarn(ctx, pullRequestFields(pullRequest), "Failed to add label %s to pull request %d: %v", label, pullRequest.GetNumber(), err)
+	}
+}
+
+// isFromFork reports whether the pull request's branch is in a fork rather
+// than the repository itself.
+func isFromFork(pullRequest *github.PullRequest) bool {
+	return pullRequest.GetHead().GetRepo().GetFullName() != pullRequest.GetBase().GetRepo().GetFullName()
+}
+
+func isBaseBranchModifiedError(err error) bool {
+	var errorResponse *github.ErrorResponse
+	var errs graphQLErrors
+	switch {
+	case errors.As(err, &errorResponse):
+		return errorResponse.Response != nil &&
+			errorResponse.Response.StatusCode == http.StatusMethodNotAllowed &&
+			strings.Contains(errorResponse.Message, "Base branch was modified")
+	case errors.As(err, &errs):
+		return strings.Contains(errs.Error(), "Base branch was modified")
+	default:
+		return false
+	}
+}
+
+const mergePullRequestMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!, $expectedHeadOid: GitObjectID!, $commitHeadline: String, $commitBody: String) {
+  mergePullRequest(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod, expectedHeadOid: $expectedHeadOid, commitHeadline: $commitHeadline, commitBody: $commitBody}) {
+    pullRequest { mergeCommit { oid } }
+  }
+}`
+
+// mergePullRequestGraphQL merges the pull request with GraphQL's
+// mergePullRequest mutation instead of the REST API. GitHub signs the commits
+// it creates for GitHub Apps this way, so pull requests can still be merged
+// into branches that require signed commits.
+func mergePullRequestGraphQL(ctx context.Context, client *github.Client, pullRequest *github.PullRequest, title, message, mergeMethod string) (*github.PullRequestMergeResult, error) {
+	variables := map[string]interface{}{
+		"pullRequestId":   pullRequest.GetNodeID(),
+		"mergeMethod":     strings.ToUpper(mergeMethod),
+		"expectedHeadOid": pullRequest.GetHead().GetSHA(),
+		"commitBody":      message,
+	}
+	// Leaving the headline out lets GitHub pick it, like the REST API does.
+	if title != "" {
+		variables["commitHeadline"] = title
+	}
+	var result struct {
+		MergePullRequest struct {
+			PullRequest struct {
+				MergeCommit struct {
+					Oid string `json:"oid"`
+				} `json:"mergeCommit"`
+			} `json:"pullRequest"`
+		} `json:"mergePullRequest"`
+	}
+	if err := graphQL(ctx, client, mergePullRequestMutation, variables, &result); err != nil {
+		return nil, err
+	}
+	return &github.PullRequestMergeResult{
+		SHA:    github.String(result.MergePullRequest.PullRequest.MergeCommit.Oid),
+		Merged: github.Bool(true),
+	}, nil
+}
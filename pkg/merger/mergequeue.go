@@ -0,0 +1,85 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+)
+
+const mergeQueueQuery = `query($owner: String!, $name: String!, $branch: String!) {
+  repository(owner: $owner, name: $name) {
+    mergeQueue(branch: $branch) {
+      id
+    }
+  }
+}`
+
+const enqueuePullRequestMutation = `mutation($pullRequestId: ID!, $expectedHeadOid: GitObjectID!) {
+  enqueuePullRequest(input: {pullRequestId: $pullRequestId, expectedHeadOid: $expectedHeadOid}) {
+    mergeQueueEntry {
+      position
+    }
+  }
+}`
+
+// hasMergeQueue reports whether the branch has GitHub's merge queue enabled.
+func hasMergeQueue(ctx context.Context, client *github.Client, owner, repoName, branch string) (bool, error) {
+	var result struct {
+		Repository struct {
+			MergeQueue *struct {
+				ID string `json:"id"`
+			} `json:"mergeQueue"`
+		} `json:"repository"`
+	}
+	err := graphQL(ctx, client, mergeQueueQuery, map[string]interface{}{
+		"owner":  owner,
+		"name":   repoName,
+		"branch": branch,
+	}, &result)
+	if err != nil {
+		return false, err
+	}
+	return result.Repository.MergeQueue != nil, nil
+}
+
+// enqueuePullRequest adds the pull request to its base branch's merge queue,
+// which merges it once it passes checks together with the pull requests ahead
+// of it. If the base branch doesn't have a merge queue, false is returned so
+// the pull request can be merged directly.
+func enqueuePullRequest(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) (bool, error) {
+	base := pullRequest.GetBase().GetRef()
+	enabled, err := hasMergeQueue(ctx, client, owner, repoName, base)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether %s has a merge queue: %w", base, err)
+	}
+	if !enabled {
+		return false, nil
+	}
+
+	var result struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				Position int `json:"position"`
+			} `json:"mergeQueueEntry"`
+		} `json:"enqueuePullRequest"`
+	}
+	err = graphQL(ctx, client, enqueuePullRequestMutation, map[string]interface{}{
+		"pullRequestId": pullRequest.GetNodeID(),
+		// Only queue the commit whose checks were evaluated.
+		"expectedHeadOid": pullRequest.GetHead().GetSHA(),
+	}, &result)
+	if err != nil {
+		return false, fmt.Errorf("failed to add pull request %d to the merge queue: %w", pullRequest.GetNumber(), err)
+	}
+	position := result.EnqueuePullRequest.MergeQueueEntry.Position
+	logInfo(
+		ctx,
+		pullRequestFields(pullRequest).with("decision", "queued").with("queue_position", position),
+		"Added pull request %d to the merge queue of %s at position %d",
+		pullRequest.GetNumber(),
+		base,
+		position,
+	)
+	return true, nil
+}
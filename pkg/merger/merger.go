@@ -0,0 +1,892 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Merger checks and merges the pull requests in a set of repositories.
+type Merger struct {
+	client *github.Client
+	// forge is the forge to use instead of the GitHub client, if set.
+	forge Forge
+	opts  *Options
+	// metrics and tracer record what the Merger does, once enabled with
+	// EnableMetrics and EnableTracing.
+	metrics *metrics
+	tracer  *tracer
+	// blocked remembers since when pull requests have been blocked, to
+	// notify about them after -notify-blocked-after, and decisions what was
+	// last decided about them, to only send events when that changes.
+	blocked   *blockedTracker
+	decisions *decisionTracker
+}
+
+// New creates a Merger that uses the client to check and merge pull requests
+// as opts says.
+func New(client *github.Client, opts *Options) *Merger {
+	return &Merger{client: client, opts: opts, blocked: newBlockedTracker(), decisions: newDecisionTracker()}
+}
+
+// EnableMetrics starts counting what the Merger does and returns the handler
+// serving the counts in the Prometheus text format.
+func (m *Merger) EnableMetrics() http.Handler {
+	m.metrics = newMetrics()
+	return m.metrics
+}
+
+// EnableTracing exports traces of each of the Merger's runs to the OTLP over
+// HTTP endpoint.
+func (m *Merger) EnableTracing(endpoint string) error {
+	tracer, err := newTracer(endpoint)
+	if err != nil {
+		return err
+	}
+	m.tracer = tracer
+	return nil
+}
+
+// instrument returns a context carrying the Merger's metrics and tracer, so
+// that what is done with it is recorded in them.
+func (m *Merger) instrument(ctx context.Context) context.Context {
+	return withTracer(withMetrics(ctx, m.metrics), m.tracer)
+}
+
+// Run checks and merges the pull requests in the repositories once, along
+// with those in the organisation's repositories carrying the topic if org is
+// set.
+func (m *Merger) Run(ctx context.Context, repos []Repository, org, topic string) error {
+	_, err := m.run(ctx, repos, org, topic, false)
+	return err
+}
+
+// run is Run, also returning a digest of what happened to each pull request if
+// digest is set, so that runs can be compared.
+func (m *Merger) run(ctx context.Context, repos []Repository, org, topic string, digest bool) (string, error) {
+	ctx = m.instrument(ctx)
+	var r *report
+	if digest || m.metrics != nil || m.opts.reporting() {
+		r = newReport()
+		ctx = withReport(ctx, r)
+	}
+
+	var err error
+	if m.forge != nil {
+		if org != "" {
+			return "", errors.New("organisations can only be used with GitHub")
+		}
+		err = m.processForgeRepositories(ctx, repos)
+	} else {
+		err = m.resolveAndProcessRepositories(ctx, repos, org, topic)
+	}
+	if r == nil {
+		return "", err
+	}
+	return r.digest(), err
+}
+
+// RunEvery runs every interval until the context is cancelled or merger is
+// shut down. Errors from each run are logged rather than stopping it. Each
+// wait is lengthened by up to opts.IntervalJitter, and backs off towards
+// opts.MaxInterval while nothing changes between runs.
+func (m *Merger) RunEvery(ctx context.Context, repos []Repository, org, topic string, interval time.Duration) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	current := interval
+	previousDigest := ""
+	for !shuttingDown() && ctx.Err() == nil {
+		digest, err := m.run(ctx, repos, org, topic, m.opts.MaxInterval > 0)
+		if err != nil {
+			logError(ctx, logFields{"error": err.Error()}, "%v", err)
+		}
+		current = nextInterval(current, interval, m.opts.MaxInterval, err != nil || digest != previousDigest)
+		previousDigest = digest
+		if current > interval {
+			logDebug(ctx, nil, "Nothing changed since the last run. Backing off to running every %s.", current)
+		}
+		timer := time.NewTimer(withJitter(current, m.opts.IntervalJitter, random))
+		select {
+		case <-timer.C:
+		case <-shutdown:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+}
+
+// Serve listens on address for GitHub webhooks signed with secret, checking
+// and merging the pull requests each of them is about, until the context is
+// cancelled or merger is shut down. The organisation's repositories are only
+// discovered once, before listening.
+func (m *Merger) Serve(ctx context.Context, repos []Repository, org, topic, address, secret string) error {
+	if m.forge != nil {
+		return errors.New("webhooks can only be served for GitHub")
+	}
+	repos, err := resolveRepositories(ctx, m.client, repos, org, topic, m.opts.PerPage)
+	if err != nil {
+		return err
+	}
+	logInfo(ctx, nil, "Listening for GitHub webhooks for %d repositories on %s", len(repos), address)
+	handler := newWebhookHandler(m, repos, []byte(secret))
+	server := &http.Server{Addr: address, Handler: handler}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-shutdown:
+		case <-ctx.Done():
+		}
+		// Stop accepting webhooks, then wait for the pull requests from
+		// those already accepted to be checked.
+		if err := server.Shutdown(context.Background()); err != nil {
+			logWarn(ctx, nil, "Failed to stop listening for webhooks: %v", err)
+		}
+		handler.wait()
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// newClient creates a GitHub client that uses the given API URL, or github.com
+// if it is empty.
+func newClient(httpClient *http.Client, apiURL string) (*github.Client, error) {
+	// GitHub Actions sets GITHUB_API_URL on github.com too, but the enterprise
+	// client would add an /api/v3/ suffix that github.com doesn't use.
+	if strings.TrimSpace(apiURL) == "" || strings.TrimSuffix(apiURL, "/") == "https://api.github.com" {
+		return github.NewClient(httpClient), nil
+	}
+	client, err := github.NewEnterpriseClient(apiURL, apiURL, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client for %s: %w", apiURL, err)
+	}
+	return client, nil
+}
+
+// resolveAndProcessRepositories discovers the repositories in the organisation,
+// if one was given, and processes them along with the explicitly given ones.
+func (m *Merger) resolveAndProcessRepositories(ctx context.Context, repos []Repository, org, topic string) error {
+	ctx, cancel := withTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "run", nil)
+	repos, err := resolveRepositories(ctx, m.client, repos, org, topic, m.opts.PerPage)
+	if err == nil {
+		err = m.processRepositories(ctx, repos, func(ctx context.Context, repo Repository, opts *Options) (result, error) {
+			return processRepository(ctx, m.client, repo.owner, repo.name, opts)
+		})
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("run didn't finish within the -timeout of %s: %w", m.opts.Timeout, err)
+	}
+	span.end(err)
+	return err
+}
+
+// withTimeout returns a context that is cancelled once the timeout has passed,
+// or that is never cancelled if the timeout is 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// result counts the pull requests that were checked and those that failed to
+// be checked or merged.
+type result struct {
+	candidates int
+	merged     int
+	failures   int
+	// authFailed is set if any of the failures were caused by GitHub
+	// rejecting merger's credentials or rate limiting it.
+	authFailed bool
+}
+
+// reporting reports whether runs need a report of what happened to each pull
+// request, to output or notify anyone about.
+func (opts *Options) reporting() bool {
+	// GitHub Actions sets GITHUB_STEP_SUMMARY to a file that markdown can be
+	// written to, to be shown on the run's summary page, and GITHUB_OUTPUT to
+	// a file that outputs for later steps can be written to.
+	return os.Getenv("GITHUB_STEP_SUMMARY") != "" || os.Getenv("GITHUB_OUTPUT") != "" || opts.ReportPath != "" || opts.notifying()
+}
+
+// processRepositories processes each of the repositories in turn with process,
+// returning an error summarising the failures across all of them.
+func (m *Merger) processRepositories(ctx context.Context, repos []Repository, process func(context.Context, Repository, *Options) (result, error)) error {
+	opts := m.opts
+	if r := reportFor(ctx); r != nil {
+		defer func() {
+			// Notify about what did happen even if the run timed out.
+			notifyRun(context.Background(), r, opts, m.blocked, m.decisions)
+			if m.metrics != nil {
+				m.metrics.observe(r)
+			}
+			if opts.ReportPath != "" {
+				if err := r.writeFile(opts.ReportPath); err != nil {
+					logWarn(ctx, nil, "Failed to write the report to %s: %v", opts.ReportPath, err)
+				}
+			}
+			if summaryPath := os.Getenv("GITHUB_STEP_SUMMARY"); summaryPath != "" {
+				if err := r.writeStepSummary(summaryPath); err != nil {
+					logWarn(ctx, nil, "Failed to write the GitHub Actions step summary: %v", err)
+				}
+			}
+			if outputPath := os.Getenv("GITHUB_OUTPUT"); outputPath != "" {
+				if err := r.writeOutputs(outputPath, len(repos) > 1); err != nil {
+					logWarn(ctx, nil, "Failed to write the GitHub Actions outputs: %v", err)
+				}
+			}
+		}()
+	}
+	opts = frozenOptions(ctx, opts)
+
+	// Repositories are processed by -repository-concurrency workers. With a
+	// single worker they are processed in order, one after the other.
+	var (
+		mu          sync.Mutex
+		total       result
+		failedRepos int
+		stopped     bool
+		circuitOpen bool
+	)
+	next := make(chan Repository)
+	var wg sync.WaitGroup
+	for worker := 0; worker < opts.RepositoryConcurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repo := range next {
+				// The merge limit applies to the whole run, so each repository
+				// only gets what is left of it.
+				repoOpts := *opts
+				mu.Lock()
+				if !stopped && opts.MaxMerges > 0 {
+					if total.merged >= opts.MaxMerges {
+						logInfo(ctx, nil, "Reached the limit of %d merges set by -max-merges. Not checking any more repositories.", opts.MaxMerges)
+						stopped = true
+					}
+					repoOpts.MaxMerges = opts.MaxMerges - total.merged
+				}
+				skip := stopped || shuttingDown()
+				mu.Unlock()
+				if skip {
+					continue
+				}
+
+				repoCtx, span := startSpan(ctx, "process repository", logFields{"repo": repo.String()})
+				repoResult, err := process(repoCtx, repo, &repoOpts)
+				span.end(err)
+
+				mu.Lock()
+				total.candidates += repoResult.candidates
+				total.merged += repoResult.merged
+				total.failures += repoResult.failures
+				total.authFailed = total.authFailed || repoResult.authFailed
+				if err != nil {
+					logError(ctx, logFields{"repo": repo.String(), "error": err.Error()}, "%v", err)
+					failedRepos++
+					total.authFailed = total.authFailed || IsAuthError(err)
+					if errors.Is(err, errRateLimitLow) && !stopped {
+						logError(ctx, nil, "Not checking any more repositories until the GitHub API rate limit resets.")
+						stopped = true
+					}
+					if errors.Is(err, ErrCircuitOpen) && !stopped {
+						logError(ctx, nil, "Not checking any more repositories as the GitHub API keeps failing.")
+						stopped = true
+					}
+					circuitOpen = circuitOpen || errors.Is(err, ErrCircuitOpen)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, repo := range repos {
+		next <- repo
+	}
+	close(next)
+	wg.Wait()
+
+	logInfo(ctx, nil, "Checked %d pull requests across %d repositories", total.candidates, len(repos))
+	if opts.DryRun {
+		if freeze := activeFreeze(opts.Freezes, time.Now()); freeze != nil {
+			logInfo(ctx, nil, "%s, so nothing was merged.", freeze.describe())
+		}
+	}
+	if circuitOpen {
+		return fmt.Errorf(
+			"gave up after checking %d pull requests and failing to process %d/%d repositories: %w. See the above logs for details",
+			total.candidates,
+			failedRepos,
+			len(repos),
+			ErrCircuitOpen,
+		)
+	}
+	if total.authFailed {
+		return fmt.Errorf(
+			"failed to check and merge %d/%d pull requests and to process %d/%d repositories: %w. See the above logs for details",
+			total.failures,
+			total.candidates,
+			failedRepos,
+			len(repos),
+			ErrAuth,
+		)
+	}
+	if total.failures > 0 || failedRepos > 0 {
+		return fmt.Errorf(
+			"failed to check and merge %d/%d pull requests and to process %d/%d repositories. See the above logs for details",
+			total.failures,
+			total.candidates,
+			failedRepos,
+			len(repos),
+		)
+	}
+	return nil
+}
+
+// getOpenPullRequest retrieves the pull request given by -pr, or nothing if it
+// isn't open.
+func getOpenPullRequest(ctx context.Context, client *github.Client, owner, repoName string, number int) ([]*github.PullRequest, error) {
+	pullRequest, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
+	if err != nil {
+		return nil, err
+	}
+	if pullRequest.GetState() != "open" {
+		logInfo(ctx, pullRequestFields(pullRequest).with("decision", "skipped").with("cause", "closed"), "Skipping pull request %d in %s/%s as it is %s", number, owner, repoName, pullRequest.GetState())
+		return nil, nil
+	}
+	return []*github.PullRequest{pullRequest}, nil
+}
+
+// processRepository checks and merges all the pull requests in the repository
+// that match the labels in opts, as overridden by the repository's config. An
+// error is only returned if the repository itself couldn't be processed,
+// failures for individual pull requests are logged and counted in the result.
+func processRepository(ctx context.Context, client *github.Client, owner, repoName string, opts *Options) (result, error) {
+	repo := owner + "/" + repoName
+	opts, err := repositoryOptions(ctx, client, owner, repoName, opts)
+	if err != nil {
+		return result{}, fmt.Errorf("failed to configure %s: %w", repo, err)
+	}
+
+	var pullRequests []*github.PullRequest
+	var prefetched map[int]*prefetchedPullRequest
+	switch {
+	case opts.PullRequest != 0:
+		pullRequests, err = getOpenPullRequest(ctx, client, owner, repoName, opts.PullRequest)
+	case opts.Search && opts.GraphQL:
+		query := pullRequestSearch(owner, repoName, opts.Labels, opts.MatchAll)
+		pullRequests, prefetched, err = searchPullRequestsGraphQL(ctx, client, query)
+	case opts.Search:
+		query := pullRequestSearch(owner, repoName, opts.Labels, opts.MatchAll)
+		pullRequests, err = searchPullRequests(ctx, client, owner, repoName, query, opts.PerPage)
+	case opts.GraphQL:
+		pullRequests, prefetched, err = listPullRequestsGraphQL(ctx, client, owner, repoName)
+	default:
+		pullRequests, err = listPullRequests(ctx, client, owner, repoName, opts.PerPage)
+	}
+	ctx = withPrefetched(ctx, prefetched)
+	if err != nil {
+		return result{}, fmt.Errorf("failed to retrieve pull requests from %s: %w", repo, err)
+	}
+	logDebug(ctx, nil, "Retrieved a total of %d pull requests from %s", len(pullRequests), repo)
+
+	labelMatch := "any"
+	if opts.MatchAll {
+		labelMatch = "all"
+	}
+	labeledPullRequests := filterPullRequestsByLabels(pullRequests, opts.Labels, opts.MatchAll)
+	if opts.PullRequest != 0 {
+		// -pr checks the pull request whatever its labels.
+		labeledPullRequests = pullRequests
+	}
+	for _, pullRequest := range labeledPullRequests {
+		reportFor(ctx).track(pullRequest)
+	}
+	logDebug(
+		ctx,
+		nil,
+		"Found %d pull requests in %s matching %s of the labels %s",
+		len(labeledPullRequests),
+		repo,
+		labelMatch,
+		strings.Join(opts.Labels, ", "),
+	)
+
+	labeledPullRequests = filterIneligiblePullRequests(ctx, labeledPullRequests, opts)
+	sortPullRequests(labeledPullRequests, opts.SortOrder)
+	sortByPriority(labeledPullRequests, opts.PriorityLabels)
+	labeledPullRequests = orderStacks(labeledPullRequests)
+	labeledPullRequests = orderByDependencies(labeledPullRequests)
+
+	// With -concurrency, pull requests are evaluated up front in parallel, but
+	// are still merged one at a time below.
+	var evaluations []evaluation
+	if opts.Concurrency > 1 && !opts.Serial && !opts.EnableAutoMerge {
+		evaluations = evaluateConcurrently(ctx, client, owner, repoName, labeledPullRequests, opts)
+	}
+
+	repoResult := result{candidates: len(labeledPullRequests)}
+	readyPullRequests := []*github.PullRequest{}
+	for i, pullRequest := range labeledPullRequests {
+		if shuttingDown() {
+			logInfo(ctx, nil, "Shutting down. Not checking the remaining %d pull requests in %s.", len(labeledPullRequests)-i, repo)
+			break
+		}
+		if opts.MaxMerges > 0 && repoResult.merged+len(readyPullRequests) >= opts.MaxMerges {
+			logInfo(ctx, nil, "Reached the limit of %d merges set by -max-merges. Not checking any more pull requests.", opts.MaxMerges)
+			break
+		}
+
+		var merged bool
+		var ready *github.PullRequest
+		var err error
+		pullRequestCtx, span := startSpan(ctx, "evaluate pull request", pullRequestFields(pullRequest))
+		if opts.MergeTrain {
+			if evaluations != nil {
+				ready, err = evaluations[i].ready, evaluations[i].err
+			} else {
+				ready, err = readyToMergeOrStale(pullRequestCtx, client, owner, repoName, pullRequest, opts)
+			}
+			if ready != nil {
+				readyPullRequests = append(readyPullRequests, ready)
+			}
+		} else if opts.Serial {
+			merged, err = mergeSerially(pullRequestCtx, client, owner, repoName, pullRequest, opts)
+		} else if evaluations != nil {
+			err = evaluations[i].err
+			if ready := evaluations[i].ready; ready != nil {
+				merged, err = mergeReady(pullRequestCtx, client, owner, repoName, ready, opts)
+			}
+		} else {
+			merged, err = checkAndMerge(pullRequestCtx, client, owner, repoName, pullRequest, opts)
+		}
+		span.end(err)
+		if merged {
+			repoResult.merged++
+		}
+		if errors.Is(err, errRateLimitLow) {
+			// Every other pull request would fail the same way, so stop
+			// rather than burning through the rest of the rate limit.
+			repoResult.authFailed = true
+			return repoResult, fmt.Errorf("stopped checking pull requests in %s: %w", repo, err)
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			return repoResult, fmt.Errorf("stopped checking pull requests in %s: %w", repo, err)
+		}
+		if err != nil {
+			logError(ctx, pullRequestFields(pullRequest).with("decision", "failed").with("error", err.Error()), "%v", err)
+			addLabel(ctx, client, owner, repoName, pullRequest, opts.FailureLabel)
+			repoResult.failures++
+			repoResult.authFailed = repoResult.authFailed || IsAuthError(err)
+		}
+	}
+	if len(readyPullRequests) > 0 && shuttingDown() {
+		logInfo(ctx, nil, "Shutting down. Not running the merge train for %d pull requests in %s.", len(readyPullRequests), repo)
+	} else if len(readyPullRequests) > 0 {
+		trainCtx, span := startSpan(ctx, "merge train", logFields{"repo": repo, "prs": pullRequestNumbers(readyPullRequests)})
+		merged, failures, err := runMergeTrain(trainCtx, client, owner, repoName, readyPullRequests, opts)
+		span.end(err)
+		repoResult.merged += merged
+		repoResult.failures += failures
+		if err != nil {
+			repoResult.authFailed = repoResult.authFailed || IsAuthError(err)
+			logError(ctx, logFields{"repo": repo, "error": err.Error()}, "%v", err)
+		}
+	}
+
+	if repoResult.failures > 0 {
+		logError(
+			ctx,
+			nil,
+			"Failed to check and merge %d/%d pull requests in %s",
+			repoResult.failures,
+			repoResult.candidates,
+			repo,
+		)
+	}
+	return repoResult, nil
+}
+
+// listPullRequests retrieves every open pull request in the repository,
+// following pagination until the last page has been read.
+func listPullRequests(ctx context.Context, client *github.Client, owner, repoName string, perPage int) ([]*github.PullRequest, error) {
+	opts := &github.PullRequestListOptions{
+		ListOptions: github.ListOptions{PerPage: perPage},
+	}
+	allPullRequests := []*github.PullRequest{}
+	for {
+		pullRequests, resp, err := client.PullRequests.List(ctx, owner, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		allPullRequests = append(allPullRequests, pullRequests...)
+		if resp.NextPage == 0 {
+			return allPullRequests, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// IsValidMergeMethod reports whether mergeMethod is merge, squash or rebase.
+func IsValidMergeMethod(mergeMethod string) bool {
+	switch mergeMethod {
+	case "merge", "squash", "rebase":
+		return true
+	default:
+		return false
+	}
+}
+
+// checkAndMerge merges the pull request if it is ready to be merged. Whether
+// it was merged, or handed off to GitHub to merge, is returned.
+func checkAndMerge(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (bool, error) {
+	if opts.EnableAutoMerge {
+		if merged, err := dependenciesMerged(ctx, client, owner, repoName, pullRequest); err != nil || !merged {
+			return false, err
+		}
+		below, err := stackedOn(ctx, client, owner, repoName, pullRequest)
+		if err != nil {
+			return false, err
+		}
+		if below != nil {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "stacked"),
+				"Pull request %d is stacked on pull request %d which hasn't been merged. Not enabling auto-merge for it.",
+				pullRequest.GetNumber(),
+				below.GetNumber(),
+			)
+			return false, nil
+		}
+		// GitHub would merge the pull request as soon as it is ready,
+		// whatever the time.
+		if outsideMergeWindows(ctx, pullRequest, opts) || heldByFreeze(ctx, pullRequest, opts) {
+			return false, nil
+		}
+		if opts.DryRun {
+			logInfo(ctx, pullRequestFields(pullRequest).with("decision", "would enable auto-merge"), "Would enable auto-merge for pull request %d (dry run)", pullRequest.GetNumber())
+			return false, nil
+		}
+		enabled, err := enableAutoMerge(ctx, client, owner, repoName, pullRequest, opts.MergeMethod)
+		if err != nil {
+			return false, err
+		}
+		if enabled {
+			return true, nil
+		}
+	}
+
+	pullRequest, err := readyToMergeOrStale(ctx, client, owner, repoName, pullRequest, opts)
+	if err != nil || pullRequest == nil {
+		return false, err
+	}
+	return mergeReady(ctx, client, owner, repoName, pullRequest, opts)
+}
+
+// mergeReady merges the pull request, which readyToMerge has found to be ready,
+// or adds it to the merge queue. It reports whether the pull request was
+// merged. Queued pull requests aren't merged yet, and dry runs don't merge
+// anything, so neither counts towards -max-merges.
+func mergeReady(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (bool, error) {
+	if outsideMergeWindows(ctx, pullRequest, opts) || heldByFreeze(ctx, pullRequest, opts) {
+		return false, nil
+	}
+	if opts.DryRun {
+		logInfo(ctx, pullRequestFields(pullRequest).with("decision", "would merge"), "Would merge pull request %d (dry run)", pullRequest.GetNumber())
+		return false, nil
+	}
+
+	if passed, err := preMergeHookPassed(ctx, pullRequest, opts); err != nil || !passed {
+		return false, err
+	}
+
+	if opts.MergeQueue {
+		queued, err := enqueuePullRequest(ctx, client, owner, repoName, pullRequest)
+		if err != nil {
+			return false, err
+		}
+		if queued {
+			return false, nil
+		}
+	}
+
+	mergeResult, err := mergePullRequest(ctx, client, owner, repoName, pullRequest, opts)
+	if err != nil {
+		return false, fmt.Errorf("Failed to merge pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(ctx, pullRequestFields(pullRequest).with("decision", "merged").with("sha", mergeResult.GetSHA()), "Successfully merged pull request %d as commit %s", pullRequest.GetNumber(), mergeResult.GetSHA())
+	afterMerge(ctx, client, owner, repoName, pullRequest, mergeResult.GetSHA(), opts)
+	return true, nil
+}
+
+// afterMerge runs the optional clean up of a pull request that has been
+// merged as mergeSHA.
+func afterMerge(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, mergeSHA string, opts *Options) {
+	runPostMergeHook(ctx, pullRequest, mergeSHA, opts)
+	retargetStackedPullRequests(ctx, client, owner, repoName, pullRequest, opts.PerPage)
+	if opts.DeleteBranch {
+		deleteBranch(ctx, client, owner, repoName, pullRequest)
+	}
+	if opts.RemoveLabelOnMerge {
+		removeLabels(ctx, client, owner, repoName, pullRequest, opts.Labels)
+	}
+	addLabel(ctx, client, owner, repoName, pullRequest, opts.SuccessLabel)
+}
+
+// waitForPendingChecks waits up to opts.WaitTimeout for the pull request's
+// checks to finish, then checks them again. Checks that don't finish in time
+// leave the pull request blocked rather than failing it.
+func waitForPendingChecks(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (CheckStatus, error) {
+	logInfo(
+		ctx,
+		pullRequestFields(pullRequest),
+		"Waiting up to %s for the checks of pull request %d to finish",
+		opts.WaitTimeout,
+		pullRequest.GetNumber(),
+	)
+	_, err := waitForChecks(ctx, client, owner, repoName, pullRequest.GetBase().GetRef(), pullRequest.GetHead().GetSHA(), opts.WaitTimeout, opts)
+	if err != nil && !errors.Is(err, errChecksTimedOut) {
+		return CheckStatus{}, fmt.Errorf("failed to wait for checks of pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	// What was fetched along with the pull request is out of date now.
+	return checksPassed(withPrefetched(ctx, nil), client, owner, repoName, pullRequest, opts)
+}
+
+// readyToMerge checks whether the pull request's checks have passed, it has
+// the approvals it needs and GitHub considers it mergeable. If it is ready to
+// be merged, the freshly fetched pull request is returned. A pull request
+// that is behind its base is updated with UpdateBranch and checked again once
+// its new checks finish. Otherwise nil is returned, after logging why and
+// taking any action that could make it ready on a later run.
+func readyToMerge(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (*github.PullRequest, error) {
+	if merged, err := dependenciesMerged(ctx, client, owner, repoName, pullRequest); err != nil || !merged {
+		return nil, err
+	}
+
+	status, err := checksPassed(ctx, client, owner, repoName, pullRequest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Passed && opts.Wait && checksPending(status.Blocking) {
+		status, err = waitForPendingChecks(ctx, client, owner, repoName, pullRequest, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !status.Passed {
+		fields := pullRequestFields(pullRequest).with("decision", "blocked").with("cause", status.Cause)
+		if status.Cause == "checks" {
+			fields = fields.with("checks", "failing")
+		}
+		logInfo(ctx, fields, "Pull request %d is blocked as %s. Not merging it.", pullRequest.GetNumber(), status.Reason)
+		if opts.RerunFailedChecks > 0 {
+			if err := rerunFailedChecks(ctx, client, owner, repoName, pullRequest, status.Blocking, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.StuckCheckAfter > 0 {
+			if err := handleStuckChecks(ctx, client, owner, repoName, pullRequest, status.Blocking, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.CommentOnBlocked && !opts.DryRun {
+			if err := commentOnBlocked(ctx, client, owner, repoName, pullRequest, status.Blocking, opts); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	if opts.RequiredApprovals > 0 || opts.Codeowners {
+		// Reviews record the commit they were made on, which unlike
+		// commit dates can't be backdated.
+		var headSHA string
+		if opts.FreshApprovals {
+			headSHA = pullRequest.GetHead().GetSHA()
+		}
+		var approvers []string
+		if prefetched := prefetchedFor(ctx, pullRequest); prefetched != nil && prefetched.reviews != nil {
+			approvers = approversFromReviews(prefetched.reviews, headSHA)
+		} else {
+			approvers, err = listApprovers(ctx, client, owner, repoName, pullRequest.GetNumber(), opts.PerPage, headSHA)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get reviews for pull request %d: %w", pullRequest.GetNumber(), err)
+			}
+		}
+		if len(approvers) < opts.RequiredApprovals {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "approvals"),
+				"Pull request %d has %d/%d required approvals. Not merging it.",
+				pullRequest.GetNumber(),
+				len(approvers),
+				opts.RequiredApprovals,
+			)
+			return nil, nil
+		}
+
+		if opts.Codeowners {
+			approved, err := codeownersApproved(ctx, client, owner, repoName, pullRequest, approvers, opts.PerPage)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check code owner approval for pull request %d: %w", pullRequest.GetNumber(), err)
+			}
+			if !approved {
+				return nil, nil
+			}
+		}
+	}
+
+	if opts.RequireSignedCommits || opts.RequireSignOff {
+		commits, err := listPullRequestCommits(ctx, client, owner, repoName, pullRequest.GetNumber(), opts.PerPage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commits of pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		var unverified, missingSignOff []string
+		if opts.RequireSignedCommits {
+			unverified = unverifiedCommits(commits)
+		}
+		if opts.RequireSignOff {
+			missingSignOff = commitsWithoutSignOff(commits)
+		}
+		if len(unverified) > 0 {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "unsigned commits"),
+				"Pull request %d has commits without a verified signature: %s. Not merging it.",
+				pullRequest.GetNumber(),
+				strings.Join(unverified, ", "),
+			)
+			return nil, nil
+		}
+		if len(missingSignOff) > 0 {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "sign-off"),
+				"Pull request %d has commits that their author hasn't signed off: %s. Not merging it.",
+				pullRequest.GetNumber(),
+				strings.Join(missingSignOff, ", "),
+			)
+			return nil, nil
+		}
+	}
+
+	// Listed pull requests don't include their mergeable state, so fetch
+	// the pull request itself before looking at it, unless it was fetched
+	// along with the pull request.
+	refreshed := pullRequest
+	if prefetchedFor(ctx, pullRequest) == nil || pullRequest.Mergeable == nil {
+		refreshed, err = fetchMergeability(ctx, client, owner, repoName, pullRequest.GetNumber())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if refreshed.GetHead().GetSHA() != pullRequest.GetHead().GetSHA() {
+		logInfo(
+			ctx,
+			pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "head moved"),
+			"Head of pull request %d moved from %s to %s while checking it. Not merging it.",
+			pullRequest.GetNumber(),
+			pullRequest.GetHead().GetSHA(),
+			refreshed.GetHead().GetSHA(),
+		)
+		return nil, nil
+	}
+	pullRequest = refreshed
+
+	// Expressions are only evaluated now, as listed pull requests don't say
+	// how large they are.
+	for _, expression := range opts.Expressions {
+		matched, err := expression.Matches(pullRequest)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "expression"),
+				"Pull request %d doesn't satisfy %s. Not merging it.",
+				pullRequest.GetNumber(),
+				expression,
+			)
+			return nil, nil
+		}
+	}
+
+	if opts.OPAPolicy != nil {
+		allowed, reason, err := opaAllowed(ctx, client, owner, repoName, pullRequest, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate the OPA policy for pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		if !allowed {
+			logInfo(
+				ctx,
+				pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "policy"),
+				"Pull request %d isn't allowed by the OPA policy: %s. Not merging it.",
+				pullRequest.GetNumber(),
+				reason,
+			)
+			return nil, nil
+		}
+	}
+
+	// Merging a pull request stacked on another would merge it into the
+	// other's branch rather than the base of the stack.
+	below, err := stackedOn(ctx, client, owner, repoName, pullRequest)
+	if err != nil {
+		return nil, err
+	}
+	if below != nil {
+		logInfo(
+			ctx,
+			pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "stacked"),
+			"Pull request %d is stacked on pull request %d which hasn't been merged. Not merging it.",
+			pullRequest.GetNumber(),
+			below.GetNumber(),
+		)
+		return nil, nil
+	}
+
+	if opts.Renovate && isRenovatePullRequest(pullRequest) && pullRequest.GetMergeableState() == "dirty" {
+		if opts.DryRun {
+			logInfo(ctx, pullRequestFields(pullRequest), "Would ask Renovate to rebase pull request %d (dry run)", pullRequest.GetNumber())
+			return nil, nil
+		}
+		return nil, requestRenovateRebase(ctx, client, owner, repoName, pullRequest)
+	}
+
+	if opts.UpdateBranch && pullRequest.GetMergeableState() == "behind" {
+		if opts.DryRun {
+			logInfo(ctx, pullRequestFields(pullRequest), "Would update the branch of pull request %d (dry run)", pullRequest.GetNumber())
+			return nil, nil
+		}
+		updated, err := updateBranchAndWait(ctx, client, owner, repoName, pullRequest, opts.UpdateBranchTimeout, opts)
+		if err != nil {
+			return nil, err
+		}
+		// Everything is checked again on the new head, which isn't updated
+		// again if the base has moved on in the meantime.
+		updatedOpts := *opts
+		updatedOpts.UpdateBranch = false
+		return readyToMerge(withPrefetched(ctx, nil), client, owner, repoName, updated, &updatedOpts)
+	}
+
+	if !pullRequest.GetMergeable() {
+		return nil, fmt.Errorf(
+			"pull request %d it is not in a mergeable state (state %s)",
+			pullRequest.GetNumber(),
+			pullRequest.GetMergeableState(),
+		)
+	}
+	return pullRequest, nil
+}
@@ -0,0 +1,148 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics holds the counters and gauges served in the Prometheus text format,
+// counting what a Merger has done since metrics were enabled for it.
+type metrics struct {
+	mu        sync.Mutex
+	evaluated int
+	merged    int
+	queued    int
+	failed    int
+	// skipped counts the pull requests that were skipped or blocked by the
+	// cause logged with the decision.
+	skipped            map[string]int
+	apiErrors          int
+	rateLimitRemaining int
+	rateLimitKnown     bool
+	lastRun            time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{skipped: map[string]int{}}
+}
+
+// observe adds the outcome of each pull request in the run's report.
+func (m *metrics) observe(r *report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range r.entries {
+		m.evaluated++
+		switch entry.decision {
+		case "merged":
+			m.merged++
+		case "queued":
+			m.queued++
+		case "failed":
+			m.failed++
+		case "skipped", "blocked":
+			cause := entry.cause
+			if cause == "" {
+				cause = entry.decision
+			}
+			m.skipped[cause]++
+		}
+	}
+	m.lastRun = time.Now()
+}
+
+// observeResponse records the outcome of a request to the GitHub API. resp is
+// nil if the request failed before getting a response.
+func (m *metrics) observeResponse(resp *http.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if resp == nil || resp.StatusCode >= 400 {
+		m.apiErrors++
+	}
+	if resp == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		m.rateLimitRemaining = remaining
+		m.rateLimitKnown = true
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out strings.Builder
+	writeMetric(&out, "merger_pull_requests_evaluated_total", "counter", "Pull requests merger decided what to do with.", m.evaluated)
+	writeMetric(&out, "merger_pull_requests_merged_total", "counter", "Pull requests merged.", m.merged)
+	writeMetric(&out, "merger_pull_requests_queued_total", "counter", "Pull requests added to a merge queue.", m.queued)
+	writeMetric(&out, "merger_pull_requests_failed_total", "counter", "Pull requests that failed to be checked or merged.", m.failed)
+
+	fmt.Fprintf(&out, "# HELP merger_pull_requests_skipped_total Pull requests skipped or blocked, by reason.\n")
+	fmt.Fprintf(&out, "# TYPE merger_pull_requests_skipped_total counter\n")
+	reasons := []string{}
+	for reason := range m.skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(&out, "merger_pull_requests_skipped_total{reason=%q} %d\n", reason, m.skipped[reason])
+	}
+
+	writeMetric(&out, "merger_api_errors_total", "counter", "Requests to the GitHub API that failed.", m.apiErrors)
+	if m.rateLimitKnown {
+		writeMetric(&out, "merger_rate_limit_remaining", "gauge", "Requests left in the current GitHub API rate limit window.", m.rateLimitRemaining)
+	}
+	if !m.lastRun.IsZero() {
+		writeMetric(&out, "merger_last_run_timestamp_seconds", "gauge", "When the last run finished, as a Unix timestamp.", int(m.lastRun.Unix()))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(out.String()))
+}
+
+func writeMetric(out *strings.Builder, name, kind, help string, value int) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+type metricsKey struct{}
+
+// withMetrics returns a context carrying the metrics that runs and requests
+// made with it are counted in. Nothing is counted if m is nil.
+func withMetrics(ctx context.Context, m *metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// metricsFor returns the metrics in ctx, or nil if there aren't any.
+func metricsFor(ctx context.Context) *metrics {
+	m, _ := ctx.Value(metricsKey{}).(*metrics)
+	return m
+}
+
+// metricsTransport records the outcome of every request to the GitHub API in
+// the metrics of the request's context.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if m := metricsFor(req.Context()); m != nil {
+		if err != nil {
+			m.observeResponse(nil)
+		} else {
+			m.observeResponse(resp)
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,191 @@
+package merger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMergedNotification, DefaultBlockedNotification and
+// DefaultFailedNotification are the templates for notifications about merged,
+// persistently blocked and failed pull requests, unless overridden with
+// -merged-notification, -blocked-notification and -failed-notification.
+const (
+	DefaultMergedNotification  = "Merged {{.Repository}}#{{.Number}} {{.Title}} ({{.URL}})"
+	DefaultBlockedNotification = "{{.Repository}}#{{.Number}} {{.Title}} is still blocked: {{.Reason}} ({{.URL}})"
+	DefaultFailedNotification  = "Failed to merge {{.Repository}}#{{.Number}} {{.Title}}: {{.Reason}} ({{.URL}})"
+)
+
+// Notifier sends notifications about pull requests somewhere people will see
+// them.
+type Notifier interface {
+	// notify sends the rendered message about a merged, blocked or failed
+	// event.
+	notify(ctx context.Context, event, message string) error
+	// String names the notifier for logging.
+	String() string
+}
+
+// blockedTracker remembers since when pull requests have been blocked, so
+// they are only notified about once they have been blocked for
+// -notify-blocked-after. It is kept in memory, so it only lasts as long as
+// merger keeps running.
+type blockedTracker struct {
+	mu       sync.Mutex
+	since    map[string]time.Time
+	notified map[string]bool
+}
+
+func newBlockedTracker() *blockedTracker {
+	return &blockedTracker{since: map[string]time.Time{}, notified: map[string]bool{}}
+}
+
+// blocked records that the pull request is blocked and reports whether it
+// has now been blocked for long enough to notify about. It only reports
+// true once for each time the pull request is blocked.
+func (t *blockedTracker) blocked(key string, now time.Time, after time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since, ok := t.since[key]
+	if !ok {
+		since = now
+		t.since[key] = now
+	}
+	if t.notified[key] || now.Sub(since) < after {
+		return false
+	}
+	t.notified[key] = true
+	return true
+}
+
+// unblocked forgets that the pull request was blocked.
+func (t *blockedTracker) unblocked(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.since, key)
+	delete(t.notified, key)
+}
+
+// notifying reports whether merger has been asked to notify anyone about what
+// happens to pull requests.
+func (opts *Options) notifying() bool {
+	return len(opts.Notifiers) > 0 || opts.Emailer != nil || opts.EventWebhook != nil
+}
+
+// notifyRun emails a summary of the run, sends the events for the decisions
+// that changed since the last run, as tracked by decisions, to the event
+// webhook and sends notifications for the pull requests that were merged or
+// failed in it, and those that have been blocked for longer than
+// -notify-blocked-after, as tracked by blocked. Failures to notify are logged
+// rather than failing the run.
+func notifyRun(ctx context.Context, r *report, opts *Options, blocked *blockedTracker, decisions *decisionTracker) {
+	if opts.Emailer != nil {
+		if err := opts.Emailer.sendSummary(r); err != nil {
+			logWarn(ctx, nil, "Failed to email the summary of the run: %v", err)
+		}
+	}
+	if opts.EventWebhook != nil {
+		if err := opts.EventWebhook.sendEvents(ctx, r, decisions); err != nil {
+			logWarn(ctx, nil, "Failed to send events to %s: %v", opts.EventWebhook.url, err)
+		}
+	}
+	if len(opts.Notifiers) == 0 {
+		return
+	}
+
+	type notification struct {
+		event string
+		data  templateData
+	}
+	notifications := []notification{}
+	now := time.Now()
+	r.mu.Lock()
+	for _, entry := range r.entries {
+		key := fmt.Sprintf("%s#%d", entry.repo, entry.number)
+		data := templateData{Repository: entry.repo, Number: entry.number, URL: entry.url, Reason: entry.message}
+		if pullRequest, ok := r.pullRequests[key]; ok {
+			data = newTemplateData(pullRequest, nil)
+			data.Repository = entry.repo
+			data.Reason = entry.message
+		}
+		switch entry.decision {
+		case "merged":
+			blocked.unblocked(key)
+			notifications = append(notifications, notification{event: "merged", data: data})
+		case "blocked":
+			if blocked.blocked(key, now, opts.NotifyBlockedAfter) {
+				notifications = append(notifications, notification{event: "blocked", data: data})
+			}
+		case "failed":
+			blocked.unblocked(key)
+			notifications = append(notifications, notification{event: "failed", data: data})
+		default:
+			blocked.unblocked(key)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, n := range notifications {
+		text := opts.MergedNotification
+		switch n.event {
+		case "blocked":
+			text = opts.BlockedNotification
+		case "failed":
+			text = opts.FailedNotification
+		}
+		message, err := renderTemplate(text, n.data)
+		if err != nil {
+			logWarn(ctx, nil, "Failed to render the %s notification for %s#%d: %v", n.event, n.data.Repository, n.data.Number, err)
+			continue
+		}
+		for _, notifier := range opts.Notifiers {
+			if err := notifier.notify(ctx, n.event, message); err != nil {
+				logWarn(ctx, nil, "Failed to notify %s about %s#%d: %v", notifier, n.data.Repository, n.data.Number, err)
+			}
+		}
+	}
+}
+
+// notificationClient is used to send notifications, with a timeout so an
+// unresponsive service can't hold up merging.
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts the payload as JSON to url, treating any response other than
+// a 2xx as an error.
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, body, nil)
+}
+
+// post posts the JSON body to url with the extra headers, treating any
+// response other than a 2xx as an error.
+func post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("responded with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// OPAPolicy decides whether pull requests may be merged with a Rego policy
+// evaluated by Open Policy Agent, loaded from a bundle so the same policy can
+// be managed centrally for every repository.
+type OPAPolicy struct {
+	query rego.PreparedEvalQuery
+}
+
+// NewOPAPolicy loads the bundle, a directory or .tar.gz file, and prepares the
+// query, such as data.merger, for evaluation. The query must be an object with
+// allow, a bool, and reason, a string explaining why a pull request isn't
+// allowed.
+func NewOPAPolicy(ctx context.Context, bundle, query string) (*OPAPolicy, error) {
+	prepared, err := rego.New(rego.Query(query), rego.LoadBundle(bundle)).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the OPA policy from %s: %w", bundle, err)
+	}
+	return &OPAPolicy{query: prepared}, nil
+}
+
+// opaInput is the input the policy is evaluated with.
+type opaInput struct {
+	Repository  string                 `json:"repository"`
+	PullRequest map[string]interface{} `json:"pull_request"`
+	Checks      []opaCheck             `json:"checks"`
+	Reviews     []opaReview            `json:"reviews"`
+}
+
+// opaCheck is a check run or commit status. Its state is the conclusion of
+// completed check runs, otherwise their status, or the commit status's state.
+type opaCheck struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	URL   string `json:"url,omitempty"`
+}
+
+type opaReview struct {
+	User     string `json:"user"`
+	State    string `json:"state"`
+	CommitID string `json:"commit_id"`
+}
+
+// newOPAInput describes the pull request, its checks and its reviews for the
+// policy. The pull request has the same fields as pr in expressions.
+func newOPAInput(pullRequest *github.PullRequest, checkRuns []*github.CheckRun, statuses []*github.RepoStatus, reviews []*github.PullRequestReview) opaInput {
+	input := opaInput{
+		Repository:  pullRequest.GetBase().GetRepo().GetFullName(),
+		PullRequest: expressionVariables(pullRequest),
+		Checks:      []opaCheck{},
+		Reviews:     []opaReview{},
+	}
+	for _, checkRun := range checkRuns {
+		state := checkRun.GetStatus()
+		if state == "completed" {
+			state = checkRun.GetConclusion()
+		}
+		input.Checks = append(input.Checks, opaCheck{Name: checkRun.GetName(), State: state, URL: checkRun.GetDetailsURL()})
+	}
+	for _, status := range statuses {
+		input.Checks = append(input.Checks, opaCheck{Name: status.GetContext(), State: status.GetState(), URL: status.GetTargetURL()})
+	}
+	for _, review := range reviews {
+		input.Reviews = append(input.Reviews, opaReview{User: review.GetUser().GetLogin(), State: review.GetState(), CommitID: review.GetCommitID()})
+	}
+	return input
+}
+
+// decide evaluates the policy with the input, returning whether the pull
+// request is allowed and, if it isn't, why not.
+func (p *OPAPolicy) decide(ctx context.Context, input opaInput) (bool, string, error) {
+	results, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, "", err
+	}
+	// There are no results if the query is undefined, such as when the bundle
+	// has no policy at its path.
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return false, "", errors.New("the policy didn't make a decision")
+	}
+	document, ok := results[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return false, "", fmt.Errorf("the policy's decision is %v rather than an object", results[0].Expressions[0].Value)
+	}
+	allow, ok := document["allow"].(bool)
+	if !ok {
+		return false, "", errors.New("the policy's decision doesn't have allow")
+	}
+	reason, _ := document["reason"].(string)
+	return allow, reason, nil
+}
+
+// opaAllowed asks the policy whether the pull request may be merged.
+func opaAllowed(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (bool, string, error) {
+	checkRuns, statuses, err := pullRequestChecks(ctx, client, owner, repoName, pullRequest, opts.PerPage)
+	if err != nil {
+		return false, "", err
+	}
+	var reviews []*github.PullRequestReview
+	if prefetched := prefetchedFor(ctx, pullRequest); prefetched != nil && prefetched.reviews != nil {
+		reviews = prefetched.reviews
+	} else {
+		reviews, err = listReviews(ctx, client, owner, repoName, pullRequest.GetNumber(), opts.PerPage)
+		if err != nil {
+			return false, "", err
+		}
+	}
+	return opts.OPAPolicy.decide(ctx, newOPAInput(pullRequest, checkRuns, statuses, reviews))
+}
@@ -0,0 +1,84 @@
+package merger
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestNewOPAInput(t *testing.T) {
+	pullRequest := fakePullRequest(3, "Bump yaml", "automerge")
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("test"), Status: github.String("completed"), Conclusion: github.String("success")},
+		{Name: github.String("lint"), Status: github.String("in_progress")},
+	}
+	statuses := []*github.RepoStatus{{Context: github.String("ci/legacy"), State: github.String("failure")}}
+	reviews := []*github.PullRequestReview{
+		{User: &github.User{Login: github.String("alice")}, State: github.String("APPROVED"), CommitID: github.String("abc")},
+	}
+
+	input := newOPAInput(pullRequest, checkRuns, statuses, reviews)
+	if input.Repository != "nick96/merger" || input.PullRequest["number"] != int64(3) {
+		t.Errorf("newOPAInput() = %+v, want pull request 3 in nick96/merger", input)
+	}
+	wantChecks := []opaCheck{{Name: "test", State: "success"}, {Name: "lint", State: "in_progress"}, {Name: "ci/legacy", State: "failure"}}
+	if len(input.Checks) != len(wantChecks) {
+		t.Fatalf("newOPAInput() checks = %+v, want %+v", input.Checks, wantChecks)
+	}
+	for i, check := range input.Checks {
+		if check != wantChecks[i] {
+			t.Errorf("newOPAInput() check %d = %+v, want %+v", i, check, wantChecks[i])
+		}
+	}
+	if len(input.Reviews) != 1 || input.Reviews[0] != (opaReview{User: "alice", State: "APPROVED", CommitID: "abc"}) {
+		t.Errorf("newOPAInput() reviews = %+v, want alice's approval", input.Reviews)
+	}
+}
+
+func TestOPAPolicy(t *testing.T) {
+	bundle := t.TempDir()
+	policy := `package merger
+
+default allow = false
+
+allow {
+  input.pull_request.changed_files <= 20
+  count([r | r := input.reviews[_]; r.state == "APPROVED"]) >= 1
+}
+
+reason = "it needs an approval and to change at most 20 files"
+`
+	if err := ioutil.WriteFile(filepath.Join(bundle, "policy.rego"), []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opaPolicy, err := NewOPAPolicy(context.Background(), bundle, "data.merger")
+	if err != nil {
+		t.Fatalf("NewOPAPolicy() failed: %v", err)
+	}
+
+	pullRequest := fakePullRequest(3, "Bump yaml", "automerge")
+	pullRequest.ChangedFiles = github.Int(2)
+	approval := []*github.PullRequestReview{{User: &github.User{Login: github.String("alice")}, State: github.String("APPROVED")}}
+	allowed, _, err := opaPolicy.decide(context.Background(), newOPAInput(pullRequest, nil, nil, approval))
+	if err != nil || !allowed {
+		t.Errorf("decide() with an approval = %t, %v, want it allowed", allowed, err)
+	}
+	allowed, reason, err := opaPolicy.decide(context.Background(), newOPAInput(pullRequest, nil, nil, nil))
+	if err != nil || allowed || reason != "it needs an approval and to change at most 20 files" {
+		t.Errorf("decide() without an approval = %t, %q, %v, want it disallowed with the reason", allowed, reason, err)
+	}
+
+	undefined, err := NewOPAPolicy(context.Background(), bundle, "data.other")
+	if err != nil {
+		t.Fatalf("NewOPAPolicy() failed: %v", err)
+	}
+	if _, _, err := undefined.decide(context.Background(), newOPAInput(pullRequest, nil, nil, approval)); err == nil {
+		t.Error("decide() of an undefined document succeeded, want an error")
+	}
+	if _, err := NewOPAPolicy(context.Background(), filepath.Join(bundle, "missing"), "data.merger"); err == nil {
+		t.Error("NewOPAPolicy() of a missing bundle succeeded, want an error")
+	}
+}
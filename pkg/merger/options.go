@@ -0,0 +1,236 @@
+package merger
+
+import (
+	"regexp"
+	"time"
+)
+
+// Policy decides which pull requests may be merged.
+type Policy struct {
+	// Labels are the labels pull requests must have to be considered, all
+	// of them if MatchAll is set, otherwise any of them.
+	Labels   []string
+	MatchAll bool
+	// BlockLabels prevent pull requests with any of them from being merged.
+	BlockLabels []string
+	// AllowDrafts allows draft pull requests to be merged.
+	AllowDrafts bool
+	// BaseBranches are glob patterns the base branch of a pull request must
+	// match for it to be merged. Any base branch is allowed if empty.
+	BaseBranches []string
+	// AllowedAuthors are the logins of the users whose pull requests may be
+	// merged. Any author is allowed if empty.
+	AllowedAuthors []string
+	// MinAge and MaxAge are how long ago pull requests must have been opened
+	// at least and at most for them to be merged. Zero means there is no
+	// limit.
+	MinAge time.Duration
+	MaxAge time.Duration
+	// ExcludedPullRequests are the pull requests never to merge, as numbers
+	// or <owner>/<repo>#<number>.
+	ExcludedPullRequests []string
+	// TitlePattern is what the title of a pull request must match for it to
+	// be merged. Any title is allowed if nil.
+	TitlePattern *regexp.Regexp
+	// WIPTitlePattern matches the titles of pull requests that are still a
+	// work in progress, if not nil.
+	WIPTitlePattern *regexp.Regexp
+	// Expressions must all be true of a pull request for it to be merged.
+	Expressions []*Expression
+	// OPAPolicy must allow a pull request for it to be merged, if set.
+	OPAPolicy *OPAPolicy
+	// DependabotMaxBump is the largest version bump (patch, minor or major)
+	// a Dependabot pull request may make. Any bump is allowed if empty.
+	DependabotMaxBump string
+
+	// RequiredOnly limits the checks that must pass to those required by
+	// the base branch's protection rules.
+	RequiredOnly bool
+	// IgnoreChecks, RequireChecks and ExpectChecks are glob patterns of
+	// check names that are excluded from the decision, that must be reported
+	// and pass, and that only have to be reported, respectively.
+	IgnoreChecks  []string
+	RequireChecks []string
+	ExpectChecks  []string
+	// PassingConclusions are the check run conclusions, besides success,
+	// that count as passing.
+	PassingConclusions []string
+	// MinChecks is the fewest finished check runs and commit statuses a pull
+	// request must have, so it isn't merged when CI wasn't triggered at all.
+	MinChecks int
+	// MinCheckAge is how long the checks must have been finished for before
+	// a pull request is merged, giving people time to object to it.
+	MinCheckAge time.Duration
+
+	// RequiredApprovals is the number of approving reviews a pull request
+	// needs before it is merged.
+	RequiredApprovals int
+	// FreshApprovals only counts approvals of the pull request's head
+	// commit.
+	FreshApprovals bool
+	// Codeowners requires every changed file with code owners to be
+	// approved by one of them.
+	Codeowners bool
+	// RequireSignedCommits only merges pull requests whose commits all have
+	// a verified signature.
+	RequireSignedCommits bool
+	// RequireSignOff only merges pull requests whose commits have all been
+	// signed off by their author.
+	RequireSignOff bool
+}
+
+// Options controls which pull requests are considered and how each of them
+// is checked and merged.
+type Options struct {
+	Policy
+
+	// PriorityLabels order pull requests so those with earlier labels are
+	// merged first.
+	PriorityLabels []string
+	// SortOrder is the order pull requests are checked and merged in, before
+	// PriorityLabels are taken into account.
+	SortOrder string
+	// Renovate enables Renovate specific behaviour for Renovate's pull
+	// requests.
+	Renovate bool
+	// RerunFailedChecks is how many times to re-run each failed check of a
+	// pull request, in case it is flaky. Zero means they aren't re-run.
+	RerunFailedChecks int
+	// StuckCheckAfter is how long a check run may be queued or in progress
+	// before it is reported as stuck. Zero means check runs are never
+	// considered stuck. CancelStuckChecks cancels the workflow runs of stuck
+	// GitHub Actions jobs.
+	StuckCheckAfter   time.Duration
+	CancelStuckChecks bool
+	// UpdateBranch updates pull requests that are behind their base branch
+	// instead of skipping them, then waits up to UpdateBranchTimeout for
+	// their checks to finish to merge them.
+	UpdateBranch        bool
+	UpdateBranchTimeout time.Duration
+	// EnableAutoMerge enables GitHub's auto-merge on eligible pull requests
+	// instead of checking and merging them.
+	EnableAutoMerge bool
+	// MergeQueue adds pull requests to their base branch's merge queue, if it
+	// has one, instead of merging them.
+	MergeQueue bool
+	// MergeTrain merges pull requests that are ready in batches, which are
+	// only merged once the checks on the combined result pass.
+	MergeTrain        bool
+	MergeTrainTimeout time.Duration
+	// Serial makes sure each pull request has been tested against the
+	// latest base branch before merging it, updating it and waiting for its
+	// checks if it hasn't.
+	Serial        bool
+	SerialTimeout time.Duration
+	// Wait waits up to WaitTimeout for the checks of pull requests that are
+	// still running to finish, rather than leaving them for a later run.
+	Wait        bool
+	WaitTimeout time.Duration
+	// CheckTimeouts are how long particular checks may be pending for, from
+	// when they started. Those that take longer count as failed and aren't
+	// waited for.
+	CheckTimeouts []CheckTimeout
+	// MergeWindows are when pull requests may be merged. Pull requests that
+	// are ready outside of them wait for the next one. They may be merged at
+	// any time if there are none.
+	MergeWindows []MergeWindow
+	// Location is the time zone merge windows are in. Nil means the local
+	// time zone.
+	Location *time.Location
+	// Freezes are periods during which runs are dry runs, so pull requests
+	// are only reported on.
+	Freezes []Freeze
+	// FreezeLabel freezes a repository while it has an open issue with the
+	// label, or has it as a topic. Runs are dry runs for frozen repositories.
+	FreezeLabel string
+	// frozen describes the freeze that made the run a dry run, if any, so
+	// that pull requests are reported as held by it rather than as would be
+	// merged.
+	frozen string
+	// MaxMerges is the most pull requests to merge in a single run. Zero
+	// means there is no limit.
+	MaxMerges int
+	// PullRequest is the only pull request to check, whatever its labels, or
+	// zero to check all the labelled pull requests.
+	PullRequest int
+	// ReportPath is where to write a JSON report of each run, if set.
+	ReportPath string
+	// GraphQL fetches pull requests along with their checks, reviews and
+	// mergeability with GraphQL instead of making REST requests for each
+	// pull request.
+	GraphQL bool
+	// Search uses the search API to only fetch the open pull requests with
+	// the labels, rather than listing every open pull request.
+	Search bool
+	// Concurrency is how many pull requests are evaluated at once. They are
+	// always merged one at a time.
+	Concurrency int
+	// RepositoryConcurrency is how many repositories are processed at once.
+	RepositoryConcurrency int
+	// Timeout is how long a run may take, or 0 for no limit.
+	Timeout time.Duration
+	// IntervalJitter is the most to add at random to the interval between
+	// runs in daemon mode.
+	IntervalJitter time.Duration
+	// MaxInterval is how far to back off the interval between runs in daemon
+	// mode while nothing changes, or 0 not to back off.
+	MaxInterval time.Duration
+
+	MergeMethod string
+	PerPage     int
+	DryRun      bool
+	// DeleteBranch deletes the head branch of pull requests after they are
+	// merged.
+	DeleteBranch bool
+	// RemoveLabelOnMerge removes the trigger labels from pull requests after
+	// they are merged.
+	RemoveLabelOnMerge bool
+	// SuccessLabel and FailureLabel are added to pull requests that merger
+	// merged or failed to merge. Empty means no label is added.
+	SuccessLabel string
+	FailureLabel string
+	// CommentOnBlocked comments on pull requests blocked by checks, listing
+	// which checks are blocking them.
+	CommentOnBlocked bool
+	// MergeMessage and BlockedComment are text/template templates for the
+	// merge commit message and the comment posted on blocked pull requests.
+	MergeMessage   string
+	BlockedComment string
+	// CommitTitleTemplate is a text/template template for the title of the
+	// merge commit. GitHub picks the title if empty.
+	CommitTitleTemplate string
+	// GraphQLMerge merges pull requests with GraphQL rather than REST, so
+	// GitHub signs the commits it creates for GitHub Apps.
+	GraphQLMerge bool
+	// ConventionalCommits makes squashed commits follow Conventional Commits,
+	// using the pull request's title and description.
+	ConventionalCommits bool
+	// MergeRetries is how many times to retry a merge when the base branch
+	// is modified while merging.
+	MergeRetries int
+	// StaleAfter is how long a pull request may be blocked for, since it was
+	// labelled, before StaleAction is taken on it: comment, label with
+	// StaleLabel or unlabel. Zero means nothing is done.
+	StaleAfter  time.Duration
+	StaleAction string
+	StaleLabel  string
+	// Notifiers are told about merged and failed pull requests and those that
+	// have been blocked for longer than notifyBlockedAfter, with messages
+	// rendered from the notification templates.
+	Notifiers           []Notifier
+	NotifyBlockedAfter  time.Duration
+	MergedNotification  string
+	BlockedNotification string
+	FailedNotification  string
+	// Emailer emails a summary of each run, if set.
+	Emailer *Emailer
+	// PreMergeCommand and PostMergeCommand are shell commands run before and
+	// after merging each pull request, with its metadata in MERGER_*
+	// environment variables. A failing PreMergeCommand blocks the pull
+	// request. Empty means no command is run.
+	PreMergeCommand  string
+	PostMergeCommand string
+	// EventWebhook is sent an event for each pull request merged, blocked
+	// or failed, if set.
+	EventWebhook *EventWebhook
+}
@@ -0,0 +1,58 @@
+package merger
+
+import (
+	"sort"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// sortPullRequests orders the pull requests by creation or update time. An
+// empty order leaves them in the order GitHub listed them in.
+func sortPullRequests(pullRequests []*github.PullRequest, order string) {
+	var less func(a, b *github.PullRequest) bool
+	switch order {
+	case "oldest":
+		less = func(a, b *github.PullRequest) bool { return a.GetCreatedAt().Before(b.GetCreatedAt()) }
+	case "newest":
+		less = func(a, b *github.PullRequest) bool { return a.GetCreatedAt().After(b.GetCreatedAt()) }
+	case "least-recently-updated":
+		less = func(a, b *github.PullRequest) bool { return a.GetUpdatedAt().Before(b.GetUpdatedAt()) }
+	default:
+		return
+	}
+	sort.SliceStable(pullRequests, func(i, j int) bool {
+		return less(pullRequests[i], pullRequests[j])
+	})
+}
+
+// IsValidSortOrder reports whether order is one of the orders pull requests
+// can be sorted in.
+func IsValidSortOrder(order string) bool {
+	switch order {
+	case "", "oldest", "newest", "least-recently-updated":
+		return true
+	default:
+		return false
+	}
+}
+
+// sortByPriority orders the pull requests by the first of the priority labels
+// they have, so those with earlier labels are merged first. Pull requests
+// without any of the labels come last, and the order is otherwise left as
+// it was.
+func sortByPriority(pullRequests []*github.PullRequest, priorityLabels []string) {
+	if len(priorityLabels) == 0 {
+		return
+	}
+	priority := func(pullRequest *github.PullRequest) int {
+		for i, label := range priorityLabels {
+			if hasLabel(pullRequest, label) {
+				return i
+			}
+		}
+		return len(priorityLabels)
+	}
+	sort.SliceStable(pullRequests, func(i, j int) bool {
+		return priority(pullRequests[i]) < priority(pullRequests[j])
+	})
+}
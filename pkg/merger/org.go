@@ -0,0 +1,76 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// listOrgRepositories retrieves the repositories in the organisation that
+// carry the topic. If topic is empty every repository is returned. Archived
+// repositories are never returned as nothing can be merged into them.
+func listOrgRepositories(ctx context.Context, client *github.Client, org, topic string, perPage int) ([]Repository, error) {
+	opts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{PerPage: perPage},
+	}
+	repos := []Repository{}
+	for {
+		orgRepos, resp, err := client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, orgRepo := range orgRepos {
+			if orgRepo.GetArchived() || (topic != "" && !hasTopic(orgRepo, topic)) {
+				continue
+			}
+			// Use the owner's login rather than the given organisation name,
+			// which may differ in case, so webhooks can be matched against it.
+			repos = append(repos, Repository{owner: orgRepo.GetOwner().GetLogin(), name: orgRepo.GetName()})
+		}
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func hasTopic(repo *github.Repository, expectedTopic string) bool {
+	for _, topic := range repo.Topics {
+		if topic == expectedTopic {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRepositories returns the repositories given explicitly along with any
+// discovered in the organisation. Discovery is repeated on every call so
+// repositories added to the organisation are picked up by long running
+// processes.
+func resolveRepositories(ctx context.Context, client *github.Client, repos []Repository, org, topic string, perPage int) ([]Repository, error) {
+	if org == "" {
+		return repos, nil
+	}
+
+	orgRepos, err := listOrgRepositories(ctx, client, org, topic, perPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve repositories in %s: %w", org, err)
+	}
+	logDebug(ctx, nil, "Found %d repositories in %s with the topic %s", len(orgRepos), org, topic)
+
+	resolved := append([]Repository{}, repos...)
+	for _, orgRepo := range orgRepos {
+		duplicate := false
+		for _, repo := range repos {
+			if repo == orgRepo {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			resolved = append(resolved, orgRepo)
+		}
+	}
+	return resolved, nil
+}
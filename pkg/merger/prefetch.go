@@ -0,0 +1,320 @@
+package merger
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// graphQLPullRequestsPageSize is how many pull requests are fetched by each
+// GraphQL query. It is kept small as GitHub limits how many nodes a query may
+// return, and each pull request brings its check runs and reviews with it.
+const graphQLPullRequestsPageSize = 25
+
+// pullRequestFragment selects what's needed to evaluate a pull request along
+// with the pull request itself: its latest check runs, commit statuses,
+// reviews and mergeability.
+const pullRequestFragment = `
+fragment evaluatedPullRequest on PullRequest {
+  id
+  number
+  title
+  body
+  url
+  isDraft
+  createdAt
+  updatedAt
+  author { login }
+  labels(first: 100) { nodes { name } }
+  baseRefName
+  baseRepository { nameWithOwner defaultBranchRef { name } }
+  headRefName
+  headRefOid
+  headRepository { nameWithOwner }
+  headRepositoryOwner { login }
+  mergeable
+  mergeStateStatus
+  additions
+  deletions
+  changedFiles
+  reviews(first: 100) {
+    pageInfo { hasNextPage }
+    nodes { state author { login } commit { oid } }
+  }
+  commits(last: 1) {
+    totalCount
+    nodes {
+      commit {
+        checkSuites(first: 20) {
+          pageInfo { hasNextPage }
+          nodes {
+            checkRuns(first: 100, filterBy: {checkType: LATEST}) {
+              pageInfo { hasNextPage }
+              nodes { name status conclusion detailsUrl completedAt }
+            }
+          }
+        }
+        status { contexts { context state targetUrl createdAt } }
+      }
+    }
+  }
+}`
+
+// listPullRequestsQuery fetches the open pull requests of a repository.
+const listPullRequestsQuery = `
+query($owner: String!, $name: String!, $first: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(states: OPEN, first: $first, after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes { ...evaluatedPullRequest }
+    }
+  }
+}` + pullRequestFragment
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLLogin struct {
+	Login string `json:"login"`
+}
+
+type graphQLPullRequest struct {
+	ID        string       `json:"id"`
+	Number    int          `json:"number"`
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	URL       string       `json:"url"`
+	IsDraft   bool         `json:"isDraft"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Author    graphQLLogin `json:"author"`
+	Labels    struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	BaseRefName    string `json:"baseRefName"`
+	BaseRepository struct {
+		NameWithOwner    string `json:"nameWithOwner"`
+		DefaultBranchRef struct {
+			Name string `json:"name"`
+		} `json:"defaultBranchRef"`
+	} `json:"baseRepository"`
+	HeadRefName    string `json:"headRefName"`
+	HeadRefOid     string `json:"headRefOid"`
+	HeadRepository struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"headRepository"`
+	HeadRepositoryOwner graphQLLogin `json:"headRepositoryOwner"`
+	Mergeable           string       `json:"mergeable"`
+	MergeStateStatus    string       `json:"mergeStateStatus"`
+	Additions           int          `json:"additions"`
+	Deletions           int          `json:"deletions"`
+	ChangedFiles        int          `json:"changedFiles"`
+	Reviews             struct {
+		PageInfo graphQLPageInfo `json:"pageInfo"`
+		Nodes    []struct {
+			State  string       `json:"state"`
+			Author graphQLLogin `json:"author"`
+			Commit struct {
+				Oid string `json:"oid"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"reviews"`
+	Commits struct {
+		TotalCount int `json:"totalCount"`
+		Nodes      []struct {
+			Commit struct {
+				CheckSuites struct {
+					PageInfo graphQLPageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						CheckRuns struct {
+							PageInfo graphQLPageInfo `json:"pageInfo"`
+							Nodes    []struct {
+								Name        string     `json:"name"`
+								Status      string     `json:"status"`
+								Conclusion  string     `json:"conclusion"`
+								DetailsURL  string     `json:"detailsUrl"`
+								CompletedAt *time.Time `json:"completedAt"`
+							} `json:"nodes"`
+						} `json:"checkRuns"`
+					} `json:"nodes"`
+				} `json:"checkSuites"`
+				Status *struct {
+					Contexts []struct {
+						Context   string    `json:"context"`
+						State     string    `json:"state"`
+						TargetURL string    `json:"targetUrl"`
+						CreatedAt time.Time `json:"createdAt"`
+					} `json:"contexts"`
+				} `json:"status"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+// prefetchedPullRequest is what was fetched about a pull request along with
+// it. Checks and reviews are only set if all of them fit in the query.
+type prefetchedPullRequest struct {
+	headSHA   string
+	checks    bool
+	checkRuns []*github.CheckRun
+	statuses  []*github.RepoStatus
+	reviews   []*github.PullRequestReview
+}
+
+type prefetchedKey struct{}
+
+// withPrefetched returns a context carrying what was fetched about the
+// repository's pull requests, by number.
+func withPrefetched(ctx context.Context, prefetched map[int]*prefetchedPullRequest) context.Context {
+	return context.WithValue(ctx, prefetchedKey{}, prefetched)
+}
+
+// prefetchedFor returns what was fetched about the pull request, or nil if
+// nothing was or its head has moved since.
+func prefetchedFor(ctx context.Context, pullRequest *github.PullRequest) *prefetchedPullRequest {
+	all, _ := ctx.Value(prefetchedKey{}).(map[int]*prefetchedPullRequest)
+	prefetched, ok := all[pullRequest.GetNumber()]
+	if !ok || prefetched.headSHA != pullRequest.GetHead().GetSHA() {
+		return nil
+	}
+	return prefetched
+}
+
+// listPullRequestsGraphQL retrieves every open pull request in the repository
+// along with their checks, reviews and mergeability, using a single GraphQL
+// query for each page of pull requests rather than several REST requests for
+// each pull request.
+func listPullRequestsGraphQL(ctx context.Context, client *github.Client, owner, repoName string) ([]*github.PullRequest, map[int]*prefetchedPullRequest, error) {
+	allPullRequests := []*github.PullRequest{}
+	prefetched := map[int]*prefetchedPullRequest{}
+	variables := map[string]interface{}{
+		"owner": owner,
+		"name":  repoName,
+		"first": graphQLPullRequestsPageSize,
+	}
+	for {
+		var result struct {
+			Repository struct {
+				PullRequests struct {
+					PageInfo graphQLPageInfo      `json:"pageInfo"`
+					Nodes    []graphQLPullRequest `json:"nodes"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+		if err := graphQL(ctx, client, listPullRequestsQuery, variables, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, node := range result.Repository.PullRequests.Nodes {
+			pullRequest, fetched := node.convert()
+			allPullRequests = append(allPullRequests, pullRequest)
+			prefetched[pullRequest.GetNumber()] = fetched
+		}
+		pageInfo := result.Repository.PullRequests.PageInfo
+		if !pageInfo.HasNextPage {
+			return allPullRequests, prefetched, nil
+		}
+		variables["after"] = pageInfo.EndCursor
+	}
+}
+
+// convert turns the GraphQL pull request into the REST API's representation,
+// which the rest of merger works with, and what was fetched along with it.
+func (node graphQLPullRequest) convert() (*github.PullRequest, *prefetchedPullRequest) {
+	labels := []*github.Label{}
+	for _, label := range node.Labels.Nodes {
+		labels = append(labels, &github.Label{Name: github.String(label.Name)})
+	}
+	pullRequest := &github.PullRequest{
+		NodeID:    github.String(node.ID),
+		Number:    github.Int(node.Number),
+		State:     github.String("open"),
+		Title:     github.String(node.Title),
+		Body:      github.String(node.Body),
+		HTMLURL:   github.String(node.URL),
+		Draft:     github.Bool(node.IsDraft),
+		CreatedAt: &node.CreatedAt,
+		UpdatedAt: &node.UpdatedAt,
+		User:      &github.User{Login: github.String(node.Author.Login)},
+		Labels:    labels,
+		Base: &github.PullRequestBranch{
+			Ref: github.String(node.BaseRefName),
+			Repo: &github.Repository{
+				FullName:      github.String(node.BaseRepository.NameWithOwner),
+				DefaultBranch: github.String(node.BaseRepository.DefaultBranchRef.Name),
+			},
+		},
+		Head: &github.PullRequestBranch{
+			Ref:   github.String(node.HeadRefName),
+			SHA:   github.String(node.HeadRefOid),
+			Label: github.String(node.HeadRepositoryOwner.Login + ":" + node.HeadRefName),
+			Repo:  &github.Repository{FullName: github.String(node.HeadRepository.NameWithOwner)},
+		},
+		MergeableState: github.String(strings.ToLower(node.MergeStateStatus)),
+		Additions:      github.Int(node.Additions),
+		Deletions:      github.Int(node.Deletions),
+		ChangedFiles:   github.Int(node.ChangedFiles),
+		Commits:        github.Int(node.Commits.TotalCount),
+	}
+	// Mergeability is computed in the background, so it is left unset while
+	// GitHub hasn't got to it yet, just like the REST API does.
+	switch node.Mergeable {
+	case "MERGEABLE":
+		pullRequest.Mergeable = github.Bool(true)
+	case "CONFLICTING":
+		pullRequest.Mergeable = github.Bool(false)
+	}
+
+	prefetched := &prefetchedPullRequest{headSHA: node.HeadRefOid}
+	if !node.Reviews.PageInfo.HasNextPage {
+		prefetched.reviews = []*github.PullRequestReview{}
+		for _, review := range node.Reviews.Nodes {
+			prefetched.reviews = append(prefetched.reviews, &github.PullRequestReview{
+				State:    github.String(review.State),
+				User:     &github.User{Login: github.String(review.Author.Login)},
+				CommitID: github.String(review.Commit.Oid),
+			})
+		}
+	}
+	if len(node.Commits.Nodes) == 1 {
+		commit := node.Commits.Nodes[0].Commit
+		prefetched.checks = !commit.CheckSuites.PageInfo.HasNextPage
+		for _, suite := range commit.CheckSuites.Nodes {
+			if suite.CheckRuns.PageInfo.HasNextPage {
+				prefetched.checks = false
+			}
+			for _, checkRun := range suite.CheckRuns.Nodes {
+				run := &github.CheckRun{
+					Name:       github.String(checkRun.Name),
+					Status:     github.String(strings.ToLower(checkRun.Status)),
+					DetailsURL: github.String(checkRun.DetailsURL),
+				}
+				if checkRun.Conclusion != "" {
+					run.Conclusion = github.String(strings.ToLower(checkRun.Conclusion))
+				}
+				if checkRun.CompletedAt != nil {
+					run.CompletedAt = &github.Timestamp{Time: *checkRun.CompletedAt}
+				}
+				prefetched.checkRuns = append(prefetched.checkRuns, run)
+			}
+		}
+		if commit.Status != nil {
+			for _, context := range commit.Status.Contexts {
+				// A status's context changing state creates a new status.
+				updatedAt := context.CreatedAt
+				prefetched.statuses = append(prefetched.statuses, &github.RepoStatus{
+					Context:   github.String(context.Context),
+					State:     github.String(strings.ToLower(context.State)),
+					TargetURL: github.String(context.TargetURL),
+					UpdatedAt: &updatedAt,
+				})
+			}
+		}
+	}
+	return pullRequest, prefetched
+}
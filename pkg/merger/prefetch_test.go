@@ -0,0 +1,100 @@
+package merger
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertGraphQLPullRequest(t *testing.T) {
+	var node graphQLPullRequest
+	err := json.Unmarshal([]byte(`{
+		"id": "PR_1",
+		"number": 12,
+		"title": "Bump yaml.v2",
+		"url": "https://github.com/nick96/merger/pull/12",
+		"author": {"login": "dependabot[bot]"},
+		"labels": {"nodes": [{"name": "dependencies"}]},
+		"baseRefName": "main",
+		"baseRepository": {"nameWithOwner": "nick96/merger", "defaultBranchRef": {"name": "main"}},
+		"headRefName": "dependabot/go_modules/yaml",
+		"headRefOid": "abc123",
+		"headRepository": {"nameWithOwner": "nick96/merger"},
+		"headRepositoryOwner": {"login": "nick96"},
+		"mergeable": "MERGEABLE",
+		"mergeStateStatus": "BEHIND",
+		"reviews": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"state": "APPROVED", "author": {"login": "nick96"}, "commit": {"oid": "abc123"}}
+		]},
+		"commits": {"nodes": [{"commit": {
+			"checkSuites": {"pageInfo": {"hasNextPage": false}, "nodes": [
+				{"checkRuns": {"pageInfo": {"hasNextPage": false}, "nodes": [
+					{"name": "test", "status": "COMPLETED", "conclusion": "SUCCESS"},
+					{"name": "lint", "status": "IN_PROGRESS", "conclusion": null}
+				]}}
+			]},
+			"status": {"contexts": [{"context": "ci/circleci", "state": "PENDING"}]}
+		}}]}
+	}`), &node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pullRequest, prefetched := node.convert()
+	if pullRequest.GetNumber() != 12 || pullRequest.GetBase().GetRepo().GetFullName() != "nick96/merger" || pullRequest.GetHead().GetSHA() != "abc123" {
+		t.Errorf("convert() = %v, want pull request 12 in nick96/merger at abc123", pullRequest)
+	}
+	if !hasLabel(pullRequest, "dependencies") {
+		t.Errorf("convert() labels = %v, want dependencies", pullRequest.Labels)
+	}
+	if pullRequest.Mergeable == nil || !pullRequest.GetMergeable() || pullRequest.GetMergeableState() != "behind" {
+		t.Errorf("convert() mergeable = %v (%s), want true (behind)", pullRequest.Mergeable, pullRequest.GetMergeableState())
+	}
+	if pullRequest.GetHead().GetLabel() != "nick96:dependabot/go_modules/yaml" {
+		t.Errorf("convert() head label = %s, want nick96:dependabot/go_modules/yaml", pullRequest.GetHead().GetLabel())
+	}
+
+	if !prefetched.checks || len(prefetched.checkRuns) != 2 || len(prefetched.statuses) != 1 {
+		t.Fatalf("convert() prefetched %d check runs and %d statuses, want 2 and 1", len(prefetched.checkRuns), len(prefetched.statuses))
+	}
+	if run := prefetched.checkRuns[0]; run.GetStatus() != "completed" || run.GetConclusion() != "success" {
+		t.Errorf("convert() check run = %s/%s, want completed/success", run.GetStatus(), run.GetConclusion())
+	}
+	if run := prefetched.checkRuns[1]; run.Conclusion != nil {
+		t.Errorf("convert() conclusion of in progress check run = %s, want nil", run.GetConclusion())
+	}
+	if state := prefetched.statuses[0].GetState(); state != "pending" {
+		t.Errorf("convert() status state = %s, want pending", state)
+	}
+	if approvers := approversFromReviews(prefetched.reviews, "abc123"); len(approvers) != 1 || approvers[0] != "nick96" {
+		t.Errorf("approversFromReviews = %v, want [nick96]", approvers)
+	}
+}
+
+func TestConvertGraphQLPullRequestIncomplete(t *testing.T) {
+	var node graphQLPullRequest
+	err := json.Unmarshal([]byte(`{
+		"number": 1,
+		"mergeable": "UNKNOWN",
+		"reviews": {"pageInfo": {"hasNextPage": true}, "nodes": []},
+		"commits": {"nodes": [{"commit": {
+			"checkSuites": {"pageInfo": {"hasNextPage": false}, "nodes": [
+				{"checkRuns": {"pageInfo": {"hasNextPage": true}, "nodes": []}}
+			]},
+			"status": null
+		}}]}
+	}`), &node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pullRequest, prefetched := node.convert()
+	if pullRequest.Mergeable != nil {
+		t.Errorf("convert() mergeable = %v, want nil while unknown", pullRequest.GetMergeable())
+	}
+	if prefetched.checks {
+		t.Error("convert() prefetched checks despite more check runs being left")
+	}
+	if prefetched.reviews != nil {
+		t.Error("convert() prefetched reviews despite more reviews being left")
+	}
+}
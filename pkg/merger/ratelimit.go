@@ -0,0 +1,187 @@
+package merger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRateLimitLow is returned instead of making a request when the rate limit
+// has dropped below -rate-limit-threshold and -rate-limit-action is abort.
+var errRateLimitLow = errors.New("GitHub API rate limit is below -rate-limit-threshold")
+
+// rateLimitTransport reads the rate limit headers from every response and,
+// once fewer than threshold requests remain, either pauses requests until the
+// limit resets or fails them with errRateLimitLow. Each of GitHub's rate
+// limits, like core, search and graphql, is tracked separately.
+type rateLimitTransport struct {
+	next      http.RoundTripper
+	threshold int
+	pause     bool
+
+	mu     sync.Mutex
+	limits map[string]rateLimit
+}
+
+// rateLimit is the state of one of GitHub's rate limits as of the last
+// response.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+func newRateLimitTransport(next http.RoundTripper, threshold int, pause bool) *rateLimitTransport {
+	return &rateLimitTransport{
+		next:      next,
+		threshold: threshold,
+		pause:     pause,
+		limits:    map[string]rateLimit{},
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := rateLimitResource(req)
+	if limit, low := t.low(resource); low {
+		if !t.pause {
+			return nil, fmt.Errorf("%w: %d %s requests left until %s", errRateLimitLow, limit.remaining, resource, limit.reset.Format(time.RFC3339))
+		}
+		logWarn(
+			req.Context(),
+			logFields{"resource": resource},
+			"Only %d %s requests left in the GitHub API rate limit, pausing until it resets at %s",
+			limit.remaining,
+			resource,
+			limit.reset.Format(time.RFC3339),
+		)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(time.Until(limit.reset)):
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.update(resp)
+	return resp, nil
+}
+
+// low returns the last known state of the rate limit and whether it is below
+// the threshold and hasn't reset since.
+func (t *rateLimitTransport) low(resource string) (rateLimit, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limit, ok := t.limits[resource]
+	if !ok || limit.remaining >= t.threshold || time.Now().After(limit.reset) {
+		return limit, false
+	}
+	return limit, true
+}
+
+// update records the rate limit reported in the response's headers, if any.
+func (t *rateLimitTransport) update(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = rateLimitResource(resp.Request)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits[resource] = rateLimit{remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// secondaryRateLimitRetries is how many times a request is retried after
+// hitting one of GitHub's secondary rate limits.
+const secondaryRateLimitRetries = 3
+
+// secondaryRateLimitTransport retries requests that hit one of GitHub's
+// secondary rate limits, which it applies when merging several pull requests
+// in quick succession, after waiting as long as GitHub's Retry-After header
+// asks.
+type secondaryRateLimitTransport struct {
+	next http.RoundTripper
+}
+
+func (t *secondaryRateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || attempt >= secondaryRateLimitRetries {
+			return resp, err
+		}
+		retryAfter, ok := secondaryRateLimitRetryAfter(resp)
+		if !ok {
+			return resp, nil
+		}
+		// The body can only be replayed if the request knows how to get it
+		// again, which is the case for all of go-github's requests.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		logWarn(
+			req.Context(),
+			nil,
+			"Hit GitHub's secondary rate limit on %s %s, retrying in %s (attempt %d/%d)",
+			req.Method,
+			req.URL.Path,
+			retryAfter,
+			attempt+1,
+			secondaryRateLimitRetries,
+		)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(retryAfter):
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// secondaryRateLimitRetryAfter reports whether the response is from one of
+// GitHub's secondary rate limits and, if so, how long to wait before
+// retrying.
+func secondaryRateLimitRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// rateLimitResource returns which of GitHub's rate limits the request counts
+// against.
+func rateLimitResource(req *http.Request) string {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.Contains(req.URL.Path, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
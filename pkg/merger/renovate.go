@@ -0,0 +1,70 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Renovate reports how long a release has been available through one of
+// these statuses, which stay pending until its stability days have passed.
+var renovateStabilityContexts = []string{"renovate/stability-days", "renovate/minimum-release-age"}
+
+const (
+	renovateRebaseUnchecked = "- [ ] <!-- rebase-check -->"
+	renovateRebaseChecked   = "- [x] <!-- rebase-check -->"
+)
+
+// renovateAutomergeDisabledRegexp matches the line Renovate adds to PR bodies
+// when it has been configured not to automerge the update.
+var renovateAutomergeDisabledRegexp = regexp.MustCompile(`\*\*Automerge\*\*: Disabled`)
+
+func isRenovatePullRequest(pullRequest *github.PullRequest) bool {
+	return pullRequest.GetUser().GetLogin() == "renovate[bot]" ||
+		strings.HasPrefix(pullRequest.GetHead().GetRef(), "renovate/") ||
+		strings.Contains(pullRequest.GetBody(), "<!-- rebase-check -->")
+}
+
+// renovateSkipReason returns why a Renovate pull request shouldn't be merged
+// according to its own metadata, or an empty string if it can be.
+func renovateSkipReason(pullRequest *github.PullRequest) string {
+	if renovateAutomergeDisabledRegexp.MatchString(pullRequest.GetBody()) {
+		return "Renovate has automerge disabled for it"
+	}
+	return ""
+}
+
+// renovateStabilityPassed reports whether Renovate's stability days have
+// passed for the pull request, and why not if they haven't. These are checked
+// even if the status is otherwise ignored.
+func renovateStabilityPassed(statuses []*github.RepoStatus) (bool, string) {
+	for _, status := range statuses {
+		for _, name := range renovateStabilityContexts {
+			if status.GetContext() == name && status.GetState() != "success" {
+				return false, fmt.Sprintf("its Renovate stability days have not passed (%s)", status.GetDescription())
+			}
+		}
+	}
+	return true, ""
+}
+
+// requestRenovateRebase ticks the rebase checkbox in the body of a Renovate
+// pull request, which asks Renovate to rebase it and resolve the conflicts.
+func requestRenovateRebase(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) error {
+	body := pullRequest.GetBody()
+	if !strings.Contains(body, renovateRebaseUnchecked) {
+		logInfo(ctx, pullRequestFields(pullRequest), "Renovate has already been asked to rebase pull request %d", pullRequest.GetNumber())
+		return nil
+	}
+
+	body = strings.Replace(body, renovateRebaseUnchecked, renovateRebaseChecked, 1)
+	_, _, err := client.PullRequests.Edit(ctx, owner, repoName, pullRequest.GetNumber(), &github.PullRequest{Body: &body})
+	if err != nil {
+		return fmt.Errorf("failed to ask Renovate to rebase pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(ctx, pullRequestFields(pullRequest).with("decision", "rebase requested"), "Asked Renovate to rebase pull request %d to resolve its conflicts", pullRequest.GetNumber())
+	return nil
+}
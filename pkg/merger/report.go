@@ -0,0 +1,296 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v32/github"
+)
+
+type reportKey struct{}
+
+// withReport returns a context carrying the report that what happens to each
+// pull request during the run is recorded in, so it can be summarised and
+// output for GitHub Actions, written to -report or counted in the metrics.
+func withReport(ctx context.Context, r *report) context.Context {
+	return context.WithValue(ctx, reportKey{}, r)
+}
+
+// reportFor returns the report of the run in ctx. It is nil if the run
+// doesn't need one.
+func reportFor(ctx context.Context) *report {
+	r, _ := ctx.Value(reportKey{}).(*report)
+	return r
+}
+
+// reportEntry is what happened to a single pull request.
+type reportEntry struct {
+	repo        string
+	number      int
+	url         string
+	checks      string
+	checkStates map[string]string
+	decision    string
+	cause       string
+	message     string
+	mergeSHA    string
+	// queuePosition is where the pull request was added to the merge queue,
+	// if it was.
+	queuePosition int
+}
+
+// report collects the decisions logged about pull requests. Later decisions
+// about a pull request replace earlier ones, as they are closer to the final
+// outcome.
+type report struct {
+	mu      sync.Mutex
+	entries []*reportEntry
+	byKey   map[string]*reportEntry
+	// pullRequests are the pull requests that were checked, by the same key
+	// as byKey, for the details that aren't logged.
+	pullRequests map[string]*github.PullRequest
+	// freezes describe the freezes the run was in, if any.
+	freezes []string
+}
+
+func newReport() *report {
+	return &report{byKey: map[string]*reportEntry{}, pullRequests: map[string]*github.PullRequest{}}
+}
+
+// track remembers the pull request so its details are available once the run
+// is finished. The report may be nil, in which case nothing is tracked.
+func (r *report) track(pullRequest *github.PullRequest) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := fmt.Sprintf("%s#%d", pullRequest.GetBase().GetRepo().GetFullName(), pullRequest.GetNumber())
+	r.pullRequests[key] = pullRequest
+}
+
+// addFreeze records that the run, or one of its repositories, is in the
+// freeze described. The report may be nil, in which case nothing is recorded.
+func (r *report) addFreeze(description string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.freezes = append(r.freezes, description)
+}
+
+// record updates the entry of the pull request the log fields are about.
+// Fields that aren't about a pull request are ignored.
+func (r *report) record(fields logFields, message string) {
+	number, ok := fields["pr"].(int)
+	if !ok {
+		return
+	}
+	repo, _ := fields["repo"].(string)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := fmt.Sprintf("%s#%d", repo, number)
+	entry, ok := r.byKey[key]
+	if !ok {
+		entry = &reportEntry{repo: repo, number: number, checkStates: map[string]string{}}
+		r.byKey[key] = entry
+		r.entries = append(r.entries, entry)
+	}
+	if url, ok := fields["url"].(string); ok {
+		entry.url = url
+	}
+	if checks, ok := fields["checks"].(string); ok {
+		entry.checks = checks
+	}
+	if check, ok := fields["check"].(string); ok {
+		state, _ := fields["state"].(string)
+		entry.checkStates[check] = state
+	}
+	if sha, ok := fields["sha"].(string); ok {
+		entry.mergeSHA = sha
+	}
+	if position, ok := fields["queue_position"].(int); ok {
+		entry.queuePosition = position
+	}
+	if decision, ok := fields["decision"].(string); ok {
+		entry.decision = decision
+		entry.cause, _ = fields["cause"].(string)
+		entry.message = message
+	}
+}
+
+// digest summarises the outcome of each pull request, leaving out the details
+// that change from run to run even when nothing else has, such as times in
+// log messages.
+func (r *report) digest() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := []string{}
+	for _, entry := range r.entries {
+		checks := []string{}
+		for check, state := range entry.checkStates {
+			checks = append(checks, check+"="+state)
+		}
+		sort.Strings(checks)
+		lines = append(lines, fmt.Sprintf(
+			"%s#%d %s %s %s %s",
+			entry.repo,
+			entry.number,
+			entry.decision,
+			entry.cause,
+			entry.checks,
+			strings.Join(checks, ","),
+		))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// writeStepSummary appends a markdown table of the pull requests and what
+// happened to them to the GitHub Actions step summary at path.
+func (r *report) writeStepSummary(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var summary strings.Builder
+	summary.WriteString("## merger\n\n")
+	for _, freeze := range r.freezes {
+		fmt.Fprintf(&summary, "> **%s**, so the pull requests it covers were only reported on.\n\n", freeze)
+	}
+	if len(r.entries) == 0 {
+		summary.WriteString("No pull requests were checked.\n")
+	} else {
+		summary.WriteString("| Pull request | Checks | Outcome | Details |\n")
+		summary.WriteString("| --- | --- | --- | --- |\n")
+		for _, entry := range r.entries {
+			name := fmt.Sprintf("%s#%d", entry.repo, entry.number)
+			if entry.url != "" {
+				name = fmt.Sprintf("[%s](%s)", name, entry.url)
+			}
+			fmt.Fprintf(
+				&summary,
+				"| %s | %s | %s | %s |\n",
+				name,
+				escapeTableCell(entry.checks),
+				escapeTableCell(entry.decision),
+				escapeTableCell(entry.message),
+			)
+		}
+	}
+
+	return appendToFile(path, summary.String())
+}
+
+// writeOutputs appends the merged_prs, queued_prs, skipped_prs and failed_prs
+// outputs to the GitHub Actions output file at path. Each is a comma separated
+// list of pull request numbers, qualified with their repository when qualify
+// is set as numbers are ambiguous across repositories.
+func (r *report) writeOutputs(path string, qualify bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outputs := map[string][]string{}
+	for _, entry := range r.entries {
+		var name string
+		switch entry.decision {
+		case "merged":
+			name = "merged_prs"
+		case "queued":
+			name = "queued_prs"
+		case "skipped", "blocked":
+			name = "skipped_prs"
+		case "failed":
+			name = "failed_prs"
+		default:
+			continue
+		}
+		pullRequest := strconv.Itoa(entry.number)
+		if qualify {
+			pullRequest = fmt.Sprintf("%s#%d", entry.repo, entry.number)
+		}
+		outputs[name] = append(outputs[name], pullRequest)
+	}
+
+	var lines strings.Builder
+	for _, name := range []string{"merged_prs", "queued_prs", "skipped_prs", "failed_prs"} {
+		fmt.Fprintf(&lines, "%s=%s\n", name, strings.Join(outputs[name], ","))
+	}
+
+	return appendToFile(path, lines.String())
+}
+
+// reportFile is the JSON written by -report.
+type reportFile struct {
+	Freezes      []string          `json:"freezes,omitempty"`
+	PullRequests []reportFileEntry `json:"pull_requests"`
+}
+
+type reportFileEntry struct {
+	Repository  string            `json:"repository"`
+	Number      int               `json:"number"`
+	URL         string            `json:"url,omitempty"`
+	Decision    string            `json:"decision,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Checks      string            `json:"checks,omitempty"`
+	CheckStates map[string]string `json:"check_states,omitempty"`
+	MergeSHA    string            `json:"merge_sha,omitempty"`
+	// QueuePosition is only set for pull requests added to the merge queue.
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// writeFile writes the report as JSON to path, replacing anything already
+// there.
+func (r *report) writeFile(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file := reportFile{Freezes: r.freezes, PullRequests: []reportFileEntry{}}
+	for _, entry := range r.entries {
+		file.PullRequests = append(file.PullRequests, reportFileEntry{
+			Repository:    entry.repo,
+			Number:        entry.number,
+			URL:           entry.url,
+			Decision:      entry.decision,
+			Reason:        entry.message,
+			Checks:        entry.checks,
+			CheckStates:   entry.checkStates,
+			MergeSHA:      entry.mergeSHA,
+			QueuePosition: entry.queuePosition,
+		})
+	}
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// appendToFile appends the text to the file at path, which is how GitHub
+// Actions expects summaries and outputs to be written.
+func appendToFile(path, text string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// escapeTableCell makes the text safe to put in a markdown table cell.
+func escapeTableCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
@@ -0,0 +1,36 @@
+package merger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Repository identifies a GitHub repository by its owner and name.
+type Repository struct {
+	owner string
+	name  string
+}
+
+// ParseRepository parses a repository name of the form <owner>/<repo>.
+func ParseRepository(fullName string) (Repository, error) {
+	parts := strings.Split(fullName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Repository{}, fmt.Errorf("expected GitHub repository name to be of the form <owner>/<repo>. '%s' is not", fullName)
+	}
+	return Repository{owner: parts[0], name: parts[1]}, nil
+}
+
+// ParseProjectPath parses the full path of a project on a forge that nests
+// namespaces, such as <group>/<subgroup>/<project> on GitLab. Everything up to
+// the last slash is the owner.
+func ParseProjectPath(fullPath string) (Repository, error) {
+	i := strings.LastIndex(fullPath, "/")
+	if i <= 0 || i == len(fullPath)-1 {
+		return Repository{}, fmt.Errorf("expected project path to be of the form <namespace>/<project>. '%s' is not", fullPath)
+	}
+	return Repository{owner: fullPath[:i], name: fullPath[i+1:]}, nil
+}
+
+func (r Repository) String() string {
+	return r.owner + "/" + r.name
+}
@@ -0,0 +1,88 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// rerunFailedChecks re-requests the latest run of each failed check run that
+// is blocking the pull request, as long as the check hasn't already been run
+// opts.RerunFailedChecks more times. Each re-run is a new check run with the
+// same name on the same commit, so earlier attempts are counted from those.
+// Checks that can't be re-run, such as commit statuses, are left alone and
+// failures to re-run them are only logged.
+func rerunFailedChecks(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, blocking []BlockingCheck, opts *Options) error {
+	failed := map[string]bool{}
+	for _, check := range blocking {
+		if isFailedConclusion(check.State) {
+			failed[check.Name] = true
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	checkRuns, err := listCheckRunsFiltered(ctx, client, owner, repoName, pullRequest.GetHead().GetSHA(), "all", opts.PerPage)
+	if err != nil {
+		return fmt.Errorf("failed to get check runs for pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	attempts := map[string]int{}
+	latest := map[string]*github.CheckRun{}
+	for _, checkRun := range checkRuns {
+		name := checkRun.GetName()
+		attempts[name]++
+		if previous, ok := latest[name]; !ok || checkRun.GetID() > previous.GetID() {
+			latest[name] = checkRun
+		}
+	}
+
+	for name := range failed {
+		checkRun, ok := latest[name]
+		if !ok {
+			continue
+		}
+		fields := pullRequestFields(pullRequest).with("check", name)
+		if reruns := attempts[name] - 1; reruns >= opts.RerunFailedChecks {
+			logInfo(ctx, fields, "Check %s for pull request %d has already been re-run %d times. Not re-running it again.", name, pullRequest.GetNumber(), reruns)
+			continue
+		}
+		if opts.DryRun {
+			logInfo(ctx, fields, "Would re-run failed check %s for pull request %d (dry run)", name, pullRequest.GetNumber())
+			continue
+		}
+		if err := rerequestCheckRun(ctx, client, owner, repoName, checkRun.GetID()); err != nil {
+			logWarn(ctx, fields, "Failed to re-run check %s for pull request %d: %v", name, pullRequest.GetNumber(), err)
+			continue
+		}
+		logInfo(
+			ctx,
+			fields,
+			"Re-running failed check %s for pull request %d (attempt %d/%d)",
+			name,
+			pullRequest.GetNumber(),
+			attempts[name],
+			opts.RerunFailedChecks,
+		)
+	}
+	return nil
+}
+
+// isFailedConclusion reports whether a blocking check's state is a check run
+// conclusion worth re-running it for, rather than it still running.
+func isFailedConclusion(state string) bool {
+	return state == "failure" || state == "timed_out" || state == "cancelled"
+}
+
+// rerequestCheckRun asks the app that created the check run to run it again.
+// go-github doesn't support this endpoint yet, only re-requesting whole check
+// suites.
+func rerequestCheckRun(ctx context.Context, client *github.Client, owner, repoName string, checkRunID int64) error {
+	req, err := client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/check-runs/%d/rerequest", owner, repoName, checkRunID), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(ctx, req, nil)
+	return err
+}
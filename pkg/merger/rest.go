@@ -0,0 +1,80 @@
+package merger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// restClient makes JSON requests to the REST API of a forge other than GitHub.
+type restClient struct {
+	httpClient *http.Client
+	baseURL    string
+	// headers are sent with every request, such as to authenticate.
+	headers map[string]string
+}
+
+// apiError is a response other than a 2xx from a forge's REST API.
+type apiError struct {
+	method     string
+	path       string
+	statusCode int
+	status     string
+	message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s responded with %s: %s", e.method, e.path, e.status, e.message)
+}
+
+// do makes a request to the path under the base URL, sending body as JSON
+// unless it is nil and decoding the JSON response into out unless it is nil.
+// The response's headers are returned for pagination.
+func (c *restClient) do(ctx context.Context, method, path string, body, out interface{}) (http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.baseURL, "/")+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, &apiError{
+			method:     method,
+			path:       req.URL.Path,
+			statusCode: resp.StatusCode,
+			status:     resp.Status,
+			message:    strings.TrimSpace(string(message)),
+		}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("failed to decode response to %s %s: %w", method, req.URL.Path, err)
+		}
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,109 @@
+package merger
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// retryTransport retries requests that fail with a network error or a 5xx
+// response, waiting twice as long before each retry as before the last, so a
+// single blip in GitHub's API doesn't fail a pull request that could have
+// been merged.
+//
+// Only requests that can safely be made twice are retried: GETs, PUTs, like
+// merging, DELETEs and GraphQL queries. Creating comments and labels with a
+// POST, and GraphQL mutations, aren't retried, as the first attempt may have
+// succeeded.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.next.RoundTrip(req)
+	}
+	delay := t.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.retries || req.Context().Err() != nil {
+			return resp, err
+		}
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		logWarn(
+			req.Context(),
+			nil,
+			"Request to %s %s failed with %s, retrying in %s (attempt %d/%d)",
+			req.Method,
+			req.URL.Path,
+			reason,
+			delay,
+			attempt+1,
+			t.retries,
+		)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether the request can safely be made again.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(req.URL.Path, "/graphql") && !graphQLMutation(req)
+	default:
+		return false
+	}
+}
+
+// graphQLMutation reports whether the GraphQL request is a mutation, like
+// merging a pull request or adding it to the merge queue, which may have
+// taken effect even if its response was lost. Requests whose body can't be
+// read are assumed to be mutations.
+func graphQLMutation(req *http.Request) bool {
+	if req.GetBody == nil {
+		return true
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return true
+	}
+	defer body.Close()
+	var request struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(request.Query), "mutation")
+}
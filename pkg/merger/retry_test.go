@@ -0,0 +1,49 @@
+package merger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	graphQLRequest := func(query string) *http.Request {
+		body, err := json.Marshal(map[string]interface{}{"query": query})
+		if err != nil {
+			t.Fatalf("failed to encode query: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "https://api.github.com/graphql", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		return req
+	}
+	newRequest := func(method, url string) *http.Request {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want bool
+	}{
+		{"get", newRequest(http.MethodGet, "https://api.github.com/repos/nick96/merger/pulls"), true},
+		{"rest merge", newRequest(http.MethodPut, "https://api.github.com/repos/nick96/merger/pulls/1/merge"), true},
+		{"comment", newRequest(http.MethodPost, "https://api.github.com/repos/nick96/merger/issues/1/comments"), false},
+		{"graphql query", graphQLRequest("query($owner: String!) { repository(owner: $owner) { id } }"), true},
+		{"graphql shorthand query", graphQLRequest("{ viewer { login } }"), true},
+		{"graphql merge", graphQLRequest(mergePullRequestMutation), false},
+		{"graphql enqueue", graphQLRequest("\n  " + enqueuePullRequestMutation), false},
+		{"graphql without a body", newRequest(http.MethodPost, "https://api.github.com/graphql"), false},
+	}
+	for _, test := range tests {
+		if got := retryable(test.req); got != test.want {
+			t.Errorf("retryable(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package merger
+
+import (
+	"context"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// listApprovers returns the logins of the reviewers whose latest review of the
+// pull request is an approval. Comments don't change a reviewer's verdict, so
+// they are ignored. If headSHA is set, approvals of any other commit are stale
+// and ignored too.
+func listApprovers(ctx context.Context, client *github.Client, owner, repoName string, number, perPage int, headSHA string) ([]string, error) {
+	reviews, err := listReviews(ctx, client, owner, repoName, number, perPage)
+	if err != nil {
+		return nil, err
+	}
+	return approversFromReviews(reviews, headSHA), nil
+}
+
+// listReviews retrieves every review of the pull request in chronological
+// order.
+func listReviews(ctx context.Context, client *github.Client, owner, repoName string, number, perPage int) ([]*github.PullRequestReview, error) {
+	opts := &github.ListOptions{PerPage: perPage}
+	allReviews := []*github.PullRequestReview{}
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		allReviews = append(allReviews, reviews...)
+		if resp.NextPage == 0 {
+			return allReviews, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// approversFromReviews returns the logins of the reviewers whose latest review in
+// reviews, which must be in chronological order, is an approval.
+func approversFromReviews(reviews []*github.PullRequestReview, headSHA string) []string {
+	latestStates := map[string]string{}
+	// Later reviews overwrite earlier ones.
+	for _, review := range reviews {
+		if review.GetState() == "COMMENTED" {
+			continue
+		}
+		if review.GetState() == "APPROVED" && headSHA != "" && review.GetCommitID() != headSHA {
+			continue
+		}
+		latestStates[review.GetUser().GetLogin()] = review.GetState()
+	}
+
+	approvers := []string{}
+	for login, state := range latestStates {
+		if state == "APPROVED" {
+			approvers = append(approvers, login)
+		}
+	}
+	return approvers
+}
@@ -0,0 +1,323 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// weekdays are the names of the days of the week, in time.Weekday's order.
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// MergeWindow is a time of day, on some days of the week, when pull requests
+// may be merged.
+type MergeWindow struct {
+	source string
+	days   [7]bool
+	// start and end are minutes since midnight. Windows that end before they
+	// start run past midnight into the next day.
+	start, end int
+}
+
+// ParseMergeWindow parses a merge window of the form [<days>] <start>-<end>,
+// such as Mon-Fri 09:00-16:00. Days are a day or a range of days, with their
+// names or the first three letters of them, and default to every day. Times
+// are 24-hour HH:MM.
+func ParseMergeWindow(window string) (MergeWindow, error) {
+	w := MergeWindow{source: window}
+	fields := strings.Fields(window)
+	if len(fields) == 0 || len(fields) > 2 {
+		return MergeWindow{}, fmt.Errorf("expected merge window to be of the form [<days>] <start>-<end>. '%s' is not", window)
+	}
+
+	days := "sun-sat"
+	if len(fields) == 2 {
+		days = fields[0]
+	}
+	first, last := days, days
+	if i := strings.Index(days, "-"); i >= 0 {
+		first, last = days[:i], days[i+1:]
+	}
+	from, err := parseWeekday(first)
+	if err != nil {
+		return MergeWindow{}, err
+	}
+	to, err := parseWeekday(last)
+	if err != nil {
+		return MergeWindow{}, err
+	}
+	for day := from; ; day = (day + 1) % 7 {
+		w.days[day] = true
+		if day == to {
+			break
+		}
+	}
+
+	times := strings.Split(fields[len(fields)-1], "-")
+	if len(times) != 2 {
+		return MergeWindow{}, fmt.Errorf("expected the times of merge window %s to be of the form <start>-<end>", window)
+	}
+	if w.start, err = parseTimeOfDay(times[0]); err != nil {
+		return MergeWindow{}, err
+	}
+	if w.end, err = parseTimeOfDay(times[1]); err != nil {
+		return MergeWindow{}, err
+	}
+	if w.start == w.end {
+		return MergeWindow{}, fmt.Errorf("merge window %s starts and ends at the same time", window)
+	}
+	return w, nil
+}
+
+// parseWeekday parses the name of a day of the week, or the first three
+// letters of it.
+func parseWeekday(name string) (time.Weekday, error) {
+	lower := strings.ToLower(name)
+	for day, weekday := range weekdays {
+		if lower == weekday || lower == weekday[:3] {
+			return time.Weekday(day), nil
+		}
+	}
+	return 0, fmt.Errorf("%s isn't a day of the week", name)
+}
+
+// parseTimeOfDay parses a 24-hour HH:MM time into minutes since midnight.
+// 24:00 is the end of the day.
+func parseTimeOfDay(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("expected time to be of the form HH:MM. '%s' is not", value)
+	}
+	hours, hoursErr := strconv.Atoi(parts[0])
+	minutes, minutesErr := strconv.Atoi(parts[1])
+	if hoursErr != nil || minutesErr != nil || hours > 24 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("%s isn't a time of day", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+func (w MergeWindow) String() string {
+	return w.source
+}
+
+// contains reports whether t is within the window, in t's location.
+func (w MergeWindow) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minutes >= w.start && minutes < w.end
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minutes >= w.start) || (w.days[yesterday] && minutes < w.end)
+}
+
+// nextStart returns when the window next opens after t.
+func (w MergeWindow) nextStart(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, w.start/60, w.start%60, 0, 0, t.Location())
+		if w.days[start.Weekday()] && start.After(t) {
+			return start
+		}
+	}
+	// Every window is on at least one day of the week.
+	return t
+}
+
+// inMergeWindows reports whether pull requests may be merged at now, which
+// they always may if there are no windows.
+func inMergeWindows(windows []MergeWindow, now time.Time) bool {
+	for _, window := range windows {
+		if window.contains(now) {
+			return true
+		}
+	}
+	return len(windows) == 0
+}
+
+// nextMergeWindow returns when the first of the windows next opens after now.
+func nextMergeWindow(windows []MergeWindow, now time.Time) time.Time {
+	var next time.Time
+	for _, window := range windows {
+		if start := window.nextStart(now); next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// outsideMergeWindows reports whether the pull request, which is ready to be
+// merged, has to wait for the next merge window, logging when that is if it
+// does.
+func outsideMergeWindows(ctx context.Context, pullRequest *github.PullRequest, opts *Options) bool {
+	now := time.Now()
+	if opts.Location != nil {
+		now = now.In(opts.Location)
+	}
+	if inMergeWindows(opts.MergeWindows, now) {
+		return false
+	}
+	logInfo(
+		ctx,
+		pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "merge window"),
+		"Pull request %d is ready but it is outside the merge windows. Not merging it until %s.",
+		pullRequest.GetNumber(),
+		nextMergeWindow(opts.MergeWindows, now).Format("Mon 2 Jan 15:04 MST"),
+	)
+	return true
+}
+
+// heldByFreeze reports whether the pull request, which is ready to be merged,
+// is held back by a freeze, logging the freeze if it is.
+func heldByFreeze(ctx context.Context, pullRequest *github.PullRequest, opts *Options) bool {
+	if opts.frozen == "" {
+		return false
+	}
+	logInfo(
+		ctx,
+		pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "freeze"),
+		"Pull request %d is ready but it is held by a freeze: %s. Not merging it.",
+		pullRequest.GetNumber(),
+		opts.frozen,
+	)
+	return true
+}
+
+// Freeze is a period, such as a release week or holidays, during which
+// nothing is merged.
+type Freeze struct {
+	source string
+	name   string
+	// start is when the freeze begins and end when it is lifted.
+	start, end time.Time
+}
+
+// ParseFreeze parses a freeze of the form [<name>=]<start>/<end>, such as
+// holidays=2024-12-20/2025-01-03. Start and end are dates, to freeze from the
+// start of the first day to the end of the last, or times of the form
+// 2006-01-02T15:04, in the location.
+func ParseFreeze(freeze string, location *time.Location) (Freeze, error) {
+	f := Freeze{source: freeze}
+	period := freeze
+	if i := strings.Index(freeze, "="); i >= 0 {
+		f.name, period = freeze[:i], freeze[i+1:]
+	}
+	bounds := strings.Split(period, "/")
+	if len(bounds) != 2 {
+		return Freeze{}, fmt.Errorf("expected freeze to be of the form [<name>=]<start>/<end>. '%s' is not", freeze)
+	}
+	var err error
+	if f.start, _, err = parseFreezeTime(bounds[0], location); err != nil {
+		return Freeze{}, err
+	}
+	end, dateOnly, err := parseFreezeTime(bounds[1], location)
+	if err != nil {
+		return Freeze{}, err
+	}
+	f.end = end
+	if dateOnly {
+		f.end = end.AddDate(0, 0, 1)
+	}
+	if !f.end.After(f.start) {
+		return Freeze{}, fmt.Errorf("freeze %s ends before it starts", freeze)
+	}
+	return f, nil
+}
+
+// parseFreezeTime parses a date or a date and time in the location, reporting
+// whether it was only a date.
+func parseFreezeTime(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, location)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected %s to be a date (2006-01-02) or a time (2006-01-02T15:04)", value)
+	}
+	return t, false, nil
+}
+
+func (f Freeze) String() string {
+	return f.source
+}
+
+// describe describes the freeze for logs and reports.
+func (f Freeze) describe() string {
+	until := f.end.Format("Mon 2 Jan 2006 15:04 MST")
+	if f.name == "" {
+		return "Merging is frozen until " + until
+	}
+	return fmt.Sprintf("Merging is frozen for %s until %s", f.name, until)
+}
+
+// activeFreeze returns the freeze in effect at now, if any.
+func activeFreeze(freezes []Freeze, now time.Time) *Freeze {
+	for i, freeze := range freezes {
+		if !now.Before(freeze.start) && now.Before(freeze.end) {
+			return &freezes[i]
+		}
+	}
+	return nil
+}
+
+// frozenOptions returns opts as a dry run if one of its freezes is in effect,
+// logging and reporting the freeze. Otherwise opts is returned as it is.
+func frozenOptions(ctx context.Context, opts *Options) *Options {
+	freeze := activeFreeze(opts.Freezes, time.Now())
+	if freeze == nil {
+		return opts
+	}
+	logWarn(ctx, nil, "%s. Only reporting on pull requests rather than merging them.", freeze.describe())
+	reportFor(ctx).addFreeze(freeze.describe())
+	frozen := *opts
+	frozen.DryRun = true
+	frozen.frozen = freeze.describe()
+	return &frozen
+}
+
+// repositoryFreeze describes what freezes the repository with the label: an
+// open issue or pull request with it, or the label being one of the
+// repository's topics. Nothing is returned if the repository isn't frozen.
+func repositoryFreeze(ctx context.Context, client *github.Client, owner, repoName, label string) (string, error) {
+	issues, _, err := client.Issues.ListByRepo(ctx, owner, repoName, &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{label},
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve issues labelled %s: %w", label, err)
+	}
+	if len(issues) > 0 {
+		return fmt.Sprintf("Merging is frozen in %s/%s by #%d %s", owner, repoName, issues[0].GetNumber(), issues[0].GetTitle()), nil
+	}
+
+	repo, _, err := client.Repositories.Get(ctx, owner, repoName)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve the topics of %s/%s: %w", owner, repoName, err)
+	}
+	if hasTopic(repo, label) {
+		return fmt.Sprintf("Merging is frozen in %s/%s by its %s topic", owner, repoName, label), nil
+	}
+	return "", nil
+}
+
+// frozenRepositoryOptions returns opts as a dry run if the repository is
+// frozen by opts.FreezeLabel, logging and reporting the freeze. Otherwise opts
+// is returned as it is.
+func frozenRepositoryOptions(ctx context.Context, client *github.Client, owner, repoName string, opts *Options) (*Options, error) {
+	if opts.FreezeLabel == "" || opts.DryRun {
+		return opts, nil
+	}
+	freeze, err := repositoryFreeze(ctx, client, owner, repoName, opts.FreezeLabel)
+	if err != nil || freeze == "" {
+		return opts, err
+	}
+	logWarn(ctx, logFields{"repo": owner + "/" + repoName}, "%s. Only reporting on its pull requests rather than merging them.", freeze)
+	reportFor(ctx).addFreeze(freeze)
+	frozen := *opts
+	frozen.DryRun = true
+	frozen.frozen = freeze
+	return &frozen, nil
+}
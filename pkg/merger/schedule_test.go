@@ -0,0 +1,133 @@
+package merger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeWindowContains(t *testing.T) {
+	// 2 January 2023 was a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"Mon-Fri 09:00-16:00", at(2, 9, 0), true},
+		{"Mon-Fri 09:00-16:00", at(2, 15, 59), true},
+		{"Mon-Fri 09:00-16:00", at(2, 16, 0), false},
+		{"Mon-Fri 09:00-16:00", at(2, 8, 59), false},
+		{"Mon-Fri 09:00-16:00", at(7, 12, 0), false},
+		{"Saturday 10:00-12:00", at(7, 11, 0), true},
+		{"Fri-Mon 10:00-12:00", at(8, 11, 0), true},
+		{"Fri-Mon 10:00-12:00", at(4, 11, 0), false},
+		{"00:00-24:00", at(8, 23, 59), true},
+		{"Fri 22:00-02:00", at(6, 23, 0), true},
+		{"Fri 22:00-02:00", at(7, 1, 59), true},
+		{"Fri 22:00-02:00", at(7, 2, 0), false},
+		{"Fri 22:00-02:00", at(5, 1, 0), false},
+	}
+	for _, test := range tests {
+		window, err := ParseMergeWindow(test.window)
+		if err != nil {
+			t.Fatalf("ParseMergeWindow(%s) failed: %v", test.window, err)
+		}
+		if got := window.contains(test.t); got != test.want {
+			t.Errorf("%s contains %s = %t, want %t", test.window, test.t.Format(time.RFC1123), got, test.want)
+		}
+	}
+}
+
+func TestNextMergeWindow(t *testing.T) {
+	windows := []MergeWindow{}
+	for _, source := range []string{"Mon-Fri 09:00-16:00", "Sat 10:00-11:00"} {
+		window, err := ParseMergeWindow(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		windows = append(windows, window)
+	}
+	tests := []struct {
+		now, want time.Time
+	}{
+		// Friday evening to Saturday morning.
+		{time.Date(2023, time.January, 6, 17, 0, 0, 0, time.UTC), time.Date(2023, time.January, 7, 10, 0, 0, 0, time.UTC)},
+		// Saturday afternoon to Monday morning.
+		{time.Date(2023, time.January, 7, 12, 0, 0, 0, time.UTC), time.Date(2023, time.January, 9, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := nextMergeWindow(windows, test.now); !got.Equal(test.want) {
+			t.Errorf("nextMergeWindow(%s) = %s, want %s", test.now, got, test.want)
+		}
+	}
+}
+
+func TestParseMergeWindowErrors(t *testing.T) {
+	for _, window := range []string{"", "Mon-Fri", "Funday 09:00-10:00", "Mon 9:00-10:00", "Mon 09:00-25:00", "09:00-09:00", "Mon Tue 09:00-10:00"} {
+		if _, err := ParseMergeWindow(window); err == nil {
+			t.Errorf("ParseMergeWindow(%s) succeeded, want an error", window)
+		}
+	}
+}
+
+func TestActiveFreeze(t *testing.T) {
+	var freezes []Freeze
+	for _, source := range []string{"holidays=2022-12-20/2023-01-03", "2023-03-10T12:00/2023-03-11T09:00"} {
+		freeze, err := ParseFreeze(source, time.Local)
+		if err != nil {
+			t.Fatalf("ParseFreeze(%s) failed: %v", source, err)
+		}
+		freezes = append(freezes, freeze)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2023, month, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{at(time.January, 1, 12, 0), "holidays=2022-12-20/2023-01-03"},
+		{at(time.January, 3, 23, 59), "holidays=2022-12-20/2023-01-03"},
+		{at(time.January, 4, 0, 0), ""},
+		{at(time.March, 10, 11, 59), ""},
+		{at(time.March, 10, 12, 0), "2023-03-10T12:00/2023-03-11T09:00"},
+		{at(time.March, 11, 9, 0), ""},
+	}
+	for _, test := range tests {
+		got := ""
+		if freeze := activeFreeze(freezes, test.t); freeze != nil {
+			got = freeze.String()
+		}
+		if got != test.want {
+			t.Errorf("activeFreeze at %s = %q, want %q", test.t.Format(time.RFC1123), got, test.want)
+		}
+	}
+}
+
+func TestParseFreezeErrors(t *testing.T) {
+	for _, source := range []string{"", "2023-01-01", "2023-01-05/2023-01-04", "2023-01-01/soon", "2023-01-01T09:00/2023-01-01T09:00"} {
+		if _, err := ParseFreeze(source, time.Local); err == nil {
+			t.Errorf("ParseFreeze(%q) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestParseFreezeLocation(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("No time zone database: %v", err)
+	}
+	freeze, err := ParseFreeze("2023-01-02/2023-01-02", sydney)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sydney is 11 hours ahead of UTC in January.
+	if got := activeFreeze([]Freeze{freeze}, time.Date(2023, time.January, 1, 13, 0, 0, 0, time.UTC)); got == nil {
+		t.Errorf("freeze in Sydney isn't active at 13:00 UTC the day before")
+	}
+	if got := activeFreeze([]Freeze{freeze}, time.Date(2023, time.January, 2, 13, 0, 0, 0, time.UTC)); got != nil {
+		t.Errorf("freeze in Sydney is still active at 13:00 UTC on the day")
+	}
+}
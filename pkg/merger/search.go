@@ -0,0 +1,97 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// searchPullRequestsQuery fetches the pull requests matching a search.
+const searchPullRequestsQuery = `
+query($query: String!, $first: Int!, $after: String) {
+  search(query: $query, type: ISSUE, first: $first, after: $after) {
+    pageInfo { hasNextPage endCursor }
+    nodes { ...evaluatedPullRequest }
+  }
+}` + pullRequestFragment
+
+// pullRequestSearch returns the search query for the open pull requests in
+// the repository with all of the labels if matchAll is set, otherwise with
+// any of them.
+func pullRequestSearch(owner, repoName string, labels []string, matchAll bool) string {
+	terms := []string{"is:pr", "is:open", fmt.Sprintf("repo:%s/%s", owner, repoName)}
+	quoted := []string{}
+	for _, label := range labels {
+		quoted = append(quoted, fmt.Sprintf("%q", label))
+	}
+	if len(quoted) > 0 {
+		if matchAll {
+			for _, label := range quoted {
+				terms = append(terms, "label:"+label)
+			}
+		} else {
+			// Comma separated labels match any of them.
+			terms = append(terms, "label:"+strings.Join(quoted, ","))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchPullRequests retrieves the pull requests matching the search query.
+// Search only returns them as issues, so each one is then fetched as a pull
+// request.
+func searchPullRequests(ctx context.Context, client *github.Client, owner, repoName, query string, perPage int) ([]*github.PullRequest, error) {
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: perPage}}
+	allPullRequests := []*github.PullRequest{}
+	for {
+		result, resp, err := client.Search.Issues(ctx, query, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range result.Issues {
+			pullRequest, _, err := client.PullRequests.Get(ctx, owner, repoName, issue.GetNumber())
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve pull request %d: %w", issue.GetNumber(), err)
+			}
+			allPullRequests = append(allPullRequests, pullRequest)
+		}
+		if resp.NextPage == 0 {
+			return allPullRequests, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// searchPullRequestsGraphQL retrieves the pull requests matching the search
+// query along with their checks, reviews and mergeability, like
+// listPullRequestsGraphQL.
+func searchPullRequestsGraphQL(ctx context.Context, client *github.Client, query string) ([]*github.PullRequest, map[int]*prefetchedPullRequest, error) {
+	allPullRequests := []*github.PullRequest{}
+	prefetched := map[int]*prefetchedPullRequest{}
+	variables := map[string]interface{}{
+		"query": query,
+		"first": graphQLPullRequestsPageSize,
+	}
+	for {
+		var result struct {
+			Search struct {
+				PageInfo graphQLPageInfo      `json:"pageInfo"`
+				Nodes    []graphQLPullRequest `json:"nodes"`
+			} `json:"search"`
+		}
+		if err := graphQL(ctx, client, searchPullRequestsQuery, variables, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, node := range result.Search.Nodes {
+			pullRequest, fetched := node.convert()
+			allPullRequests = append(allPullRequests, pullRequest)
+			prefetched[pullRequest.GetNumber()] = fetched
+		}
+		if !result.Search.PageInfo.HasNextPage {
+			return allPullRequests, prefetched, nil
+		}
+		variables["after"] = result.Search.PageInfo.EndCursor
+	}
+}
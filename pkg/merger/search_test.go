@@ -0,0 +1,22 @@
+package merger
+
+import "testing"
+
+func TestPullRequestSearch(t *testing.T) {
+	tests := []struct {
+		labels   []string
+		matchAll bool
+		query    string
+	}{
+		{nil, true, `is:pr is:open repo:nick96/merger`},
+		{[]string{"dependencies"}, true, `is:pr is:open repo:nick96/merger label:"dependencies"`},
+		{[]string{"dependencies", "automerge"}, true, `is:pr is:open repo:nick96/merger label:"dependencies" label:"automerge"`},
+		{[]string{"dependencies", "ready to merge"}, false, `is:pr is:open repo:nick96/merger label:"dependencies","ready to merge"`},
+	}
+
+	for _, test := range tests {
+		if query := pullRequestSearch("nick96", "merger", test.labels, test.matchAll); query != test.query {
+			t.Errorf("pullRequestSearch(%v, %t) = %s, want %s", test.labels, test.matchAll, query, test.query)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// mergeSerially checks and merges the pull request after making sure it has
+// been tested against the current head of its base branch. If earlier pull
+// requests have been merged since its checks ran, its branch is updated and
+// its checks are waited on before it is considered for merging. Whether it
+// was merged is returned.
+func mergeSerially(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (bool, error) {
+	comparison, _, err := client.Repositories.CompareCommits(
+		ctx,
+		owner,
+		repoName,
+		pullRequest.GetBase().GetRef(),
+		pullRequest.GetHead().GetSHA(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare pull request %d with its base: %w", pullRequest.GetNumber(), err)
+	}
+	if comparison.GetBehindBy() == 0 {
+		return checkAndMerge(ctx, client, owner, repoName, pullRequest, opts)
+	}
+
+	if opts.DryRun {
+		logInfo(ctx, pullRequestFields(pullRequest), "Would update the branch of pull request %d and wait for its checks (dry run)", pullRequest.GetNumber())
+		return false, nil
+	}
+	updated, err := updateBranchAndWait(ctx, client, owner, repoName, pullRequest, opts.SerialTimeout, opts)
+	if err != nil {
+		return false, err
+	}
+	return checkAndMerge(ctx, client, owner, repoName, updated, opts)
+}
+
+// waitForNewHead waits for the head of the pull request to move on from its
+// current commit, which is how updating its branch shows up.
+func waitForNewHead(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, deadline time.Time) (*github.PullRequest, error) {
+	for {
+		refreshed, _, err := client.PullRequests.Get(ctx, owner, repoName, pullRequest.GetNumber())
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		if refreshed.GetHead().GetSHA() != pullRequest.GetHead().GetSHA() {
+			return refreshed, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("branch of pull request %d was not updated in time", pullRequest.GetNumber())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(checksPollInterval):
+		}
+	}
+}
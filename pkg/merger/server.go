@@ -0,0 +1,167 @@
+package merger
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// webhookHandler receives GitHub webhooks and checks and merges the pull
+// request affected by each event as soon as it arrives.
+type webhookHandler struct {
+	merger *Merger
+	client *github.Client
+	repos  []Repository
+	secret []byte
+	opts   *Options
+
+	// mu serialises evaluation so that two events for the same pull request
+	// can't both try to merge it.
+	mu sync.Mutex
+	// evaluating tracks the evaluations still to finish, so shutting down can
+	// wait for them.
+	evaluating sync.WaitGroup
+}
+
+func newWebhookHandler(m *Merger, repos []Repository, secret []byte) *webhookHandler {
+	return &webhookHandler{
+		merger: m,
+		client: m.client,
+		repos:  repos,
+		secret: secret,
+		opts:   m.opts,
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := github.ValidatePayload(r, h.secret)
+	if err != nil {
+		logWarn(r.Context(), nil, "Rejecting webhook with invalid signature: %v", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	eventType := github.WebHookType(r)
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		logWarn(r.Context(), nil, "Failed to parse %s webhook: %v", eventType, err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	eventRepo, numbers := pullRequestsForEvent(event)
+	repo, ok := h.findRepository(eventRepo)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// GitHub gives up on webhook deliveries after 10 seconds, so acknowledge
+	// the event straight away and do the work in the background.
+	w.WriteHeader(http.StatusAccepted)
+	for _, number := range numbers {
+		h.evaluating.Add(1)
+		go func(number int) {
+			defer h.evaluating.Done()
+			h.evaluate(repo, number)
+		}(number)
+	}
+}
+
+// wait waits for the pull requests from the webhooks already received to be
+// checked.
+func (h *webhookHandler) wait() {
+	h.evaluating.Wait()
+}
+
+// findRepository returns the configured repository the event came from, if
+// any.
+func (h *webhookHandler) findRepository(eventRepo *github.Repository) (Repository, bool) {
+	if eventRepo == nil {
+		return Repository{}, false
+	}
+	for _, repo := range h.repos {
+		if eventRepo.GetOwner().GetLogin() == repo.owner && eventRepo.GetName() == repo.name {
+			return repo, true
+		}
+	}
+	return Repository{}, false
+}
+
+func (h *webhookHandler) evaluate(repo Repository, number int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ctx := h.merger.instrument(context.Background())
+	if shuttingDown() {
+		logInfo(ctx, logFields{"repo": repo.String(), "pr": number}, "Shutting down. Not checking pull request %d in %s.", number, repo)
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+	if h.opts.notifying() {
+		r := newReport()
+		ctx = withReport(ctx, r)
+		defer notifyRun(context.Background(), r, h.opts, h.merger.blocked, h.merger.decisions)
+	}
+	pullRequest, _, err := h.client.PullRequests.Get(ctx, repo.owner, repo.name, number)
+	if err != nil {
+		logError(ctx, logFields{"repo": repo.String(), "pr": number, "error": err.Error()}, "Failed to retrieve pull request %d from %s: %v", number, repo, err)
+		return
+	}
+	if pullRequest.GetState() != "open" {
+		logInfo(ctx, pullRequestFields(pullRequest).with("decision", "skipped").with("cause", "closed"), "Skipping pull request %d in %s as it is %s", number, repo, pullRequest.GetState())
+		return
+	}
+
+	opts, err := repositoryOptions(ctx, h.client, repo.owner, repo.name, frozenOptions(ctx, h.opts))
+	if err != nil {
+		logError(ctx, logFields{"repo": repo.String(), "error": err.Error()}, "Failed to configure %s: %v", repo, err)
+		return
+	}
+
+	candidates := filterPullRequestsByLabels([]*github.PullRequest{pullRequest}, opts.Labels, opts.MatchAll)
+	for _, candidate := range candidates {
+		reportFor(ctx).track(candidate)
+	}
+	candidates = filterIneligiblePullRequests(ctx, candidates, opts)
+	for _, candidate := range candidates {
+		candidateCtx, span := startSpan(ctx, "evaluate pull request", pullRequestFields(candidate))
+		_, err := checkAndMerge(candidateCtx, h.client, repo.owner, repo.name, candidate, opts)
+		span.end(err)
+		if err != nil {
+			logError(ctx, pullRequestFields(candidate).with("decision", "failed").with("error", err.Error()), "%v", err)
+			addLabel(ctx, h.client, repo.owner, repo.name, candidate, opts.FailureLabel)
+		}
+	}
+}
+
+// pullRequestsForEvent returns the repository and numbers of the pull
+// requests affected by the webhook event. Events merger doesn't care about
+// return a nil repository.
+func pullRequestsForEvent(event interface{}) (*github.Repository, []int) {
+	switch event := event.(type) {
+	case *github.CheckSuiteEvent:
+		if event.GetAction() != "completed" {
+			return nil, nil
+		}
+		numbers := []int{}
+		for _, pullRequest := range event.GetCheckSuite().PullRequests {
+			numbers = append(numbers, pullRequest.GetNumber())
+		}
+		return event.GetRepo(), numbers
+	case *github.PullRequestEvent:
+		return event.GetRepo(), []int{event.GetNumber()}
+	case *github.PullRequestReviewEvent:
+		return event.GetRepo(), []int{event.GetPullRequest().GetNumber()}
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,36 @@
+package merger
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdown is closed once merger has been asked to stop. Runs then finish the
+// pull request they are checking and stop there, rather than being killed
+// halfway through merging it.
+var shutdown = make(chan struct{})
+
+// shuttingDown reports whether merger has been asked to stop.
+func shuttingDown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// HandleShutdownSignals shuts merger down on SIGINT or SIGTERM, which
+// Kubernetes sends before killing a pod. A second signal kills merger straight away.
+func HandleShutdownSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		logInfo(context.Background(), nil, "Received %s, shutting down once the pull request being checked is done. Send it again to stop straight away.", sig)
+		close(shutdown)
+	}()
+}
@@ -0,0 +1,56 @@
+package merger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// unverifiedCommits describes each of the commits whose signature GitHub
+// couldn't verify, along with why, such as "unsigned" or "unknown_key".
+func unverifiedCommits(commits []*github.RepositoryCommit) []string {
+	unverified := []string{}
+	for _, commit := range commits {
+		verification := commit.GetCommit().GetVerification()
+		if verification.GetVerified() {
+			continue
+		}
+		unverified = append(unverified, fmt.Sprintf("%s (%s)", shortSHA(commit.GetSHA()), verification.GetReason()))
+	}
+	return unverified
+}
+
+// signOffTrailerPattern matches a Signed-off-by trailer, capturing the email
+// address of whoever signed off.
+var signOffTrailerPattern = regexp.MustCompile(`(?im)^signed-off-by:.*<([^>]+)>\s*$`)
+
+// commitsWithoutSignOff returns the commits that their author hasn't signed
+// off with a Signed-off-by trailer, as the Developer Certificate of Origin
+// requires.
+func commitsWithoutSignOff(commits []*github.RepositoryCommit) []string {
+	missing := []string{}
+	for _, commit := range commits {
+		author := commit.GetCommit().GetAuthor().GetEmail()
+		signedOff := false
+		for _, match := range signOffTrailerPattern.FindAllStringSubmatch(commit.GetCommit().GetMessage(), -1) {
+			if strings.EqualFold(strings.TrimSpace(match[1]), author) {
+				signedOff = true
+				break
+			}
+		}
+		if !signedOff {
+			missing = append(missing, shortSHA(commit.GetSHA()))
+		}
+	}
+	return missing
+}
+
+// shortSHA abbreviates the commit SHA like git does.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
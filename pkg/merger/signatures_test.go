@@ -0,0 +1,37 @@
+package merger
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestCommitsWithoutSignOff(t *testing.T) {
+	commit := func(sha, email, message string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			SHA: github.String(sha),
+			Commit: &github.Commit{
+				Author:  &github.CommitAuthor{Email: github.String(email)},
+				Message: github.String(message),
+			},
+		}
+	}
+	commits := []*github.RepositoryCommit{
+		commit("1111111aaaa", "nick@example.com", "Add -pr\n\nSigned-off-by: Nick <nick@example.com>"),
+		commit("2222222bbbb", "nick@example.com", "Fix typo\n\nsigned-off-by: Nick <NICK@example.com>\n"),
+		commit("3333333cccc", "octo@example.com", "Fix -pr\n\nSigned-off-by: Nick <nick@example.com>"),
+		commit("4444444dddd", "octo@example.com", "Document -pr"),
+		commit("5555555eeee", "octo@example.com", "Mention Signed-off-by: Octo <octo@example.com> in the README"),
+	}
+
+	missing := commitsWithoutSignOff(commits)
+	want := []string{"3333333", "4444444", "5555555"}
+	if len(missing) != len(want) {
+		t.Fatalf("commitsWithoutSignOff() = %v, want %v", missing, want)
+	}
+	for i := range want {
+		if missing[i] != want[i] {
+			t.Errorf("commitsWithoutSignOff()[%d] = %s, want %s", i, missing[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package merger
+
+import "context"
+
+// slackNotifier posts notifications to a Slack incoming webhook.
+type slackNotifier struct {
+	webhookURL string
+}
+
+// NewSlackNotifier returns a Notifier that posts to a Slack incoming webhook.
+func NewSlackNotifier(webhookURL string) Notifier {
+	return &slackNotifier{webhookURL: webhookURL}
+}
+
+func (n *slackNotifier) notify(ctx context.Context, event, message string) error {
+	return postJSON(ctx, n.webhookURL, map[string]string{"text": message})
+}
+
+func (n *slackNotifier) String() string {
+	return "Slack"
+}
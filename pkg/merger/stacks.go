@@ -0,0 +1,97 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// orderStacks orders the pull requests so that pull requests stacked on top of
+// another, by targeting its head branch, come after it. This lets a stack be
+// merged from the bottom up in a single run.
+func orderStacks(pullRequests []*github.PullRequest) []*github.PullRequest {
+	byHead := map[string]*github.PullRequest{}
+	for _, pullRequest := range pullRequests {
+		if !isFromFork(pullRequest) {
+			byHead[pullRequest.GetHead().GetRef()] = pullRequest
+		}
+	}
+
+	ordered := []*github.PullRequest{}
+	visited := map[int]bool{}
+	var visit func(pullRequest *github.PullRequest)
+	visit = func(pullRequest *github.PullRequest) {
+		if visited[pullRequest.GetNumber()] {
+			return
+		}
+		visited[pullRequest.GetNumber()] = true
+		if below, ok := byHead[pullRequest.GetBase().GetRef()]; ok {
+			visit(below)
+		}
+		ordered = append(ordered, pullRequest)
+	}
+	for _, pullRequest := range pullRequests {
+		visit(pullRequest)
+	}
+	return ordered
+}
+
+// stackedOn returns the open pull request whose head branch the pull request
+// targets, or nil if it isn't stacked on another pull request.
+func stackedOn(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) (*github.PullRequest, error) {
+	base := pullRequest.GetBase()
+	if base.GetRef() == base.GetRepo().GetDefaultBranch() {
+		return nil, nil
+	}
+	pullRequests, _, err := client.PullRequests.List(ctx, owner, repoName, &github.PullRequestListOptions{
+		State: "open",
+		Head:  owner + ":" + base.GetRef(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests from %s: %w", base.GetRef(), err)
+	}
+	if len(pullRequests) == 0 {
+		return nil, nil
+	}
+	return pullRequests[0], nil
+}
+
+// retargetStackedPullRequests changes the base of the pull requests stacked on
+// the merged pull request to its base, so they can be merged next. This has to
+// happen before the merged pull request's branch is deleted, as GitHub closes
+// pull requests whose base branch is deleted.
+func retargetStackedPullRequests(ctx context.Context, client *github.Client, owner, repoName string, merged *github.PullRequest, perPage int) {
+	if isFromFork(merged) {
+		return
+	}
+
+	head := merged.GetHead().GetRef()
+	base := merged.GetBase().GetRef()
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        head,
+		ListOptions: github.ListOptions{PerPage: perPage},
+	}
+	for {
+		pullRequests, resp, err := client.PullRequests.List(ctx, owner, repoName, opts)
+		if err != nil {
+			logWarn(ctx, pullRequestFields(merged), "Failed to list pull requests stacked on pull request %d: %v", merged.GetNumber(), err)
+			return
+		}
+		for _, pullRequest := range pullRequests {
+			_, _, err := client.PullRequests.Edit(ctx, owner, repoName, pullRequest.GetNumber(), &github.PullRequest{
+				Base: &github.PullRequestBranch{Ref: github.String(base)},
+			})
+			if err != nil {
+				logWarn(ctx, pullRequestFields(pullRequest), "Failed to retarget pull request %d from %s to %s: %v", pullRequest.GetNumber(), head, base, err)
+				continue
+			}
+			logInfo(ctx, pullRequestFields(pullRequest), "Retargeted pull request %d from %s to %s", pullRequest.GetNumber(), head, base)
+		}
+		if resp.NextPage == 0 {
+			return
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,126 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// DefaultStaleLabel is the label added to stale pull requests by the label
+// stale action, unless overridden with -stale-label.
+const DefaultStaleLabel = "stale-automerge"
+
+// staleCommentMarker is a hidden marker in the comment merger posts on stale
+// pull requests, used to only post it once.
+const staleCommentMarker = "<!-- merger:stale -->"
+
+// staleActions are what can be done about pull requests that have been
+// blocked for longer than -stale-after.
+var staleActions = []string{"comment", "label", "unlabel"}
+
+// IsValidStaleAction reports whether action is one of comment, label or
+// unlabel.
+func IsValidStaleAction(action string) bool {
+	for _, staleAction := range staleActions {
+		if action == staleAction {
+			return true
+		}
+	}
+	return false
+}
+
+// labelledAt returns when one of the labels was last added to the pull
+// request, or when it was opened if none of them has been.
+func labelledAt(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, labels []string, perPage int) (time.Time, error) {
+	labelled := pullRequest.GetCreatedAt()
+	opts := &github.ListOptions{PerPage: perPage}
+	for {
+		events, resp, err := client.Issues.ListIssueEvents(ctx, owner, repoName, pullRequest.GetNumber(), opts)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, event := range events {
+			if event.GetEvent() != "labeled" || !isMergeLabel(event.GetLabel().GetName(), labels) {
+				continue
+			}
+			if createdAt := event.GetCreatedAt(); createdAt.After(labelled) {
+				labelled = createdAt
+			}
+		}
+		if resp.NextPage == 0 {
+			return labelled, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func isMergeLabel(label string, labels []string) bool {
+	for _, expectedLabel := range labels {
+		if label == expectedLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// readyToMergeOrStale is readyToMerge for pull requests that are about to be
+// merged. Those it finds blocked have opts.StaleAction taken on them once they
+// have been blocked for long enough. Those that are ready are left alone, even
+// if a merge window or -max-merges then holds them.
+func readyToMergeOrStale(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) (*github.PullRequest, error) {
+	ready, err := readyToMerge(ctx, client, owner, repoName, pullRequest, opts)
+	if ready == nil && err == nil {
+		err = handleStale(ctx, client, owner, repoName, pullRequest, opts)
+	}
+	return ready, err
+}
+
+// handleStale takes opts.StaleAction on the pull request, which is blocked,
+// if it has been labelled for merging for longer than opts.StaleAfter. Each
+// action is only taken once, so later runs leave the pull request alone.
+func handleStale(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, opts *Options) error {
+	if opts.StaleAfter <= 0 || (opts.StaleAction == "label" && hasLabel(pullRequest, opts.StaleLabel)) {
+		return nil
+	}
+	labelled, err := labelledAt(ctx, client, owner, repoName, pullRequest, opts.Labels, opts.PerPage)
+	if err != nil {
+		return fmt.Errorf("failed to get when pull request %d was labelled: %w", pullRequest.GetNumber(), err)
+	}
+	if time.Since(labelled) < opts.StaleAfter {
+		return nil
+	}
+
+	fields := pullRequestFields(pullRequest).with("stale", opts.StaleAction)
+	if opts.DryRun {
+		logInfo(ctx, fields, "Pull request %d has been blocked for more than %s. Would %s it (dry run).", pullRequest.GetNumber(), opts.StaleAfter, opts.StaleAction)
+		return nil
+	}
+	switch opts.StaleAction {
+	case "comment":
+		existing, err := findComment(ctx, client, owner, repoName, pullRequest.GetNumber(), staleCommentMarker, opts.PerPage)
+		if err != nil {
+			return fmt.Errorf("failed to list comments of pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		if existing != nil {
+			return nil
+		}
+		body := fmt.Sprintf(
+			"%s\nThis pull request has been waiting to be merged for more than %s but is still blocked. It needs someone to look at why, or to have its label removed if it shouldn't be merged.",
+			staleCommentMarker,
+			opts.StaleAfter,
+		)
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repoName, pullRequest.GetNumber(), &github.IssueComment{Body: &body}); err != nil {
+			return fmt.Errorf("failed to comment on stale pull request %d: %w", pullRequest.GetNumber(), err)
+		}
+		logInfo(ctx, fields, "Commented on pull request %d as it has been blocked for more than %s", pullRequest.GetNumber(), opts.StaleAfter)
+	case "label":
+		addLabel(ctx, client, owner, repoName, pullRequest, opts.StaleLabel)
+		logInfo(ctx, fields, "Labelled pull request %d %s as it has been blocked for more than %s", pullRequest.GetNumber(), opts.StaleLabel, opts.StaleAfter)
+	case "unlabel":
+		logInfo(ctx, fields, "Pull request %d has been blocked for more than %s. No longer trying to merge it.", pullRequest.GetNumber(), opts.StaleAfter)
+		removeLabels(ctx, client, owner, repoName, pullRequest, opts.Labels)
+	}
+	return nil
+}
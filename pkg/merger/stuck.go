@@ -0,0 +1,88 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// actionsAppSlug is the slug of the GitHub App that creates the check runs of
+// GitHub Actions jobs, the only ones merger knows how to cancel.
+const actionsAppSlug = "github-actions"
+
+// stuckCheckRuns returns the check runs that have been queued or in progress
+// since before the threshold, as of now.
+func stuckCheckRuns(checkRuns []*github.CheckRun, after time.Duration, now time.Time) []*github.CheckRun {
+	stuck := []*github.CheckRun{}
+	for _, checkRun := range checkRuns {
+		if checkRun.GetStatus() == "completed" {
+			continue
+		}
+		if startedAt := checkRun.GetStartedAt().Time; !startedAt.IsZero() && now.Sub(startedAt) >= after {
+			stuck = append(stuck, checkRun)
+		}
+	}
+	return stuck
+}
+
+// handleStuckChecks reports the check runs of the pull request that have been
+// queued or in progress for longer than opts.StuckCheckAfter, which GitHub
+// would otherwise leave blocking it for days. With opts.CancelStuckChecks the
+// workflow runs of stuck GitHub Actions jobs are cancelled, so they fail and
+// can be re-run. Failures to cancel are only logged.
+func handleStuckChecks(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, blocking []BlockingCheck, opts *Options) error {
+	pending := false
+	for _, check := range blocking {
+		if isPendingState(check.State) {
+			pending = true
+		}
+	}
+	if !pending {
+		return nil
+	}
+
+	checkRuns, err := listCheckRuns(ctx, client, owner, repoName, pullRequest.GetHead().GetSHA(), opts.PerPage)
+	if err != nil {
+		return fmt.Errorf("failed to get check runs for pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	checkRuns, _ = filterIgnoredChecks(checkRuns, nil, opts.IgnoreChecks)
+	for _, checkRun := range stuckCheckRuns(checkRuns, opts.StuckCheckAfter, time.Now()) {
+		fields := pullRequestFields(pullRequest).
+			with("decision", "blocked").
+			with("cause", "stuck checks").
+			with("checks", "stuck").
+			with("check", checkRun.GetName()).
+			with("state", "stuck")
+		logWarn(
+			ctx,
+			fields,
+			"Check run %s for pull request %d has been %s since %s, longer than %s. It may be stuck.",
+			checkRun.GetName(),
+			pullRequest.GetNumber(),
+			checkRun.GetStatus(),
+			checkRun.GetStartedAt().Format("Mon 2 Jan 15:04 MST"),
+			opts.StuckCheckAfter,
+		)
+		if !opts.CancelStuckChecks || checkRun.GetApp().GetSlug() != actionsAppSlug {
+			continue
+		}
+		if opts.DryRun {
+			logInfo(ctx, pullRequestFields(pullRequest), "Would cancel the workflow run of stuck check run %s (dry run)", checkRun.GetName())
+			continue
+		}
+		// The check runs of GitHub Actions jobs have the same ID as the job.
+		job, _, err := client.Actions.GetWorkflowJobByID(ctx, owner, repoName, checkRun.GetID())
+		if err != nil {
+			logWarn(ctx, pullRequestFields(pullRequest), "Failed to find the workflow run of stuck check run %s: %v", checkRun.GetName(), err)
+			continue
+		}
+		if _, err := client.Actions.CancelWorkflowRunByID(ctx, owner, repoName, job.GetRunID()); err != nil {
+			logWarn(ctx, pullRequestFields(pullRequest), "Failed to cancel workflow run %d of stuck check run %s: %v", job.GetRunID(), checkRun.GetName(), err)
+			continue
+		}
+		logInfo(ctx, pullRequestFields(pullRequest), "Cancelled workflow run %d of stuck check run %s", job.GetRunID(), checkRun.GetName())
+	}
+	return nil
+}
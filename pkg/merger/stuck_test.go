@@ -0,0 +1,36 @@
+package merger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func TestStuckCheckRuns(t *testing.T) {
+	now := time.Date(2023, time.January, 2, 12, 0, 0, 0, time.UTC)
+	checkRun := func(name, status string, started time.Duration) *github.CheckRun {
+		return &github.CheckRun{
+			Name:      github.String(name),
+			Status:    github.String(status),
+			StartedAt: &github.Timestamp{Time: now.Add(-started)},
+		}
+	}
+	checkRuns := []*github.CheckRun{
+		checkRun("build", "completed", 5*time.Hour),
+		checkRun("test", "in_progress", 3*time.Hour),
+		checkRun("lint", "queued", 2*time.Hour),
+		checkRun("deploy", "in_progress", time.Hour),
+	}
+
+	stuck := stuckCheckRuns(checkRuns, 2*time.Hour, now)
+	want := []string{"test", "lint"}
+	if len(stuck) != len(want) {
+		t.Fatalf("stuckCheckRuns() returned %d check runs, want %v", len(stuck), want)
+	}
+	for i, name := range want {
+		if got := stuck[i].GetName(); got != name {
+			t.Errorf("stuckCheckRuns()[%d] = %s, want %s", i, got, name)
+		}
+	}
+}
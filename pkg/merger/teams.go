@@ -0,0 +1,44 @@
+package merger
+
+import "context"
+
+// teamsNotifier posts notifications to a Microsoft Teams incoming webhook as
+// adaptive cards.
+type teamsNotifier struct {
+	webhookURL string
+}
+
+// NewTeamsNotifier returns a Notifier that posts to a Microsoft Teams incoming
+// webhook.
+func NewTeamsNotifier(webhookURL string) Notifier {
+	return &teamsNotifier{webhookURL: webhookURL}
+}
+
+// teamsTitles are the headings of the cards for each event.
+var teamsTitles = map[string]string{
+	"merged":  "Pull request merged",
+	"blocked": "Pull request blocked",
+	"failed":  "Pull request failed to merge",
+}
+
+func (n *teamsNotifier) notify(ctx context.Context, event, message string) error {
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.2",
+		"body": []map[string]interface{}{
+			{"type": "TextBlock", "text": teamsTitles[event], "weight": "bolder", "size": "medium"},
+			{"type": "TextBlock", "text": message, "wrap": true},
+		},
+	}
+	return postJSON(ctx, n.webhookURL, map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	})
+}
+
+func (n *teamsNotifier) String() string {
+	return "Microsoft Teams"
+}
@@ -0,0 +1,69 @@
+package merger
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// DefaultMergeMessage is the commit message used when merging, unless
+// overridden with -merge-message.
+const DefaultMergeMessage = "Merged by merger"
+
+// DefaultBlockedComment is the template for the comment posted on pull
+// requests that are blocked by checks, unless overridden with
+// -blocked-comment.
+const DefaultBlockedComment = `merger is not merging this pull request because of the following checks:
+
+{{range .FailingChecks}}* {{if .URL}}[{{.Name}}]({{.URL}}){{else}}{{.Name}}{{end}}: {{.State}}
+{{end}}`
+
+// templateData is what the merge message, comment and notification templates
+// are executed with.
+type templateData struct {
+	Number        int
+	Title         string
+	Author        string
+	URL           string
+	Labels        []string
+	FailingChecks []BlockingCheck
+	// Repository and Reason are only set for notifications.
+	Repository string
+	Reason     string
+}
+
+func newTemplateData(pullRequest *github.PullRequest, failingChecks []BlockingCheck) templateData {
+	labels := []string{}
+	for _, label := range pullRequest.Labels {
+		labels = append(labels, label.GetName())
+	}
+	return templateData{
+		Number:        pullRequest.GetNumber(),
+		Title:         pullRequest.GetTitle(),
+		Author:        pullRequest.GetUser().GetLogin(),
+		URL:           pullRequest.GetHTMLURL(),
+		Labels:        labels,
+		FailingChecks: failingChecks,
+	}
+}
+
+// ValidateTemplate checks that text is a valid template.
+func ValidateTemplate(text string) error {
+	_, err := template.New("").Parse(text)
+	return err
+}
+
+// renderTemplate executes the template text with the given data.
+func renderTemplate(text string, data templateData) (string, error) {
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return rendered.String(), nil
+}
@@ -0,0 +1,324 @@
+package merger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracer buffers finished spans and exports them with OTLP over HTTP, using
+// its JSON encoding, once the root span of a trace ends.
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span is a single timed operation in a trace.
+type span struct {
+	tracer     *tracer
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	root       bool
+	name       string
+	startTime  time.Time
+	endTime    time.Time
+	attributes logFields
+	err        error
+}
+
+type spanContextKey struct{}
+
+type tracerKey struct{}
+
+// withTracer returns a context carrying the tracer that spans started with it
+// are collected by. Spans aren't recorded if t is nil.
+func withTracer(ctx context.Context, t *tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// OTLPEndpointFromEnv returns the OTLP traces endpoint set with the standard
+// OpenTelemetry environment variables, or an empty string if there isn't one.
+func OTLPEndpointFromEnv() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// newTracer creates a tracer exporting to endpoint. Headers to send with each
+// export and the service name are read from OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_SERVICE_NAME.
+func newTracer(endpoint string) (*tracer, error) {
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s: %w", endpoint, err)
+	}
+	headers := map[string]string{}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid header %q in OTEL_EXPORTER_OTLP_HEADERS, expected key=value", header)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q in OTEL_EXPORTER_OTLP_HEADERS: %w", header, err)
+		}
+		headers[strings.TrimSpace(parts[0])] = value
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "merger"
+	}
+	return &tracer{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// startSpan starts a span that is a child of the span in ctx, if there is one,
+// and returns a context carrying the new span. The span must be ended with
+// end. When ctx has no tracer the span is nil, which end ignores.
+func startSpan(ctx context.Context, name string, attributes logFields) (context.Context, *span) {
+	t, _ := ctx.Value(tracerKey{}).(*tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{tracer: t, name: name, startTime: time.Now(), attributes: attributes}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.root = true
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// end finishes the span, marking it as failed if err is non-nil. Ending the
+// root span of a trace exports it.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.endTime = time.Now()
+	s.err = err
+	s.tracer.add(s)
+	if s.root {
+		if err := s.tracer.export(); err != nil {
+			logWarn(context.Background(), nil, "Failed to export traces to %s: %v", s.tracer.endpoint, err)
+		}
+	}
+}
+
+func (t *tracer) add(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+}
+
+// otlpRequest is the JSON encoding of an OTLP ExportTraceServiceRequest,
+// with only the fields merger sets.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// The OTLP span kind and status codes merger uses.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// export sends the buffered spans to the endpoint, dropping them whether or
+// not that succeeds so they don't build up while the collector is down.
+func (t *tracer) export() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	otlpSpans := []otlpSpan{}
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.otlp())
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(logFields{"service.name": t.serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "merger"}, Spans: otlpSpans}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("collector responded with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (s *span) otlp() otlpSpan {
+	kind := otlpSpanKindInternal
+	if _, ok := s.attributes["http.method"]; ok {
+		kind = otlpSpanKindClient
+	}
+	status := otlpStatus{Code: otlpStatusOk}
+	if s.err != nil {
+		status = otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+	}
+	parentID := ""
+	if !s.root {
+		parentID = hex.EncodeToString(s.parentID[:])
+	}
+	return otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		ParentSpanID:      parentID,
+		Name:              s.name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(s.startTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.endTime.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+		Status:            status,
+	}
+}
+
+// otlpAttributes converts the fields to OTLP attributes, sorted by key.
+// Values other than strings, ints and bools are formatted as strings.
+func otlpAttributes(fields logFields) []otlpAttribute {
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := []otlpAttribute{}
+	for _, key := range keys {
+		var value otlpValue
+		switch v := fields[key].(type) {
+		case int:
+			formatted := strconv.Itoa(v)
+			value.IntValue = &formatted
+		case bool:
+			value.BoolValue = &v
+		default:
+			formatted := fmt.Sprint(v)
+			value.StringValue = &formatted
+		}
+		attributes = append(attributes, otlpAttribute{Key: key, Value: value})
+	}
+	return attributes
+}
+
+// tracingTransport records a span for every request to the GitHub API, as a
+// child of the span in the request's context.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, s := startSpan(req.Context(), "GitHub "+req.Method+" "+req.URL.Path, logFields{
+		"http.method": req.Method,
+		"http.url":    req.URL.String(),
+	})
+	resp, err := t.next.RoundTrip(req)
+	if s != nil {
+		spanErr := err
+		if err == nil {
+			s.attributes["http.status_code"] = resp.StatusCode
+			if resp.StatusCode >= 400 {
+				spanErr = fmt.Errorf("GitHub responded with %s", resp.Status)
+			}
+		}
+		s.end(spanErr)
+	}
+	return resp, err
+}
@@ -0,0 +1,188 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// trainBranchPrefix is prepended to the base branch's name to get the name of
+// the branch merge trains are built on.
+const trainBranchPrefix = "merger/train/"
+
+// runMergeTrain merges the pull requests, which must all be ready to merge,
+// in batches per base branch. Each batch is merged into a temporary branch
+// and the base branch is only fast-forwarded to it once the checks on the
+// combined result pass. If they fail, the batch is bisected to find the pull
+// requests that broke it. The number of pull requests that were merged and
+// the number that couldn't be are returned. Pull requests held back by the
+// merge windows, a freeze or the pre-merge command are neither. A base branch whose
+// train fails doesn't stop the trains for the others.
+func runMergeTrain(ctx context.Context, client *github.Client, owner, repoName string, pullRequests []*github.PullRequest, opts *Options) (int, int, error) {
+	merged, failures := 0, 0
+	batches := map[string][]*github.PullRequest{}
+	bases := []string{}
+	for _, pullRequest := range pullRequests {
+		if outsideMergeWindows(ctx, pullRequest, opts) || heldByFreeze(ctx, pullRequest, opts) {
+			continue
+		}
+		if !opts.DryRun {
+			passed, err := preMergeHookPassed(ctx, pullRequest, opts)
+			if err != nil {
+				logError(ctx, pullRequestFields(pullRequest).with("decision", "failed").with("error", err.Error()), "%v", err)
+				failures++
+			}
+			if !passed {
+				continue
+			}
+		}
+		base := pullRequest.GetBase().GetRef()
+		if _, ok := batches[base]; !ok {
+			bases = append(bases, base)
+		}
+		batches[base] = append(batches[base], pullRequest)
+	}
+
+	var trainErr error
+	for _, base := range bases {
+		batch := batches[base]
+		if opts.DryRun {
+			logInfo(ctx, logFields{"repo": owner + "/" + repoName}, "Would merge pull requests %s into %s in a merge train (dry run)", pullRequestNumbers(batch), base)
+			continue
+		}
+
+		// Every pull request in the batch that wasn't merged either broke
+		// the train or was left out when it failed.
+		batchMerged, err := runBatch(ctx, client, owner, repoName, base, batch, opts)
+		merged += batchMerged
+		failures += len(batch) - batchMerged
+		trainRef := "heads/" + trainBranchPrefix + base
+		if _, deleteErr := client.Git.DeleteRef(ctx, owner, repoName, trainRef); deleteErr != nil {
+			logWarn(ctx, nil, "Failed to delete merge train branch %s: %v", trainBranchPrefix+base, deleteErr)
+		}
+		if err != nil {
+			// Only the last error is returned, so log any earlier ones.
+			if trainErr != nil {
+				logError(ctx, logFields{"repo": owner + "/" + repoName, "error": trainErr.Error()}, "%v", trainErr)
+			}
+			trainErr = fmt.Errorf("failed to run merge train for %s: %w", base, err)
+		}
+	}
+	return merged, failures, trainErr
+}
+
+// runBatch tries to merge the batch of pull requests into base together,
+// bisecting the batch if its checks fail. The number of pull requests that
+// were merged is returned, even if an error stopped the rest of them being
+// merged.
+func runBatch(ctx context.Context, client *github.Client, owner, repoName, base string, batch []*github.PullRequest, opts *Options) (int, error) {
+	trainBranch := trainBranchPrefix + base
+	head, included, err := buildTrain(ctx, client, owner, repoName, base, trainBranch, batch, opts)
+	if err != nil || len(included) == 0 {
+		return 0, err
+	}
+
+	logInfo(ctx, logFields{"repo": owner + "/" + repoName}, "Waiting for checks on %s with pull requests %s", trainBranch, pullRequestNumbers(included))
+	passed, err := waitForChecks(ctx, client, owner, repoName, base, head, opts.MergeTrainTimeout, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if passed {
+		_, _, err := client.Git.UpdateRef(ctx, owner, repoName, &github.Reference{
+			Ref:    github.String("heads/" + base),
+			Object: &github.GitObject{SHA: github.String(head)},
+		}, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fast-forward %s to %s: %w", base, head, err)
+		}
+		logInfo(ctx, logFields{"repo": owner + "/" + repoName}, "Successfully merged pull requests %s into %s as commit %s", pullRequestNumbers(included), base, head)
+		for _, pullRequest := range included {
+			logInfo(ctx, pullRequestFields(pullRequest).with("decision", "merged").with("sha", head), "Merged pull request %d in the merge train", pullRequest.GetNumber())
+			afterMerge(ctx, client, owner, repoName, pullRequest, head, opts)
+		}
+		return len(included), nil
+	}
+
+	if len(included) == 1 {
+		logInfo(ctx, pullRequestFields(included[0]).with("decision", "blocked").with("cause", "checks"), "Checks failed for pull request %d in the merge train. Not merging it.", included[0].GetNumber())
+		addLabel(ctx, client, owner, repoName, included[0], opts.FailureLabel)
+		return 0, nil
+	}
+
+	logInfo(ctx, logFields{"repo": owner + "/" + repoName}, "Checks failed for pull requests %s in the merge train. Bisecting them.", pullRequestNumbers(included))
+	merged := 0
+	middle := len(included) / 2
+	for _, half := range [][]*github.PullRequest{included[:middle], included[middle:]} {
+		halfMerged, err := runBatch(ctx, client, owner, repoName, base, half, opts)
+		merged += halfMerged
+		if err != nil {
+			return merged, err
+		}
+	}
+	return merged, nil
+}
+
+// buildTrain resets the train branch to the head of base and merges each of
+// the pull requests into it. Pull requests that conflict with those before
+// them are left out. The resulting head of the train branch and the pull
+// requests that were merged into it are returned.
+func buildTrain(ctx context.Context, client *github.Client, owner, repoName, base, trainBranch string, batch []*github.PullRequest, opts *Options) (string, []*github.PullRequest, error) {
+	baseRef, _, err := client.Git.GetRef(ctx, owner, repoName, "heads/"+base)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get the head of %s: %w", base, err)
+	}
+	head := baseRef.GetObject().GetSHA()
+
+	trainRef := &github.Reference{
+		Ref:    github.String("heads/" + trainBranch),
+		Object: &github.GitObject{SHA: github.String(head)},
+	}
+	_, resp, err := client.Git.GetRef(ctx, owner, repoName, "heads/"+trainBranch)
+	switch {
+	case err == nil:
+		_, _, err = client.Git.UpdateRef(ctx, owner, repoName, trainRef, true)
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		trainRef.Ref = github.String("refs/heads/" + trainBranch)
+		_, _, err = client.Git.CreateRef(ctx, owner, repoName, trainRef)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to reset %s to %s: %w", trainBranch, base, err)
+	}
+
+	included := []*github.PullRequest{}
+	for _, pullRequest := range batch {
+		message, err := renderTemplate(opts.MergeMessage, newTemplateData(pullRequest, nil))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to render merge message: %w", err)
+		}
+		commit, resp, err := client.Repositories.Merge(ctx, owner, repoName, &github.RepositoryMergeRequest{
+			Base:          github.String(trainBranch),
+			Head:          github.String(pullRequest.GetHead().GetSHA()),
+			CommitMessage: github.String(message),
+		})
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusConflict {
+				logInfo(ctx, pullRequestFields(pullRequest).with("decision", "blocked").with("cause", "conflict"), "Pull request %d conflicts with the rest of the merge train. Not merging it.", pullRequest.GetNumber())
+				addLabel(ctx, client, owner, repoName, pullRequest, opts.FailureLabel)
+				continue
+			}
+			return "", nil, fmt.Errorf("failed to merge pull request %d into %s: %w", pullRequest.GetNumber(), trainBranch, err)
+		}
+		head = commit.GetSHA()
+		included = append(included, pullRequest)
+	}
+	return head, included, nil
+}
+
+// pullRequestNumbers formats the numbers of the pull requests for logging.
+func pullRequestNumbers(pullRequests []*github.PullRequest) string {
+	numbers := []string{}
+	for _, pullRequest := range pullRequests {
+		numbers = append(numbers, fmt.Sprintf("#%d", pullRequest.GetNumber()))
+	}
+	return strings.Join(numbers, ", ")
+}
@@ -0,0 +1,273 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// fakeTrainRepository is a repository on a fake GitHub API to run merge
+// trains against. Each commit is the list of pull request heads merged into
+// it. The checks on a commit fail if it contains any of the broken heads, and
+// merging any of the conflicting heads fails with a conflict.
+type fakeTrainRepository struct {
+	t           *testing.T
+	refs        map[string]string
+	commits     map[string][]string
+	broken      map[string]bool
+	conflicting map[string]bool
+}
+
+func newFakeTrainRepository(t *testing.T) *fakeTrainRepository {
+	return &fakeTrainRepository{
+		t:           t,
+		refs:        map[string]string{"heads/main": "base"},
+		commits:     map[string][]string{"base": nil},
+		broken:      map[string]bool{},
+		conflicting: map[string]bool{},
+	}
+}
+
+func (f *fakeTrainRepository) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/repos/nick96/merger/"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "git/ref/"):
+		ref := strings.TrimPrefix(path, "git/ref/")
+		sha, ok := f.refs[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(f.t, w, &github.Reference{Ref: github.String("refs/" + ref), Object: &github.GitObject{SHA: github.String(sha)}})
+	case r.Method == http.MethodPost && path == "git/refs":
+		var request struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		f.decode(r, &request)
+		f.refs[strings.TrimPrefix(request.Ref, "refs/")] = request.SHA
+		writeJSON(f.t, w, &github.Reference{Ref: github.String(request.Ref)})
+	case r.Method == http.MethodPatch && strings.HasPrefix(path, "git/refs/"):
+		var request struct {
+			SHA string `json:"sha"`
+		}
+		f.decode(r, &request)
+		f.refs[strings.TrimPrefix(path, "git/refs/")] = request.SHA
+		writeJSON(f.t, w, &github.Reference{Ref: github.String("refs/" + strings.TrimPrefix(path, "git/refs/"))})
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "git/refs/"):
+		delete(f.refs, strings.TrimPrefix(path, "git/refs/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && path == "merges":
+		var request github.RepositoryMergeRequest
+		f.decode(r, &request)
+		if f.conflicting[request.GetHead()] {
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(f.t, w, map[string]string{"message": "Merge conflict"})
+			return
+		}
+		parent := f.refs["heads/"+request.GetBase()]
+		contents := append(append([]string{}, f.commits[parent]...), request.GetHead())
+		sha := fmt.Sprintf("commit%d", len(f.commits))
+		f.commits[sha] = contents
+		f.refs["heads/"+request.GetBase()] = sha
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(f.t, w, &github.RepositoryCommit{SHA: github.String(sha)})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "commits/") && strings.HasSuffix(path, "/check-runs"):
+		sha := strings.TrimSuffix(strings.TrimPrefix(path, "commits/"), "/check-runs")
+		conclusion := "success"
+		for _, head := range f.commits[sha] {
+			if f.broken[head] {
+				conclusion = "failure"
+			}
+		}
+		writeJSON(f.t, w, &github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{
+			{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String(conclusion)},
+		}})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "commits/") && strings.HasSuffix(path, "/status"):
+		writeJSON(f.t, w, &github.CombinedStatus{})
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeTrainRepository) decode(r *http.Request, v interface{}) {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		f.t.Errorf("failed to decode %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+func TestRunMergeTrain(t *testing.T) {
+	tests := []struct {
+		name         string
+		broken       []string
+		conflicting  []string
+		wantMerged   int
+		wantFailures int
+		wantMain     []string
+		wantBlocked  map[int]string
+	}{
+		{
+			name:       "green batch",
+			wantMerged: 4,
+			wantMain:   []string{"head1", "head2", "head3", "head4"},
+		},
+		{
+			name:         "failing batch bisected to the broken pull request",
+			broken:       []string{"head2"},
+			wantMerged:   3,
+			wantFailures: 1,
+			wantMain:     []string{"head1", "head3", "head4"},
+			wantBlocked:  map[int]string{2: "checks"},
+		},
+		{
+			name:         "pull request conflicting with the rest of the batch",
+			conflicting:  []string{"head3"},
+			wantMerged:   3,
+			wantFailures: 1,
+			wantMain:     []string{"head1", "head2", "head4"},
+			wantBlocked:  map[int]string{3: "conflict"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newFakeTrainRepository(t)
+			for _, head := range test.broken {
+				repo.broken[head] = true
+			}
+			for _, head := range test.conflicting {
+				repo.conflicting[head] = true
+			}
+			client := newTestClient(t, repo)
+			pullRequests := []*github.PullRequest{}
+			for number := 1; number <= 4; number++ {
+				pullRequest := fakePullRequest(number, fmt.Sprintf("Change %d", number))
+				pullRequest.Head.SHA = github.String(fmt.Sprintf("head%d", number))
+				pullRequests = append(pullRequests, pullRequest)
+			}
+			r := newReport()
+			ctx := withReport(context.Background(), r)
+
+			merged, failures, err := runMergeTrain(ctx, client, "nick96", "merger", pullRequests, &Options{})
+			if err != nil {
+				t.Fatalf("runMergeTrain failed: %v", err)
+			}
+			if merged != test.wantMerged || failures != test.wantFailures {
+				t.Errorf("runMergeTrain merged %d with %d failures, want %d with %d", merged, failures, test.wantMerged, test.wantFailures)
+			}
+			if main := repo.commits[repo.refs["heads/main"]]; !reflect.DeepEqual(main, test.wantMain) {
+				t.Errorf("main has %v, want %v", main, test.wantMain)
+			}
+			if _, ok := repo.refs["heads/"+trainBranchPrefix+"main"]; ok {
+				t.Error("the merge train branch wasn't deleted")
+			}
+			for _, pullRequest := range pullRequests {
+				entry := r.byKey[fmt.Sprintf("nick96/merger#%d", pullRequest.GetNumber())]
+				if entry == nil {
+					t.Fatalf("nothing was recorded about pull request %d", pullRequest.GetNumber())
+				}
+				if cause, ok := test.wantBlocked[pullRequest.GetNumber()]; ok {
+					if entry.decision != "blocked" || entry.cause != cause {
+						t.Errorf("pull request %d was %s (%s), want blocked (%s)", pullRequest.GetNumber(), entry.decision, entry.cause, cause)
+					}
+				} else if entry.decision != "merged" {
+					t.Errorf("pull request %d was %s, want merged", pullRequest.GetNumber(), entry.decision)
+				}
+			}
+		})
+	}
+}
+
+func TestRunMergeTrainFailedBase(t *testing.T) {
+	repo := newFakeTrainRepository(t)
+	client := newTestClient(t, repo)
+	pullRequests := []*github.PullRequest{}
+	for number := 1; number <= 3; number++ {
+		pullRequest := fakePullRequest(number, fmt.Sprintf("Change %d", number))
+		pullRequest.Head.SHA = github.String(fmt.Sprintf("head%d", number))
+		pullRequests = append(pullRequests, pullRequest)
+	}
+	// release doesn't exist, so its train can't be built.
+	pullRequests[0].Base.Ref = github.String("release")
+
+	merged, failures, err := runMergeTrain(context.Background(), client, "nick96", "merger", pullRequests, &Options{})
+	if err == nil {
+		t.Error("runMergeTrain succeeded, want an error for release")
+	}
+	if merged != 2 || failures != 1 {
+		t.Errorf("runMergeTrain merged %d with %d failures, want 2 with 1", merged, failures)
+	}
+	if main := repo.commits[repo.refs["heads/main"]]; !reflect.DeepEqual(main, []string{"head2", "head3"}) {
+		t.Errorf("main has %v, want [head2 head3]", main)
+	}
+}
+
+func TestRunMergeTrainHeld(t *testing.T) {
+	// A window an hour from now is closed whenever the test runs.
+	now := time.Now().UTC()
+	closed, err := ParseMergeWindow(now.Add(time.Hour).Format("15:04") + "-" + now.Add(2*time.Hour).Format("15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         *Options
+		wantMerged   int
+		wantFailures int
+		wantMain     []string
+		wantHeld     map[int]string
+	}{
+		{
+			name:       "pull request rejected by the pre-merge command",
+			opts:       &Options{PreMergeCommand: `test "$MERGER_PR_NUMBER" != 2`},
+			wantMerged: 2,
+			wantMain:   []string{"head1", "head3"},
+			wantHeld:   map[int]string{2: "pre-merge command"},
+		},
+		{
+			name:     "pull requests outside the merge windows",
+			opts:     &Options{MergeWindows: []MergeWindow{closed}, Location: time.UTC},
+			wantHeld: map[int]string{1: "merge window", 2: "merge window", 3: "merge window"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newFakeTrainRepository(t)
+			client := newTestClient(t, repo)
+			pullRequests := []*github.PullRequest{}
+			for number := 1; number <= 3; number++ {
+				pullRequest := fakePullRequest(number, fmt.Sprintf("Change %d", number))
+				pullRequest.Head.SHA = github.String(fmt.Sprintf("head%d", number))
+				pullRequests = append(pullRequests, pullRequest)
+			}
+			r := newReport()
+			ctx := withReport(context.Background(), r)
+
+			merged, failures, err := runMergeTrain(ctx, client, "nick96", "merger", pullRequests, test.opts)
+			if err != nil {
+				t.Fatalf("runMergeTrain failed: %v", err)
+			}
+			if merged != test.wantMerged || failures != test.wantFailures {
+				t.Errorf("runMergeTrain merged %d with %d failures, want %d with %d", merged, failures, test.wantMerged, test.wantFailures)
+			}
+			if main := repo.commits[repo.refs["heads/main"]]; !reflect.DeepEqual(main, test.wantMain) {
+				t.Errorf("main has %v, want %v", main, test.wantMain)
+			}
+			for number, cause := range test.wantHeld {
+				entry := r.byKey[fmt.Sprintf("nick96/merger#%d", number)]
+				if entry == nil || entry.decision != "blocked" || entry.cause != cause {
+					t.Errorf("pull request %d was %+v, want blocked (%s)", number, entry, cause)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package merger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// updateBranch merges the base branch into the pull request's branch. Its
+// checks then have to run again on the new head before it can be merged.
+func updateBranch(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest) error {
+	head := pullRequest.GetHead().GetSHA()
+	_, _, err := client.PullRequests.UpdateBranch(
+		ctx,
+		owner,
+		repoName,
+		pullRequest.GetNumber(),
+		&github.PullRequestBranchUpdateOptions{ExpectedHeadSHA: &head},
+	)
+	// GitHub updates the branch asynchronously and responds with 202
+	// Accepted, which go-github reports as an error.
+	var acceptedErr *github.AcceptedError
+	if err != nil && !errors.As(err, &acceptedErr) {
+		return fmt.Errorf("failed to update branch of pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	logInfo(
+		ctx,
+		pullRequestFields(pullRequest).with("decision", "branch updated"),
+		"Updated the branch of pull request %d with its base",
+		pullRequest.GetNumber(),
+	)
+	return nil
+}
+
+// updateBranchAndWait updates the pull request's branch and waits up to
+// timeout for the checks on its new head to finish, so it can be merged in
+// the same run. The updated pull request is returned. Checks that don't
+// finish in time aren't an error: they leave the updated pull request
+// blocked until a later run.
+func updateBranchAndWait(ctx context.Context, client *github.Client, owner, repoName string, pullRequest *github.PullRequest, timeout time.Duration, opts *Options) (*github.PullRequest, error) {
+	if err := updateBranch(ctx, client, owner, repoName, pullRequest); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	updated, err := waitForNewHead(ctx, client, owner, repoName, pullRequest, deadline)
+	if err != nil {
+		return nil, err
+	}
+	logInfo(ctx, pullRequestFields(pullRequest), "Waiting for checks on the updated head %s of pull request %d", updated.GetHead().GetSHA(), pullRequest.GetNumber())
+	_, err = waitForChecks(ctx, client, owner, repoName, updated.GetBase().GetRef(), updated.GetHead().GetSHA(), time.Until(deadline), opts)
+	if err != nil && !errors.Is(err, errChecksTimedOut) {
+		return nil, fmt.Errorf("failed to wait for checks of pull request %d: %w", pullRequest.GetNumber(), err)
+	}
+	return updated, nil
+}
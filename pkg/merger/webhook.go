@@ -0,0 +1,125 @@
+package merger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// eventWebhookSignatureHeader carries the HMAC-SHA256 of each event's body,
+// in the same format GitHub signs its webhooks with.
+const eventWebhookSignatureHeader = "X-Merger-Signature-256"
+
+// EventWebhook posts an event to a URL whenever merger merges, blocks or fails
+// to merge a pull request. A pull request that is still blocked, or fails
+// again, on the next run doesn't get another event.
+type EventWebhook struct {
+	url string
+	// secret signs the body of each event, if set.
+	secret string
+}
+
+// NewEventWebhook returns an EventWebhook that posts events to url, signed
+// with secret unless it is empty.
+func NewEventWebhook(url, secret string) *EventWebhook {
+	return &EventWebhook{url: url, secret: secret}
+}
+
+// webhookEvent is the JSON posted to the event webhook.
+type webhookEvent struct {
+	Event      string `json:"event"`
+	Repository string `json:"repository"`
+	Number     int    `json:"number"`
+	Title      string `json:"title,omitempty"`
+	Author     string `json:"author,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Checks     string `json:"checks,omitempty"`
+	MergeSHA   string `json:"merge_sha,omitempty"`
+}
+
+// decisionTracker remembers the last decision made about each pull request,
+// so events are only sent when it changes. It is kept in memory, so it only
+// lasts as long as merger keeps running.
+type decisionTracker struct {
+	mu        sync.Mutex
+	decisions map[string]string
+}
+
+func newDecisionTracker() *decisionTracker {
+	return &decisionTracker{decisions: map[string]string{}}
+}
+
+// changed reports whether the decision about the pull request differs from
+// the last one recorded.
+func (t *decisionTracker) changed(key, decision string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous, ok := t.decisions[key]
+	return !ok || previous != decision
+}
+
+// record remembers the decision about the pull request.
+func (t *decisionTracker) record(key, decision string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.decisions[key] = decision
+}
+
+// sendEvents posts an event for each pull request in the report that was
+// merged, blocked or failed, unless decisions says that was also the decision
+// about it last time. It stops at the first event that can't be sent, leaving
+// the rest to be sent after the next run.
+func (w *EventWebhook) sendEvents(ctx context.Context, r *report, decisions *decisionTracker) error {
+	r.mu.Lock()
+	events := []webhookEvent{}
+	for _, entry := range r.entries {
+		key := fmt.Sprintf("%s#%d", entry.repo, entry.number)
+		if !decisions.changed(key, entry.decision) {
+			continue
+		}
+		switch entry.decision {
+		case "merged", "blocked", "failed":
+		default:
+			decisions.record(key, entry.decision)
+			continue
+		}
+		event := webhookEvent{
+			Event:      entry.decision,
+			Repository: entry.repo,
+			Number:     entry.number,
+			URL:        entry.url,
+			Reason:     entry.message,
+			Checks:     entry.checks,
+			MergeSHA:   entry.mergeSHA,
+		}
+		if pullRequest, ok := r.pullRequests[key]; ok {
+			event.Title = pullRequest.GetTitle()
+			event.Author = pullRequest.GetUser().GetLogin()
+		}
+		events = append(events, event)
+	}
+	r.mu.Unlock()
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		headers := map[string]string{}
+		if w.secret != "" {
+			mac := hmac.New(sha256.New, []byte(w.secret))
+			mac.Write(body)
+			headers[eventWebhookSignatureHeader] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		if err := post(ctx, w.url, body, headers); err != nil {
+			return fmt.Errorf("failed to send %s event for %s#%d: %w", event.Event, event.Repository, event.Number, err)
+		}
+		decisions.record(fmt.Sprintf("%s#%d", event.Repository, event.Number), event.Event)
+	}
+	return nil
+}
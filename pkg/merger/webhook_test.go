@@ -0,0 +1,48 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSendEventsOnlyWhenDecisionChanges(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		sent = append(sent, event.Event)
+	}))
+	defer server.Close()
+	webhook := NewEventWebhook(server.URL, "")
+	decisions := newDecisionTracker()
+
+	runs := []struct {
+		decisions []string
+		want      []string
+	}{
+		{[]string{"blocked", "merged"}, []string{"blocked", "merged"}},
+		{[]string{"blocked"}, nil},
+		{[]string{"skipped"}, nil},
+		{[]string{"blocked"}, []string{"blocked"}},
+		{[]string{"failed"}, []string{"failed"}},
+	}
+	for i, run := range runs {
+		r := newReport()
+		for number, decision := range run.decisions {
+			r.record(logFields{"repo": "nick96/merger", "pr": number + 1, "decision": decision}, decision)
+		}
+		sent = nil
+		if err := webhook.sendEvents(context.Background(), r, decisions); err != nil {
+			t.Fatalf("run %d: sendEvents failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(sent, run.want) {
+			t.Errorf("run %d: sent %v, want %v", i, sent, run.want)
+		}
+	}
+}